@@ -0,0 +1,120 @@
+// dictimport 把 ECDICT, StarDict 或 Wiktionary 词典导入数据库, 供离线词典查询.
+//
+//	dictimport -format ecdict ecdict.csv
+//	dictimport -format stardict -replace stardict-langdao-ec/langdao-ec.ifo
+//	dictimport -format wiktionary -lang en kaikki.org-dictionary-English.jsonl
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ilyakaznacheev/cleanenv"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/dict"
+)
+
+// importConfig 只读取配置文件中的数据库部分, 导入时不需要 AI 等配置
+type importConfig struct {
+	Database config.DatabaseConfig `yaml:"Database"`
+}
+
+func main() {
+	format := flag.String("format", dict.SourceECDICT, "dictionary format: ecdict, stardict or wiktionary")
+	configPath := flag.String("config", "", "config file, defaults to /etc/contextdict/config.yaml or ./config.yaml")
+	lang := flag.String("lang", "en", "language code of the Wiktionary entries to import")
+	replace := flag.Bool("replace", false, "delete entries previously imported from the same format first")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dictimport [flags] FILE")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	var cfg importConfig
+	filePath := config.FindConfigFile(*configPath)
+	if filePath == "" {
+		log.Fatal("No config file found.")
+	}
+	if err := cleanenv.ReadConfig(filePath, &cfg); err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	repo, err := database.NewRepository(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize database repository: %v", err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	if *replace {
+		n, err := repo.DeleteDictSource(ctx, *format)
+		if err != nil {
+			log.Fatalf("Failed to delete old %s entries: %v", *format, err)
+		}
+		log.Printf("Deleted %d old %s entries", n, *format)
+	}
+
+	w := dict.NewWriter(ctx, repo)
+	if err := read(*format, flag.Arg(0), *lang, w); err != nil {
+		log.Fatalf("Import failed after %d entries: %v", w.Count(), err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Import failed after %d entries: %v", w.Count(), err)
+	}
+	log.Printf("Imported %d %s entries", w.Count(), *format)
+}
+
+func read(format, path, lang string, w *dict.Writer) error {
+	switch format {
+	case dict.SourceECDICT:
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return dict.ReadECDICT(f, w.Add)
+	case dict.SourceWiktionary:
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return dict.ReadWiktionary(f, lang, w.Add)
+	case dict.SourceStarDict:
+		return readStarDict(path, w)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// readStarDict 根据 .ifo 文件的路径找到同名的 .idx 和 .dict (或 .dict.dz) 文件
+func readStarDict(ifoPath string, w *dict.Writer) error {
+	base := strings.TrimSuffix(ifoPath, ".ifo")
+	var files []io.Reader
+	for _, names := range [][]string{{ifoPath}, {base + ".idx"}, {base + ".dict", base + ".dict.dz"}} {
+		f, err := openFirst(names)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	return dict.ReadStarDict(files[0], files[1], files[2], w.Add)
+}
+
+func openFirst(names []string) (*os.File, error) {
+	var err error
+	for _, name := range names {
+		var f *os.File
+		if f, err = os.Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return nil, err
+}
@@ -15,7 +15,32 @@ type Config struct {
 	AI          AIConfig          `yaml:"AI"`
 	RateLimit   RateLimitConfig   `yaml:"RateLimit"`
 	Prompts     map[string]string `yaml:"Prompts"`
-	SentryDsn   string `yaml:"SentryDsn" env:"SENTRY_DSN" env-required:"true"`
+	SentryDsn   string            `yaml:"SentryDsn" env:"SENTRY_DSN"` // 为空时不上报错误
+	Budget      BudgetConfig      `yaml:"Budget"`
+	Admin       AdminConfig       `yaml:"Admin"`
+	Batch       BatchConfig       `yaml:"Batch"`
+	Jobs        JobsConfig        `yaml:"Jobs"`
+	Summarize   SummarizeConfig   `yaml:"Summarize"`
+	Upload      UploadConfig      `yaml:"Upload"`
+	Dictionary  DictionaryConfig  `yaml:"Dictionary"`
+	// Conversations 配置对结果的追问
+	Conversations ConversationConfig `yaml:"Conversations"`
+	// TTS 配置单词和句子的朗读
+	TTS TTSConfig `yaml:"TTS"`
+	// OCR 配置图片中文本的识别
+	OCR OCRConfig `yaml:"OCR"`
+	// Timeouts 限制一次请求中 AI 调用的总时间
+	Timeouts TimeoutConfig `yaml:"Timeouts"`
+	// Guard 防御 prompt 注入并检查模型的输出
+	Guard GuardConfig `yaml:"Guard"`
+	// Language 配置输入语言的检测和按语言改变 role 的规则
+	Language LanguageConfig `yaml:"Language"`
+	// Moderation 在调用模型前检查输入, 拒绝滥用
+	Moderation ModerationConfig `yaml:"Moderation"`
+	// Tracing 配置 OpenTelemetry 链路追踪
+	Tracing TracingConfig `yaml:"Tracing"`
+	// ErrorReporting 配置错误上报, 在 SentryDsn 不为空时生效
+	ErrorReporting ErrorReportingConfig `yaml:"ErrorReporting"`
 }
 
 type DatabaseConfig struct {
@@ -25,12 +50,35 @@ type DatabaseConfig struct {
 	Password string `yaml:"Password" env:"PS_PASSWORD" env-required:"true"`
 	DBName   string `yaml:"DBName" env-default:"contextdict"`
 	SSLMode  string `yaml:"SSLMode" env-default:"disable"`
+	// SelectionPolicy 决定缓存条目有多个候选结果时返回哪一个: "latest" 或 "best_rated".
+	// 管理员固定的结果总是优先.
+	SelectionPolicy string `yaml:"SelectionPolicy" env-default:"latest"`
 }
 
 type AIConfig struct {
 	APIKey  string `yaml:"APIKey" env:"DS_API_KEY" env-required:"true"`
 	BaseURL string `yaml:"BaseURL"`
 	Model   string `yaml:"Model"`
+	// Models 是重新生成时允许用户选择的其他模型
+	Models []string `yaml:"Models"`
+	// JSONMode 决定如何要求模型输出 JSON: json_schema, json_object (只保证是 JSON) 或 none (只靠 prompt)
+	JSONMode string `yaml:"JSONMode" env-default:"json_schema"`
+	// Params 是所有 role 的默认参数, Roles 按 role 覆盖其中设置了的字段
+	Params ModelParams            `yaml:"Params"`
+	Roles  map[string]ModelParams `yaml:"Roles"`
+}
+
+// ModelParams 是调用模型的参数, 未设置的字段使用接口的默认值.
+// 生成的结果会记录所用的参数, 所以字段也有 json tag.
+type ModelParams struct {
+	Temperature      *float32 `yaml:"Temperature" json:"temperature,omitempty"`
+	TopP             *float32 `yaml:"TopP" json:"top_p,omitempty"`
+	MaxTokens        int      `yaml:"MaxTokens" json:"max_tokens,omitempty"`
+	Seed             *int     `yaml:"Seed" json:"seed,omitempty"`
+	PresencePenalty  float32  `yaml:"PresencePenalty" json:"presence_penalty,omitempty"`
+	FrequencyPenalty float32  `yaml:"FrequencyPenalty" json:"frequency_penalty,omitempty"`
+	Stop             []string `yaml:"Stop" json:"stop,omitempty"`
+	TimeoutSeconds   int      `yaml:"TimeoutSeconds" json:"timeout_seconds,omitempty"` // 单次调用的超时时间
 }
 
 type RateLimitConfig struct {
@@ -40,6 +88,176 @@ type RateLimitConfig struct {
 	RealIPHeader string  `yaml:"RealIPHeader" env-default:"CF-Connecting-IP"`
 }
 
+// BudgetConfig 限制 AI 调用的消耗, 超出后只返回缓存结果.
+// 所有限额为 0 表示不限制.
+type BudgetConfig struct {
+	Enabled          bool                   `yaml:"Enabled" env-default:"false"`
+	PricePer1KTokens float64                `yaml:"PricePer1KTokens"` // 用于把 token 换算成金额
+	Global           BudgetLimit            `yaml:"Global"`
+	Roles            map[string]BudgetLimit `yaml:"Roles"` // key 为 role, 例如 "translate"
+}
+
+type BudgetLimit struct {
+	HourlyTokens int64   `yaml:"HourlyTokens"`
+	DailyTokens  int64   `yaml:"DailyTokens"`
+	HourlyCost   float64 `yaml:"HourlyCost"`
+	DailyCost    float64 `yaml:"DailyCost"`
+}
+
+// AdminConfig 配置管理接口, Token 为空时不注册 /admin 路由.
+type AdminConfig struct {
+	Token string `yaml:"Token" env:"ADMIN_TOKEN"`
+}
+
+// BatchConfig 配置批量预翻译任务
+type BatchConfig struct {
+	Concurrency int `yaml:"Concurrency" env-default:"4"` // 同时进行的 AI 调用数
+	MaxItems    int `yaml:"MaxItems" env-default:"2000"` // 单个任务最多的句子和术语数
+	MaxTerms    int `yaml:"MaxTerms" env-default:"100"`  // 每个文档最多提取的术语数
+	MinTermLen  int `yaml:"MinTermLen" env-default:"4"`  // 术语的最小长度
+	// 运行中的任务定期续租, 实例退出后超过租约的任务由其他实例继续
+	LeaseMinutes int `yaml:"LeaseMinutes" env-default:"10"`
+}
+
+// JobsConfig 配置异步任务队列, 用于超过请求超时时间的长文本
+type JobsConfig struct {
+	Concurrency   int  `yaml:"Concurrency" env-default:"2"`     // worker 数量
+	PollSeconds   int  `yaml:"PollSeconds" env-default:"5"`     // 检查其他实例提交的任务的间隔
+	LeaseMinutes  int  `yaml:"LeaseMinutes" env-default:"10"`   // 超过租约的 running 任务会被重新领取
+	MaxAttempts   int  `yaml:"MaxAttempts" env-default:"3"`     // 超过后任务标记为失败
+	MaxTextLen    int  `yaml:"MaxTextLen" env-default:"200000"` // 单个任务的最大文本长度
+	RetentionDays int  `yaml:"RetentionDays" env-default:"7"`   // 完成的任务保留天数
+	Webhooks      bool `yaml:"Webhooks" env-default:"false"`    // 是否允许完成后回调客户端的 URL
+}
+
+// SummarizeConfig 配置长文本的分块摘要
+type SummarizeConfig struct {
+	Concurrency          int            `yaml:"Concurrency" env-default:"4"`              // 同时摘要的分块数
+	DefaultContextTokens int            `yaml:"DefaultContextTokens" env-default:"16000"` // 未知模型的上下文长度
+	MaxChunkTokens       int            `yaml:"MaxChunkTokens" env-default:"8000"`        // 分块大小的上限
+	ContextTokens        map[string]int `yaml:"ContextTokens"`                            // 按模型覆盖上下文长度
+}
+
+// UploadConfig 配置文档上传 (PDF, EPUB, HTML)
+type UploadConfig struct {
+	MaxMB int64 `yaml:"MaxMB" env-default:"20"` // 上传文件的大小上限
+}
+
+// DictionaryConfig 配置离线词典, 词典数据用 cmd/dictimport 导入
+type DictionaryConfig struct {
+	Enabled bool `yaml:"Enabled" env-default:"false"` // 单个单词先查词典再调用 AI
+}
+
+// ConversationConfig 配置追问的对话, 历史消息保存在数据库中
+type ConversationConfig struct {
+	MaxHistoryTokens int `yaml:"MaxHistoryTokens" env-default:"8000"` // 发送给模型的历史消息的 token 上限
+	MaxQuestionLen   int `yaml:"MaxQuestionLen" env-default:"2000"`   // 单个问题的最大长度
+	MaxTextLen       int `yaml:"MaxTextLen" env-default:"4000"`       // 对话开始时的原文和回答各自的最大长度
+	MaxMessages      int `yaml:"MaxMessages" env-default:"50"`        // 单个对话的最大消息数
+	RetentionDays    int `yaml:"RetentionDays" env-default:"7"`       // 没有新消息的对话保留天数
+}
+
+// TTSConfig 配置 /api/tts, 生成的音频缓存在数据库中
+type TTSConfig struct {
+	Enabled bool `yaml:"Enabled" env-default:"false"`
+	// Provider 为 openai (兼容 OpenAI /audio/speech 的接口) 或 local (本地生成的提示音, 用于测试)
+	Provider   string   `yaml:"Provider" env-default:"openai"`
+	BaseURL    string   `yaml:"BaseURL"`
+	APIKey     string   `yaml:"APIKey" env:"TTS_API_KEY"` // 为空时使用 AI.APIKey
+	Model      string   `yaml:"Model" env-default:"tts-1"`
+	Voice      string   `yaml:"Voice" env-default:"alloy"` // 默认的声音
+	Voices     []string `yaml:"Voices"`                    // 允许选择的其他声音
+	Format     string   `yaml:"Format" env-default:"mp3"`  // mp3, opus, aac, flac 或 wav
+	MaxTextLen int      `yaml:"MaxTextLen" env-default:"500"`
+}
+
+// OCRConfig 配置 /api/ocr, 用支持图片输入的模型识别截图中的文本
+type OCRConfig struct {
+	Enabled bool   `yaml:"Enabled" env-default:"false"`
+	Model   string `yaml:"Model"` // 支持图片输入的模型, 为空时使用 AI.Model
+}
+
+// TimeoutConfig 配置每个请求的 AI 截止时间, 超时后返回 504.
+// 与 AI.Params 中单次调用的 TimeoutSeconds 不同, 它包括重试和分块摘要的所有调用.
+type TimeoutConfig struct {
+	DefaultSeconds int            `yaml:"DefaultSeconds" env-default:"55"` // 应小于服务器 60s 的 WriteTimeout, 负数表示不限制 (0 会被默认值覆盖)
+	Roles          map[string]int `yaml:"Roles"`                           // 按 role 覆盖, 单位为秒, 0 或负数表示不限制
+	// BackgroundSeconds > 0 时, 浏览器取消请求后翻译在后台最多继续这么久, 完成后写入缓存
+	BackgroundSeconds int `yaml:"BackgroundSeconds" env-default:"0"`
+}
+
+// GuardConfig 配置 AI 调用外的防护层: 用标签包裹用户文本, 检查输出是否
+// 偏离 role (原样返回输入, 泄露 system prompt) 并按规则过滤输出.
+type GuardConfig struct {
+	Enabled    bool           `yaml:"Enabled" env-default:"false"`
+	EchoRoles  []string       `yaml:"EchoRoles" env-default:"translate"` // 输出与输入相同视为违规的 role
+	MinEchoLen int            `yaml:"MinEchoLen" env-default:"20"`       // 短于此长度的输入 (例如人名) 允许原样返回
+	Retries    *int           `yaml:"Retries"`                           // 违规后重新生成的次数, 未设置时为 1, 0 表示不重试
+	Filters    []OutputFilter `yaml:"Filters"`
+}
+
+// OutputFilter 是对模型输出的正则过滤规则
+type OutputFilter struct {
+	Name        string   `yaml:"Name"`
+	Pattern     string   `yaml:"Pattern"`
+	Roles       []string `yaml:"Roles"`  // 为空时适用于所有 role
+	Action      string   `yaml:"Action"` // reject (默认, 视为违规) 或 redact (替换为 Replacement)
+	Replacement string   `yaml:"Replacement"`
+}
+
+// ErrorReportingConfig 配置 Sentry 错误上报. IP 和 cookie 从不上报.
+type ErrorReportingConfig struct {
+	Environment string  `yaml:"Environment" env:"SENTRY_ENVIRONMENT"`
+	SampleRate  float64 `yaml:"SampleRate" env-default:"1"`
+	ScrubPII    *bool   `yaml:"ScrubPII"` // 去掉查询参数和请求体中的用户文本, 未设置时为 true. IP 和用户信息总是去掉
+}
+
+// TracingConfig 配置 OpenTelemetry 链路追踪. Endpoint 为空时使用 exporter 的
+// 默认值, 即 OTEL_EXPORTER_OTLP_ENDPOINT 等环境变量.
+type TracingConfig struct {
+	Enabled     bool    `yaml:"Enabled" env-default:"false"`
+	Exporter    string  `yaml:"Exporter" env-default:"otlphttp"` // otlphttp, otlpgrpc 或 stdout (用于调试)
+	Endpoint    string  `yaml:"Endpoint"`                        // host:port, 例如 otel-collector:4318
+	Insecure    bool    `yaml:"Insecure" env-default:"false"`    // 不使用 TLS
+	SampleRatio float64 `yaml:"SampleRatio" env-default:"1"`     // 采样比例, 上游传来的 trace 按上游的决定
+	ServiceName string  `yaml:"ServiceName" env-default:"contextdict"`
+}
+
+// ModerationConfig 配置调用模型前对输入的检查: 本地的关键词/正则黑名单,
+// 识别与 role 无关的聊天式指令的启发式规则, 以及可选的审核 API.
+type ModerationConfig struct {
+	Enabled   bool     `yaml:"Enabled" env-default:"false"`
+	Blocklist []string `yaml:"Blocklist"` // 正则, 不区分大小写, 匹配任意一个即拒绝
+	// HeuristicRoles 是检查聊天式指令的 role, 这些 role 的输入应当是待处理的文本
+	HeuristicRoles     []string            `yaml:"HeuristicRoles" env-default:"translate,format"`
+	HeuristicThreshold int                 `yaml:"HeuristicThreshold" env-default:"2"` // 命中的规则权重之和达到此值时拒绝
+	API                ModerationAPIConfig `yaml:"API"`
+}
+
+// ModerationAPIConfig 配置兼容 OpenAI /moderations 的审核接口
+type ModerationAPIConfig struct {
+	Enabled    bool   `yaml:"Enabled" env-default:"false"`
+	BaseURL    string `yaml:"BaseURL"`
+	APIKey     string `yaml:"APIKey" env:"MODERATION_API_KEY"` // 为空时使用 AI.APIKey
+	Model      string `yaml:"Model" env-default:"omni-moderation-latest"`
+	FailClosed bool   `yaml:"FailClosed" env-default:"false"` // 接口出错时拒绝请求, 默认放行
+}
+
+// LanguageConfig 配置本地的输入语言检测. 检测结果在响应中返回, prompt 中的
+// {source_language} 和 {target_language} 会被替换.
+type LanguageConfig struct {
+	Target        string      `yaml:"Target"`                          // 读者的目标语言 (例如 zh), 为空时不检测
+	MinConfidence float64     `yaml:"MinConfidence" env-default:"0.6"` // 低于此置信度时不应用路由规则
+	Routes        []RouteRule `yaml:"Routes"`
+}
+
+// RouteRule 在输入的语言为 Source 时把 Role 改为 To
+type RouteRule struct {
+	Role   string `yaml:"Role"`
+	Source string `yaml:"Source"` // 语言代码如 en, "target" 表示与 Target 相同, "code" 表示代码
+	To     string `yaml:"To"`
+}
+
 // 按照优先级查找配置文件
 // 1. 命令行参数
 // 2. /etc/contextdict/config.yaml
@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Roles of conversation messages.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one message of a multi-turn conversation. A message with
+// Parts is sent as multi-part content and Content is ignored.
+type Message struct {
+	Role    string
+	Content string
+	Parts   []Part
+}
+
+// Part is a part of a multi-part message, either text or an image.
+type Part struct {
+	Text  string
+	Image *Image
+}
+
+// Image is an image sent to a vision-capable model.
+type Image struct {
+	MIMEType string
+	Data     []byte
+}
+
+// DataURL returns the image as a data URL, the way the OpenAI API accepts
+// uploaded images.
+func (img *Image) DataURL() string {
+	return "data:" + img.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// ErrImagesUnsupported is returned by Chat for images when the client
+// cannot send multi-part messages.
+var ErrImagesUnsupported = errors.New("AI client does not support images")
+
+// ChatClient is implemented by clients that can send a conversation
+// history instead of independent user messages.
+type ChatClient interface {
+	Chat(ctx context.Context, prompt string, messages []Message) (string, error)
+}
+
+// Chat sends messages with client. Clients without multi-turn support get
+// the history as a single user message with the speakers marked; they
+// cannot send images.
+func Chat(ctx context.Context, client Client, prompt string, messages []Message) (string, error) {
+	if cc, ok := client.(ChatClient); ok {
+		return cc.Chat(ctx, prompt, messages)
+	}
+	var b strings.Builder
+	for i, m := range messages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		content := m.Content
+		if m.Parts != nil {
+			var texts []string
+			for _, p := range m.Parts {
+				if p.Image != nil {
+					return "", ErrImagesUnsupported
+				}
+				texts = append(texts, p.Text)
+			}
+			content = strings.Join(texts, "\n")
+		}
+		b.WriteString("[" + m.Role + "]\n" + content)
+	}
+	return client.Generate(ctx, prompt, b.String())
+}
@@ -2,6 +2,7 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 
@@ -11,6 +12,8 @@ import (
 
 type Client interface {
 	Generate(ctx context.Context, prompt string, texts ...string) (string, error)
+	// Model 返回生成结果所用的模型名称
+	Model() string
 }
 
 type DeepSeekClient struct {
@@ -31,29 +34,110 @@ func NewClient(cfg config.AIConfig) Client {
 	}
 }
 
+type modelKey struct{}
+
+// WithModel returns a context in which Generate uses model instead of the
+// configured one.
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// ModelFromContext returns the model set by WithModel, or fallback.
+func ModelFromContext(ctx context.Context, fallback string) string {
+	if model, ok := ctx.Value(modelKey{}).(string); ok && model != "" {
+		return model
+	}
+	return fallback
+}
+
+// Schema describes the JSON output expected from the model.
+type Schema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+type schemaKey struct{}
+
+// WithSchema returns a context in which Generate asks the model for JSON
+// output matching schema. How it is requested depends on AIConfig.JSONMode;
+// the caller still has to validate the result.
+func WithSchema(ctx context.Context, schema Schema) context.Context {
+	return context.WithValue(ctx, schemaKey{}, schema)
+}
+
+// responseFormat 返回请求 JSON 输出的参数, 不支持 json_schema 的接口可以配置为 json_object 或 none
+func (dsc *DeepSeekClient) responseFormat(ctx context.Context) *openai.ChatCompletionResponseFormat {
+	schema, ok := ctx.Value(schemaKey{}).(Schema)
+	if !ok {
+		return nil
+	}
+	switch dsc.cfg.JSONMode {
+	case "json_object":
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	case "none":
+		return nil
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   schema.Name,
+			Schema: schema.Schema,
+			Strict: true,
+		},
+	}
+}
+
+func (dsc *DeepSeekClient) Model() string {
+	return dsc.cfg.Model
+}
+
 func (dsc *DeepSeekClient) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
-	messages := make([]openai.ChatCompletionMessage, len(texts)+1)
-	messages[0] = openai.ChatCompletionMessage{
+	messages := make([]Message, len(texts))
+	for i, text := range texts {
+		messages[i] = Message{Role: RoleUser, Content: text}
+	}
+	return dsc.Chat(ctx, prompt, messages)
+}
+
+// Chat sends prompt as the system message followed by messages.
+func (dsc *DeepSeekClient) Chat(ctx context.Context, prompt string, messages []Message) (string, error) {
+	chat := make([]openai.ChatCompletionMessage, len(messages)+1)
+	chat[0] = openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleSystem,
 		Content: prompt,
 	}
-	for i, text := range texts {
-		messages[i+1] = openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: text,
+	for i, m := range messages {
+		chat[i+1] = openai.ChatCompletionMessage{Role: m.Role}
+		if m.Parts == nil {
+			chat[i+1].Content = m.Content
+			continue
+		}
+		for _, p := range m.Parts {
+			part := openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: p.Text}
+			if p.Image != nil {
+				part = openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: p.Image.DataURL(), Detail: openai.ImageURLDetailHigh},
+				}
+			}
+			chat[i+1].MultiContent = append(chat[i+1].MultiContent, part)
 		}
 	}
 
 	req := openai.ChatCompletionRequest{
-		Model:    dsc.cfg.Model,
-		Messages: messages,
+		Model:          ModelFromContext(ctx, dsc.cfg.Model),
+		Messages:       chat,
+		ResponseFormat: dsc.responseFormat(ctx),
 	}
+	ctx, cancel := applyParams(ctx, &req, dsc.Params(RoleFromContext(ctx)))
+	defer cancel()
 
 	resp, err := dsc.client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		log.Printf("AI ChatCompletion error: %v\n", err)
 		return "", fmt.Errorf("AI request failed: %w", err)
 	}
+	recordUsage(ctx, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 
 	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
 		log.Printf("AI returned empty response or choices. Response: %+v", resp)
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ErrInvalidOutput is returned by GenerateJSON when the model keeps
+// returning output that fails validation.
+var ErrInvalidOutput = errors.New("AI returned invalid structured output")
+
+// GenerateJSON asks client for JSON matching schema and converts it with
+// parse, asking again up to attempts times in total while parse fails.
+// onInvalid, if not nil, is called for every rejected output. Errors of
+// the client itself are returned immediately.
+func GenerateJSON[T any](ctx context.Context, client Client, schema Schema, attempts int,
+	parse func(output string) (T, error), onInvalid func(error),
+	prompt string, texts ...string) (T, error) {
+	ctx = WithSchema(ctx, schema)
+	var zero T
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		output, err := client.Generate(ctx, prompt, texts...)
+		if err != nil {
+			return zero, err
+		}
+		result, err := parse(TrimCodeFence(output))
+		if err == nil {
+			return result, nil
+		}
+		log.Printf("Invalid %s output (attempt %d/%d): %v", schema.Name, attempt, attempts, err)
+		if onInvalid != nil {
+			onInvalid(err)
+		}
+		lastErr = err
+	}
+	return zero, fmt.Errorf("%w: %v", ErrInvalidOutput, lastErr)
+}
+
+// TrimCodeFence removes the markdown code fence some models put around
+// JSON even when asked not to.
+func TrimCodeFence(output string) string {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "```") {
+		return output
+	}
+	output = strings.TrimPrefix(output, "```json")
+	output = strings.TrimPrefix(output, "```")
+	return strings.TrimSpace(strings.TrimSuffix(output, "```"))
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/zzhirong/contextdict/config"
+)
+
+type roleKey struct{}
+
+// WithRole returns a context in which Generate uses the model parameters
+// configured for role.
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// RoleFromContext returns the role set with WithRole, or "".
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey{}).(string)
+	return role
+}
+
+// ParamsClient is implemented by clients with per-role model parameters.
+type ParamsClient interface {
+	Params(role string) config.ModelParams
+}
+
+// ParamsJSON returns the parameters client uses for role as JSON, to be
+// stored with the result. It is empty if nothing is configured.
+func ParamsJSON(client Client, role string) string {
+	pc, ok := client.(ParamsClient)
+	if !ok {
+		return ""
+	}
+	b, err := json.Marshal(pc.Params(role))
+	if err != nil || string(b) == "{}" {
+		return ""
+	}
+	return string(b)
+}
+
+// Params returns the default parameters overridden by those of role.
+func (dsc *DeepSeekClient) Params(role string) config.ModelParams {
+	return mergeParams(dsc.cfg.Params, dsc.cfg.Roles[role])
+}
+
+// mergeParams 返回用 override 中设置了的字段覆盖 base 的参数
+func mergeParams(base, override config.ModelParams) config.ModelParams {
+	if override.Temperature != nil {
+		base.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		base.TopP = override.TopP
+	}
+	if override.MaxTokens != 0 {
+		base.MaxTokens = override.MaxTokens
+	}
+	if override.Seed != nil {
+		base.Seed = override.Seed
+	}
+	if override.PresencePenalty != 0 {
+		base.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != 0 {
+		base.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.Stop != nil {
+		base.Stop = override.Stop
+	}
+	if override.TimeoutSeconds != 0 {
+		base.TimeoutSeconds = override.TimeoutSeconds
+	}
+	return base
+}
+
+// applyParams sets p on req and returns the context with the timeout of p.
+func applyParams(ctx context.Context, req *openai.ChatCompletionRequest, p config.ModelParams) (context.Context, context.CancelFunc) {
+	if p.Temperature != nil {
+		req.Temperature = *p.Temperature
+		// go-openai 省略值为 0 的 temperature, 用最小的正数代替
+		if req.Temperature == 0 {
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	if p.TopP != nil {
+		req.TopP = *p.TopP
+		if req.TopP == 0 {
+			req.TopP = math.SmallestNonzeroFloat32
+		}
+	}
+	req.MaxTokens = p.MaxTokens
+	req.Seed = p.Seed
+	req.PresencePenalty = p.PresencePenalty
+	req.FrequencyPenalty = p.FrequencyPenalty
+	req.Stop = p.Stop
+	if p.TimeoutSeconds > 0 {
+		return context.WithTimeout(ctx, time.Duration(p.TimeoutSeconds)*time.Second)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/config"
+)
+
+func float(v float32) *float32 { return &v }
+
+func TestParams_PerRole(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		data, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(data, &body))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.AIConfig{
+		BaseURL: srv.URL,
+		Model:   "test-model",
+		Params:  config.ModelParams{Temperature: float(0.7), MaxTokens: 2000},
+		Roles: map[string]config.ModelParams{
+			"format": {Temperature: float(0), Stop: []string{"###"}},
+		},
+	})
+
+	_, err := client.Generate(WithRole(context.Background(), "format"), "prompt", "text")
+	require.NoError(t, err)
+	assert.Greater(t, body["temperature"], 0.0) // 0 用最小的正数代替, 否则会被省略
+	assert.Less(t, body["temperature"], 1e-30)
+	assert.Equal(t, 2000.0, body["max_tokens"])
+	assert.Equal(t, []any{"###"}, body["stop"])
+
+	_, err = client.Generate(WithRole(context.Background(), "explain"), "prompt", "text")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.7, body["temperature"], 1e-6)
+	assert.NotContains(t, body, "stop")
+
+	assert.JSONEq(t, `{"temperature":0,"max_tokens":2000,"stop":["###"]}`, ParamsJSON(client, "format"))
+}
+
+func TestParamsJSON_Empty(t *testing.T) {
+	assert.Equal(t, "", ParamsJSON(NewClient(config.AIConfig{}), "translate"))
+}
@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"context"
+	"sync"
+)
+
+// Usage accumulates the token usage reported by the upstream API.
+// It is safe for concurrent use, so one Usage can collect several calls.
+type Usage struct {
+	mu               sync.Mutex
+	promptTokens     int
+	completionTokens int
+}
+
+// Add records the tokens consumed by a single completion.
+func (u *Usage) Add(promptTokens, completionTokens int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.promptTokens += promptTokens
+	u.completionTokens += completionTokens
+}
+
+// Tokens returns the accumulated prompt and completion tokens.
+func (u *Usage) Tokens() (promptTokens, completionTokens int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.promptTokens, u.completionTokens
+}
+
+// Total returns the accumulated number of tokens.
+func (u *Usage) Total() int {
+	p, c := u.Tokens()
+	return p + c
+}
+
+type usageKey struct{}
+
+// WithUsage returns a context in which every Generate call adds its token
+// usage to u.
+func WithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+func recordUsage(ctx context.Context, promptTokens, completionTokens int) {
+	if u, ok := ctx.Value(usageKey{}).(*Usage); ok && u != nil {
+		u.Add(promptTokens, completionTokens)
+	}
+}
@@ -0,0 +1,260 @@
+package batch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/budget"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// ErrTooLarge is returned by Submit when a document yields more items than
+// the configured maximum.
+var ErrTooLarge = errors.New("document has too many sentences and terms")
+
+// Translator translates text (with the selected part, if any) and stores
+// the result in the cache. Cached entries are skipped.
+type Translator interface {
+	Pretranslate(ctx context.Context, text, selected string) error
+}
+
+// saveAttempts 是保存任务项的最多尝试次数, 仍然失败时暂停任务
+const saveAttempts = 3
+
+// saveBackoff 是保存失败后第一次重试前的等待时间, 之后逐次增加
+var saveBackoff = time.Second
+
+// Runner splits documents into items and pre-translates them in the
+// background with bounded concurrency. Progress is stored in the database,
+// and a job is held with a lease, so several instances can share the jobs
+// and unfinished ones are resumed after a restart.
+type Runner struct {
+	repo       database.BatchRepository
+	translator Translator
+	cfg        config.BatchConfig
+	owner      string
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewRunner(repo database.BatchRepository, translator Translator, cfg config.BatchConfig) *Runner {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.LeaseMinutes <= 0 {
+		cfg.LeaseMinutes = 10
+	}
+	return &Runner{
+		repo:       repo,
+		translator: translator,
+		cfg:        cfg,
+		owner:      newOwner(),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// newOwner identifies this instance in the lease of the jobs it runs.
+func newOwner() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	host, _ := os.Hostname()
+	return host + "-" + hex.EncodeToString(b)
+}
+
+func (r *Runner) lease() time.Duration {
+	return time.Duration(r.cfg.LeaseMinutes) * time.Minute
+}
+
+// Submit splits doc into sentences and terms and queues a job for them.
+func (r *Runner) Submit(ctx context.Context, name, doc string, withTerms bool) (*models.BatchJob, error) {
+	sentences := SplitSentences(doc)
+	seen := make(map[[2]string]bool)
+	var items []models.BatchItem
+	add := func(text, selected string) {
+		key := [2]string{text, selected}
+		if !seen[key] {
+			seen[key] = true
+			items = append(items, models.BatchItem{Text: text, Selected: selected})
+		}
+	}
+	for _, s := range sentences {
+		add(s, "")
+	}
+	if withTerms {
+		for _, t := range ExtractTerms(sentences, r.cfg.MinTermLen, r.cfg.MaxTerms) {
+			add(t.Sentence, t.Term)
+		}
+	}
+	if r.cfg.MaxItems > 0 && len(items) > r.cfg.MaxItems {
+		return nil, fmt.Errorf("%w: %d items, limit is %d", ErrTooLarge, len(items), r.cfg.MaxItems)
+	}
+
+	job := &models.BatchJob{Name: name, Status: models.StatusPending}
+	if err := r.repo.CreateBatchJob(ctx, job, items); err != nil {
+		return nil, err
+	}
+	log.Printf("Batch job %d '%s' queued with %d items", job.ID, name, len(items))
+	r.notify()
+	return job, nil
+}
+
+// Resume queues a paused job again.
+func (r *Runner) Resume(ctx context.Context, id uint) error {
+	if err := r.repo.SetBatchJobStatus(ctx, id, models.StatusPending, ""); err != nil {
+		return err
+	}
+	r.notify()
+	return nil
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start processes unfinished jobs until ctx is cancelled.
+func (r *Runner) Start(ctx context.Context) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		// 其他实例退出后留下的任务不会唤醒这里, 定期检查租约过期的任务
+		ticker := time.NewTicker(r.lease())
+		defer ticker.Stop()
+		for {
+			r.runUnfinished(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the runner stopped after its context was cancelled.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Runner) runUnfinished(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := r.repo.ClaimBatchJob(ctx, r.owner, r.lease())
+		if err != nil {
+			log.Printf("Error claiming batch job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		r.run(ctx, job)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job *models.BatchJob) {
+	log.Printf("Batch job %d '%s' running (%d/%d done)", job.ID, job.Name, job.Done+job.Failed, job.Total)
+	for {
+		// 出错返回时任务保持 running, 租约过期后重新领取
+		if err := r.repo.RenewBatchJob(ctx, job.ID, r.owner, r.lease()); err != nil {
+			log.Printf("Batch job %d stopped: %v", job.ID, err)
+			return
+		}
+		items, err := r.repo.PendingBatchItems(ctx, job.ID, r.cfg.Concurrency*10)
+		if err != nil {
+			log.Printf("Error loading items of batch job %d: %v", job.ID, err)
+			return
+		}
+		if len(items) == 0 {
+			break
+		}
+		if err := r.process(ctx, items); err != nil {
+			if ctx.Err() != nil {
+				// 服务关闭, 任务保持 running, 租约过期后继续
+				return
+			}
+			log.Printf("Batch job %d paused: %v", job.ID, err)
+			_ = r.repo.SetBatchJobStatus(context.WithoutCancel(ctx), job.ID, models.StatusPaused, err.Error())
+			return
+		}
+	}
+	if err := r.repo.SetBatchJobStatus(ctx, job.ID, models.StatusDone, ""); err != nil {
+		log.Printf("Error finishing batch job %d: %v", job.ID, err)
+		return
+	}
+	log.Printf("Batch job %d '%s' done", job.ID, job.Name)
+}
+
+// process translates items with at most cfg.Concurrency calls in flight.
+// It returns an error when the whole job should stop, for example when
+// the budget is exhausted; other failures only fail the item.
+func (r *Runner) process(ctx context.Context, items []models.BatchItem) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	sem := make(chan struct{}, r.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := range items {
+		item := &items[i]
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := r.translator.Pretranslate(ctx, item.Text, item.Selected)
+			switch {
+			case ctx.Err() != nil:
+				return // 保持 pending
+			case errors.Is(err, budget.ErrExhausted):
+				cancel(err)
+				return
+			case err != nil:
+				item.Status, item.Error = models.StatusFailed, err.Error()
+			default:
+				item.Status = models.StatusDone
+			}
+			if err := r.save(ctx, item); err != nil {
+				// 保存失败的任务项仍然是 pending, 继续下去会一直重新翻译它
+				cancel(fmt.Errorf("error saving batch item %d: %w", item.ID, err))
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// save stores the result of item, retrying transient database errors.
+func (r *Runner) save(ctx context.Context, item *models.BatchItem) error {
+	var err error
+	for attempt := range saveAttempts {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * saveBackoff):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		if err = r.repo.FinishBatchItem(ctx, item); err == nil {
+			return nil
+		}
+		log.Printf("Error saving batch item %d: %v", item.ID, err)
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// memoryRepo is an in-memory BatchRepository.
+type memoryRepo struct {
+	mu       sync.Mutex
+	jobs     []*models.BatchJob
+	items    []*models.BatchItem
+	saveErr  error
+	attempts int
+}
+
+func (r *memoryRepo) CreateBatchJob(_ context.Context, job *models.BatchJob, items []models.BatchItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID, job.Total = uint(len(r.jobs)+1), len(items)
+	r.jobs = append(r.jobs, job)
+	for i := range items {
+		items[i].ID, items[i].JobID, items[i].Status = uint(len(r.items)+1), job.ID, models.StatusPending
+		r.items = append(r.items, &items[i])
+	}
+	return nil
+}
+
+func (r *memoryRepo) GetBatchJob(_ context.Context, id uint) (*models.BatchJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := *r.jobs[id-1]
+	return &job, nil
+}
+
+func (r *memoryRepo) ListBatchJobs(context.Context, int) ([]models.BatchJob, error) {
+	return nil, nil
+}
+
+func (r *memoryRepo) ClaimBatchJob(_ context.Context, owner string, lease time.Duration) (*models.BatchJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, j := range r.jobs {
+		if j.Status == models.StatusPending ||
+			(j.Status == models.StatusRunning && (j.LeaseUntil == nil || j.LeaseUntil.Before(now))) {
+			until := now.Add(lease)
+			j.Status, j.Owner, j.LeaseUntil = models.StatusRunning, owner, &until
+			job := *j
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepo) RenewBatchJob(_ context.Context, id uint, owner string, lease time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.jobs[id-1]
+	if j.Owner != owner || j.Status != models.StatusRunning {
+		return database.ErrLeaseLost
+	}
+	until := time.Now().Add(lease)
+	j.LeaseUntil = &until
+	return nil
+}
+
+func (r *memoryRepo) SetBatchJobStatus(_ context.Context, id uint, status, errMsg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[id-1].Status, r.jobs[id-1].Error = status, errMsg
+	return nil
+}
+
+func (r *memoryRepo) PendingBatchItems(_ context.Context, jobID uint, limit int) ([]models.BatchItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var items []models.BatchItem
+	for _, item := range r.items {
+		if item.JobID == jobID && item.Status == models.StatusPending && len(items) < limit {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+func (r *memoryRepo) FinishBatchItem(_ context.Context, item *models.BatchItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	*r.items[item.ID-1] = *item
+	job := r.jobs[item.JobID-1]
+	if item.Status == models.StatusFailed {
+		job.Failed++
+	} else {
+		job.Done++
+	}
+	return nil
+}
+
+type translatorFunc func(ctx context.Context, text, selected string) error
+
+func (f translatorFunc) Pretranslate(ctx context.Context, text, selected string) error {
+	return f(ctx, text, selected)
+}
+
+func TestRunner_RunsClaimedJobs(t *testing.T) {
+	repo := &memoryRepo{}
+	r := NewRunner(repo, translatorFunc(func(_ context.Context, text, _ string) error {
+		if text == "Bad one." {
+			return errors.New("AI failed")
+		}
+		return nil
+	}), config.BatchConfig{Concurrency: 2})
+	job, err := r.Submit(context.Background(), "doc", "Good one. Bad one.", false)
+	require.NoError(t, err)
+
+	// 其他实例持有租约的任务不会被领取
+	other := time.Now().Add(time.Hour)
+	held := &models.BatchJob{Name: "held", Status: models.StatusRunning, Owner: "other", LeaseUntil: &other}
+	require.NoError(t, repo.CreateBatchJob(context.Background(), held, []models.BatchItem{{Text: "x"}}))
+
+	r.runUnfinished(context.Background())
+	job, _ = repo.GetBatchJob(context.Background(), job.ID)
+	assert.Equal(t, models.StatusDone, job.Status)
+	assert.Equal(t, 1, job.Done)
+	assert.Equal(t, 1, job.Failed)
+	held, _ = repo.GetBatchJob(context.Background(), held.ID)
+	assert.Equal(t, "other", held.Owner)
+	assert.Equal(t, 0, held.Done)
+}
+
+func TestRunner_PausesOnSaveErrors(t *testing.T) {
+	saveBackoff = time.Millisecond
+	t.Cleanup(func() { saveBackoff = time.Second })
+	repo := &memoryRepo{saveErr: errors.New("connection refused")}
+	var calls int
+	r := NewRunner(repo, translatorFunc(func(context.Context, string, string) error {
+		calls++
+		return nil
+	}), config.BatchConfig{Concurrency: 1})
+	job, err := r.Submit(context.Background(), "doc", "Only one sentence.", false)
+	require.NoError(t, err)
+
+	r.runUnfinished(context.Background())
+	job, _ = repo.GetBatchJob(context.Background(), job.ID)
+	assert.Equal(t, models.StatusPaused, job.Status)
+	assert.Contains(t, job.Error, "connection refused")
+	assert.Equal(t, 1, calls, "保存失败的任务项不应反复翻译")
+	assert.Equal(t, saveAttempts, repo.attempts)
+}
@@ -0,0 +1,150 @@
+package batch
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// abbreviations 结尾的句点不作为句子结束
+var abbreviations = map[string]bool{
+	"e.g.": true, "i.e.": true, "etc.": true, "vs.": true, "cf.": true,
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "prof.": true,
+	"fig.": true, "eq.": true, "no.": true, "vol.": true, "p.": true, "pp.": true,
+}
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+	spaces         = regexp.MustCompile(`\s+`)
+	wordPattern    = regexp.MustCompile(`[A-Za-z][A-Za-z'-]*[A-Za-z]`)
+)
+
+// SplitSentences splits a document into sentences. Line breaks inside a
+// paragraph are joined, as they come from the page layout.
+func SplitSentences(doc string) []string {
+	var sentences []string
+	for _, para := range paragraphBreak.Split(doc, -1) {
+		para = strings.TrimSpace(spaces.ReplaceAllString(para, " "))
+		if para == "" {
+			continue
+		}
+		sentences = append(sentences, splitParagraph(para)...)
+	}
+	return sentences
+}
+
+func splitParagraph(para string) []string {
+	var sentences []string
+	runes := []rune(para)
+	start := 0
+	for i, r := range runes {
+		if !isSentenceEnd(r) {
+			continue
+		}
+		// 中文标点后直接断句, 英文标点后需要空白和大写字母(或结尾)
+		if r == '.' || r == '!' || r == '?' {
+			if i+1 < len(runes) && (runes[i+1] != ' ' || i+2 >= len(runes) || !startsSentence(runes[i+2])) {
+				continue
+			}
+			if r == '.' && isAbbreviation(runes[start:i+1]) {
+				continue
+			}
+		}
+		if s := strings.TrimSpace(string(runes[start : i+1])); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = i + 1
+	}
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '.', '!', '?', '。', '！', '？':
+		return true
+	}
+	return false
+}
+
+// startsSentence 大写字母, 数字, 引号以及中日文等没有大小写的文字都可以开始一个句子
+func startsSentence(r rune) bool {
+	return unicode.IsDigit(r) || (unicode.IsLetter(r) && !unicode.IsLower(r)) ||
+		r == '"' || r == '(' || r == '“'
+}
+
+func isAbbreviation(sentence []rune) bool {
+	fields := strings.Fields(string(sentence))
+	if len(fields) == 0 {
+		return false
+	}
+	last := strings.ToLower(fields[len(fields)-1])
+	// 单个大写字母加句点一般是人名缩写, 如 "J. R. R. Tolkien"
+	return abbreviations[last] || (len(last) == 2 && unicode.IsLetter(rune(last[0])))
+}
+
+// stopWords 不作为术语候选
+var stopWords = map[string]bool{
+	"about": true, "above": true, "after": true, "again": true, "also": true,
+	"because": true, "been": true, "before": true, "being": true, "between": true,
+	"both": true, "cannot": true, "could": true, "does": true, "doing": true,
+	"down": true, "during": true, "each": true, "even": true, "every": true,
+	"from": true, "further": true, "have": true, "having": true, "here": true,
+	"however": true, "into": true, "itself": true, "just": true, "like": true,
+	"made": true, "make": true, "many": true, "more": true, "most": true,
+	"much": true, "must": true, "need": true, "only": true, "other": true,
+	"over": true, "same": true, "should": true, "some": true, "such": true,
+	"than": true, "that": true, "their": true, "them": true, "then": true,
+	"there": true, "these": true, "they": true, "this": true, "those": true,
+	"through": true, "under": true, "until": true, "used": true, "using": true,
+	"very": true, "want": true, "well": true, "were": true, "what": true,
+	"when": true, "where": true, "which": true, "while": true, "will": true,
+	"with": true, "within": true, "without": true, "would": true, "your": true,
+}
+
+// Term is a candidate term and the first sentence it appears in.
+type Term struct {
+	Term     string
+	Sentence string
+	Count    int
+}
+
+// ExtractTerms returns up to max candidate terms: words of at least
+// minLen letters that are not stop words and occur at least twice, most
+// frequent first.
+func ExtractTerms(sentences []string, minLen, max int) []Term {
+	byWord := make(map[string]*Term)
+	for _, s := range sentences {
+		for _, w := range wordPattern.FindAllString(s, -1) {
+			key := strings.ToLower(w)
+			if len(key) < minLen || stopWords[key] {
+				continue
+			}
+			if t, ok := byWord[key]; ok {
+				t.Count++
+				continue
+			}
+			byWord[key] = &Term{Term: w, Sentence: s, Count: 1}
+		}
+	}
+
+	terms := make([]Term, 0, len(byWord))
+	for _, t := range byWord {
+		if t.Count >= 2 {
+			terms = append(terms, *t)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if max > 0 && len(terms) > max {
+		terms = terms[:max]
+	}
+	return terms
+}
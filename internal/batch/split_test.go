@@ -0,0 +1,38 @@
+package batch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	doc := "Closures capture variables. A closure, e.g. a func literal,\nmay refer to variables\ndefined in an enclosing function!\n\n" +
+		"Dr. Smith wrote J. R. Tolkien's biography? 这是第一句。这是第二句！"
+	want := []string{
+		"Closures capture variables.",
+		"A closure, e.g. a func literal, may refer to variables defined in an enclosing function!",
+		"Dr. Smith wrote J. R. Tolkien's biography?",
+		"这是第一句。",
+		"这是第二句！",
+	}
+	if got := SplitSentences(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitSentences() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestExtractTerms(t *testing.T) {
+	sentences := []string{
+		"A goroutine is a lightweight thread.",
+		"Each goroutine has its own stack, and channels connect goroutines.",
+		"Channels are typed; a goroutine blocks on unbuffered channels.",
+	}
+	got := ExtractTerms(sentences, 4, 2)
+	// 次数相同时按字母排序
+	want := []Term{
+		{Term: "channels", Sentence: sentences[1], Count: 3},
+		{Term: "goroutine", Sentence: sentences[0], Count: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractTerms() = %+v, want %+v", got, want)
+	}
+}
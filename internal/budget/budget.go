@@ -0,0 +1,233 @@
+package budget
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/metrics"
+)
+
+// ErrExhausted is returned by Allow when the budget does not cover another AI call.
+var ErrExhausted = errors.New("AI budget exhausted")
+
+const globalScope = "global"
+
+// window counts the tokens spent in a fixed period (an hour or a UTC day).
+type window struct {
+	length time.Duration
+	start  time.Time
+	tokens int64
+}
+
+func (w *window) roll(now time.Time) {
+	if start := now.Truncate(w.length); !start.Equal(w.start) {
+		w.start = start
+		w.tokens = 0
+	}
+}
+
+type counter struct {
+	limit config.BudgetLimit
+	hour  window
+	day   window
+}
+
+func newCounter(limit config.BudgetLimit) *counter {
+	return &counter{
+		limit: limit,
+		hour:  window{length: time.Hour},
+		day:   window{length: 24 * time.Hour},
+	}
+}
+
+// Budget 记录 AI 调用消耗的 token, 超过全局或者 role 的限额后拒绝新的调用,
+// 此时服务退化为只返回缓存. 也可以通过 Trip 手动断开.
+type Budget struct {
+	mu      sync.Mutex
+	cfg     config.BudgetConfig
+	global  *counter
+	roles   map[string]*counter
+	tripped bool
+	metrics *metrics.Metrics
+	now     func() time.Time
+}
+
+// New creates a Budget from cfg. metrics may be nil.
+func New(cfg config.BudgetConfig, m *metrics.Metrics) *Budget {
+	b := &Budget{
+		cfg:     cfg,
+		global:  newCounter(cfg.Global),
+		roles:   make(map[string]*counter, len(cfg.Roles)),
+		metrics: m,
+		now:     time.Now,
+	}
+	for role, limit := range cfg.Roles {
+		b.roles[role] = newCounter(limit)
+	}
+	return b
+}
+
+// Allow reports whether another AI call for role fits in the budget.
+// A nil Budget allows everything; a disabled one only enforces Trip.
+func (b *Budget) Allow(role string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tripped {
+		b.reject(role)
+		return ErrExhausted
+	}
+	if !b.cfg.Enabled {
+		return nil
+	}
+	now := b.now()
+	if b.exhausted(b.global, now) {
+		b.reject(role)
+		return ErrExhausted
+	}
+	if c, ok := b.roles[role]; ok && b.exhausted(c, now) {
+		b.reject(role)
+		return ErrExhausted
+	}
+	return nil
+}
+
+// Record adds the tokens spent by an AI call for role.
+func (b *Budget) Record(role string, tokens int) {
+	if b == nil || !b.cfg.Enabled || tokens <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.add(globalScope, b.global, now, int64(tokens))
+	if c, ok := b.roles[role]; ok {
+		b.add(role, c, now, int64(tokens))
+	}
+}
+
+// Trip opens the breaker manually: until Reset only cached results are
+// served, even if the budget limits are disabled.
+func (b *Budget) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tripped = true
+	b.setExhausted(globalScope, true)
+}
+
+// Reset closes the breaker and clears the spent tokens of all windows.
+func (b *Budget) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tripped = false
+	for scope, c := range b.counters() {
+		c.hour.tokens, c.day.tokens = 0, 0
+		b.observe(scope, c)
+		b.setExhausted(scope, false)
+	}
+}
+
+// ScopeStatus is the state of the global budget or of a single role.
+type ScopeStatus struct {
+	Scope        string             `json:"scope"`
+	HourlyTokens int64              `json:"hourly_tokens"`
+	DailyTokens  int64              `json:"daily_tokens"`
+	HourlyCost   float64            `json:"hourly_cost"`
+	DailyCost    float64            `json:"daily_cost"`
+	Limit        config.BudgetLimit `json:"limit"`
+	Exhausted    bool               `json:"exhausted"`
+}
+
+type Status struct {
+	Enabled bool          `json:"enabled"`
+	Tripped bool          `json:"tripped"`
+	Scopes  []ScopeStatus `json:"scopes"`
+}
+
+// Status returns a snapshot of all budget windows.
+func (b *Budget) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	st := Status{Enabled: b.cfg.Enabled, Tripped: b.tripped}
+	for scope, c := range b.counters() {
+		c.hour.roll(now)
+		c.day.roll(now)
+		st.Scopes = append(st.Scopes, ScopeStatus{
+			Scope:        scope,
+			HourlyTokens: c.hour.tokens,
+			DailyTokens:  c.day.tokens,
+			HourlyCost:   b.cost(c.hour.tokens),
+			DailyCost:    b.cost(c.day.tokens),
+			Limit:        c.limit,
+			Exhausted:    b.exhausted(c, now),
+		})
+	}
+	sort.Slice(st.Scopes, func(i, j int) bool { return st.Scopes[i].Scope < st.Scopes[j].Scope })
+	return st
+}
+
+func (b *Budget) counters() map[string]*counter {
+	all := make(map[string]*counter, len(b.roles)+1)
+	for role, c := range b.roles {
+		all[role] = c
+	}
+	all[globalScope] = b.global
+	return all
+}
+
+func (b *Budget) cost(tokens int64) float64 {
+	return float64(tokens) / 1000 * b.cfg.PricePer1KTokens
+}
+
+func (b *Budget) exhausted(c *counter, now time.Time) bool {
+	c.hour.roll(now)
+	c.day.roll(now)
+	over := func(tokens, maxTokens int64, maxCost float64) bool {
+		return (maxTokens > 0 && tokens >= maxTokens) ||
+			(maxCost > 0 && b.cost(tokens) >= maxCost)
+	}
+	return over(c.hour.tokens, c.limit.HourlyTokens, c.limit.HourlyCost) ||
+		over(c.day.tokens, c.limit.DailyTokens, c.limit.DailyCost)
+}
+
+func (b *Budget) add(scope string, c *counter, now time.Time, tokens int64) {
+	c.hour.roll(now)
+	c.day.roll(now)
+	c.hour.tokens += tokens
+	c.day.tokens += tokens
+	b.observe(scope, c)
+	b.setExhausted(scope, b.exhausted(c, now))
+}
+
+func (b *Budget) reject(role string) {
+	if b.metrics != nil {
+		b.metrics.AIBudgetRejectedCounter.WithLabelValues(role).Inc()
+	}
+}
+
+func (b *Budget) observe(scope string, c *counter) {
+	if b.metrics != nil {
+		b.metrics.AIBudgetTokens.WithLabelValues(scope, "hour").Set(float64(c.hour.tokens))
+		b.metrics.AIBudgetTokens.WithLabelValues(scope, "day").Set(float64(c.day.tokens))
+	}
+}
+
+func (b *Budget) setExhausted(scope string, exhausted bool) {
+	if b.metrics == nil {
+		return
+	}
+	v := 0.0
+	if exhausted {
+		v = 1
+	}
+	b.metrics.AIBudgetExhausted.WithLabelValues(scope).Set(v)
+}
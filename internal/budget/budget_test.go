@@ -0,0 +1,114 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/metrics"
+)
+
+// newBudget returns a Budget whose clock is set by the returned function.
+func newBudget(cfg config.BudgetConfig) (*Budget, *metrics.Metrics, func(time.Time)) {
+	m := metrics.NewMetricsWith(prometheus.NewRegistry())
+	b := New(cfg, m)
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, m, func(t time.Time) { now = t }
+}
+
+func TestBudget_HourlyWindowRollover(t *testing.T) {
+	b, _, setNow := newBudget(config.BudgetConfig{Enabled: true, Global: config.BudgetLimit{HourlyTokens: 100}})
+
+	b.Record("translate", 60)
+	assert.NoError(t, b.Allow("translate"))
+	b.Record("translate", 40)
+	assert.ErrorIs(t, b.Allow("translate"), ErrExhausted)
+
+	// 同一小时内仍然耗尽, 下一个整点恢复
+	setNow(time.Date(2024, 5, 1, 10, 59, 59, 0, time.UTC))
+	assert.ErrorIs(t, b.Allow("translate"), ErrExhausted)
+	setNow(time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC))
+	assert.NoError(t, b.Allow("translate"))
+	assert.Equal(t, int64(0), b.Status().Scopes[0].HourlyTokens)
+	assert.Equal(t, int64(100), b.Status().Scopes[0].DailyTokens)
+}
+
+func TestBudget_DailyWindowRollover(t *testing.T) {
+	b, _, setNow := newBudget(config.BudgetConfig{Enabled: true, Global: config.BudgetLimit{DailyTokens: 100}})
+
+	b.Record("translate", 100)
+	setNow(time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, b.Allow("translate"), ErrExhausted)
+
+	// 按 UTC 日期滚动
+	setNow(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, b.Allow("translate"))
+	assert.Equal(t, int64(0), b.Status().Scopes[0].DailyTokens)
+}
+
+func TestBudget_RoleLimits(t *testing.T) {
+	b, m, _ := newBudget(config.BudgetConfig{
+		Enabled: true,
+		Global:  config.BudgetLimit{HourlyTokens: 1000},
+		Roles:   map[string]config.BudgetLimit{"explain": {HourlyTokens: 50}},
+	})
+
+	b.Record("explain", 50)
+	assert.ErrorIs(t, b.Allow("explain"), ErrExhausted)
+	assert.NoError(t, b.Allow("translate"), "其他 role 只受全局限额限制")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.AIBudgetRejectedCounter.WithLabelValues("explain")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.AIBudgetExhausted.WithLabelValues("explain")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.AIBudgetExhausted.WithLabelValues(globalScope)))
+
+	// role 的消耗同时计入全局
+	b.Record("translate", 950)
+	assert.ErrorIs(t, b.Allow("translate"), ErrExhausted)
+	st := b.Status()
+	assert.Equal(t, []string{"explain", globalScope}, []string{st.Scopes[0].Scope, st.Scopes[1].Scope})
+	assert.Equal(t, int64(50), st.Scopes[0].HourlyTokens)
+	assert.Equal(t, int64(1000), st.Scopes[1].HourlyTokens)
+
+	b.Reset()
+	assert.NoError(t, b.Allow("explain"))
+	assert.NoError(t, b.Allow("translate"))
+}
+
+func TestBudget_Cost(t *testing.T) {
+	b, _, _ := newBudget(config.BudgetConfig{
+		Enabled:          true,
+		PricePer1KTokens: 0.5,
+		Global:           config.BudgetLimit{HourlyCost: 1},
+	})
+
+	b.Record("translate", 1500)
+	st := b.Status().Scopes[0]
+	assert.InDelta(t, 0.75, st.HourlyCost, 1e-9)
+	assert.InDelta(t, 0.75, st.DailyCost, 1e-9)
+	assert.NoError(t, b.Allow("translate"))
+
+	b.Record("translate", 500)
+	assert.ErrorIs(t, b.Allow("translate"), ErrExhausted)
+	assert.True(t, b.Status().Scopes[0].Exhausted)
+}
+
+func TestBudget_Trip(t *testing.T) {
+	// 未启用限额时也可以手动断开
+	b, _, _ := newBudget(config.BudgetConfig{})
+	b.Record("translate", 1_000_000)
+	assert.NoError(t, b.Allow("translate"))
+
+	b.Trip()
+	assert.ErrorIs(t, b.Allow("translate"), ErrExhausted)
+	assert.True(t, b.Status().Tripped)
+
+	b.Reset()
+	assert.NoError(t, b.Allow("translate"))
+
+	var nilBudget *Budget
+	assert.NoError(t, nilBudget.Allow("translate"))
+}
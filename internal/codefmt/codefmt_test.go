@@ -0,0 +1,84 @@
+package codefmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"json", `{"a": [1, 2], "b": null}`, "json"},
+		{"go", "func main() {\nx := 1\nif err != nil {\nreturn\n}\n}", "go"},
+		{"sql", "SELECT id, name FROM users WHERE id = 1", "sql"},
+		{"sql lowercase", "select id from users where id = 1;", "sql"},
+		{"python", "def add(a, b):\n    return a + b\n\nprint(add(1, 2))", "python"},
+		{"javascript", "const add = (a, b) => a + b;\nconsole.log(add(1, 2));", "javascript"},
+		{"java", "public class Main {\n  public static void main(String[] args) {\n    System.out.println(1);\n  }\n}", "java"},
+		{"prose", "A closure is a function that captures variables from its enclosing scope.", ""},
+		{"sql update", "update users set name = 'x' where id = 2;", "sql"},
+		{"sql join", "select u.id, o.total from users u join orders o on o.user_id = u.id", "sql"},
+		{"prose with sql words", "Select the file from the menu where it is listed.", ""},
+		{"prose delete", "Delete the rows where the id is null;", ""},
+		{"prose update", "Update your profile from the settings page;", ""},
+		{"prose select", "Select the file from the menu where it is listed;", ""},
+		{"braces in prose", "{not json}", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Detect(tt.text))
+		})
+	}
+}
+
+func TestDetectAndFormat(t *testing.T) {
+	lang, out, ok := DetectAndFormat("func add(a int,b int) int {\nreturn a+b\n}\nfunc main() {\nx := add(1,2)\nfmt.Println(x)\n}")
+	require.True(t, ok)
+	assert.Equal(t, "go", lang)
+	assert.Equal(t, "```go\nfunc add(a int, b int) int {\n\treturn a + b\n}\nfunc main() {\n\tx := add(1, 2)\n\tfmt.Println(x)\n}\n```", out)
+
+	_, out, ok = DetectAndFormat(`{"a":1,"b":[true,false]}`)
+	require.True(t, ok)
+	assert.Equal(t, "```json\n{\n  \"a\": 1,\n  \"b\": [\n    true,\n    false\n  ]\n}\n```", out)
+
+	// 无法解析的 Go 代码交给 AI
+	_, _, ok = DetectAndFormat("func main() {\nx := \nif err != nil {\n")
+	assert.False(t, ok)
+
+	// 没有本地格式化工具的语言
+	lang, _, ok = DetectAndFormat("def add(a, b):\n    return a + b\n\nprint(add(1, 2))")
+	assert.Equal(t, "python", lang)
+	assert.False(t, ok)
+}
+
+func TestFormatSQL(t *testing.T) {
+	out, err := FormatSQL("select u.id, count(*) as n from users u left join orders o on o.user_id = u.id " +
+		"where u.active = 1 and o.created_at between '2024-01-01' and '2024-12-31' " +
+		"or u.id in (select user_id from vip) group by u.id order by n desc limit 10;")
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT u.id, COUNT(*) AS n
+FROM users u
+LEFT JOIN orders o ON o.user_id = u.id
+WHERE u.active = 1
+  AND o.created_at BETWEEN '2024-01-01' AND '2024-12-31'
+  OR u.id IN (
+  SELECT user_id
+  FROM vip
+)
+GROUP BY u.id
+ORDER BY n DESC
+LIMIT 10;
+`, out)
+
+	out, err = FormatSQL("insert into t (a, b) values (1, 'it''s -- not a comment'); update t set a = a + 1")
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO t(a, b)\nVALUES (1, 'it''s -- not a comment');\n\nUPDATE t\nSET a = a + 1\n", out)
+
+	_, err = FormatSQL("SELECT 'unterminated")
+	assert.Error(t, err)
+}
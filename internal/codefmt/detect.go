@@ -0,0 +1,75 @@
+// Package codefmt detects code snippets and formats them locally, so that
+// common languages do not need a round trip to the model.
+package codefmt
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/textclean"
+)
+
+// rule 是一种语言的特征, 每个匹配的 pattern 计一分
+type rule struct {
+	lang     string
+	patterns []*regexp.Regexp
+}
+
+func patterns(exprs ...string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, len(exprs))
+	for i, e := range exprs {
+		res[i] = regexp.MustCompile(`(?m)` + e)
+	}
+	return res
+}
+
+var rules = []rule{
+	{"go", patterns(`^package \w+$`, `\bfunc (\(\w+ \*?\w+\) )?\w*\(`, `:=`, `\berr != nil\b`,
+		`^import \($`, `\bchan\b|\bgo func\b|\bdefer \w`, `\bfmt\.\w+\(`, `\[\]\w+\{`)},
+	// 小写的 SQL 关键字也常见于英文句子 ("Select the file from the menu where ..."),
+	// 只有大写关键字或者列清单, 比较运算符等 SQL 结构才计分
+	{"sql", patterns(`^\s*(SELECT|INSERT INTO|UPDATE|DELETE FROM|CREATE (TABLE|INDEX|VIEW)|ALTER TABLE|WITH)\b`,
+		`\b(FROM|WHERE|JOIN|GROUP BY|ORDER BY|VALUES|SET)\b`, `(?i)^\s*(select|insert|update|delete|create|alter)\b[\s\S]*;\s*$`,
+		`(?i)^\s*select\s+(\*|distinct\b|count\(|[\w.]+\s*,)`,
+		`(?i)\bwhere\s+[\w.]+\s*(=|<>|!=|<=|>=|<|>|\bin\s*\(|\blike\s+')`,
+		`(?i)\b(insert\s+into\s+\w+\s*(\(|values\b)|update\s+\w+\s+set\s+[\w.]+\s*=|delete\s+from\s+\w+\s+where\b|join\s+\w+(\s+\w+)?\s+on\b)`)},
+	{"python", patterns(`^\s*def \w+\(.*\):\s*$`, `^\s*(from \w+(\.\w+)* )?import \w+`, `\bself\.\w+`,
+		`^\s*(elif|except|with) .*:\s*$`, `\bprint\(`, `^\s*class \w+(\(.*\))?:\s*$`)},
+	{"javascript", patterns(`\b(const|let) \w+ =`, `=>`, `\bfunction\s*\w*\(`, `\bconsole\.log\(`,
+		`===|!==`, `\b(document|window)\.\w+`, `\brequire\(['"]`)},
+	{"java", patterns(`\bpublic (static )?(class|void|final)\b`, `\bSystem\.out\.print`, `\bprivate \w+(<.*>)? \w+;`,
+		`\bnew \w+(<.*>)?\(`, `@Override\b`, `\bString\[\] args\b`)},
+	{"cpp", patterns(`^#include\s*[<"]`, `\bstd::\w+`, `\bint main\(`, `\bprintf\(`, `\w->\w`, `\bcout <<`)},
+	{"bash", patterns(`^#!/bin/(ba)?sh`, `^\$ \w+`, `^\s*(sudo|apt-get|echo|export|cd|ls|grep|curl) `, `\| (grep|awk|sed|xargs)\b`)},
+}
+
+// Detect guesses the language of text. It returns "" for prose and for
+// code it cannot tell apart with enough confidence.
+func Detect(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	if (text[0] == '{' || text[0] == '[') && json.Valid([]byte(text)) {
+		return "json"
+	}
+
+	best, bestScore := "", 0
+	for _, r := range rules {
+		score := 0
+		for _, p := range r.patterns {
+			if p.MatchString(text) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = r.lang, score
+		}
+	}
+	// 单个特征可能出现在普通文本中, 需要代码的版式或更多特征
+	if bestScore >= 3 || (bestScore >= 2 && textclean.LooksLikeCode(text)) || (best == "sql" && bestScore >= 2) {
+		return best
+	}
+	return ""
+}
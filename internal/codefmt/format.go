@@ -0,0 +1,72 @@
+package codefmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// ErrNoFormatter is returned by Format for languages without a local
+// formatter.
+var ErrNoFormatter = errors.New("no local formatter for language")
+
+var formatters = map[string]func(string) (string, error){
+	"go":   formatGo,
+	"json": formatJSON,
+	"sql":  FormatSQL,
+}
+
+// CanFormat reports whether lang has a local formatter.
+func CanFormat(lang string) bool {
+	_, ok := formatters[lang]
+	return ok
+}
+
+// Format formats code written in lang.
+func Format(lang, code string) (string, error) {
+	f, ok := formatters[lang]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoFormatter, lang)
+	}
+	return f(code)
+}
+
+// Fence wraps code in a Markdown code block tagged with lang.
+func Fence(lang, code string) string {
+	return "```" + lang + "\n" + strings.TrimRight(code, "\n") + "\n```"
+}
+
+// DetectAndFormat detects the language of text and formats it locally. It
+// returns false when text is not code, or not in a language that can be
+// formatted, or when the code does not parse.
+func DetectAndFormat(text string) (lang, formatted string, ok bool) {
+	lang = Detect(text)
+	if !CanFormat(lang) {
+		return lang, "", false
+	}
+	formatted, err := Format(lang, text)
+	if err != nil {
+		return lang, "", false
+	}
+	return lang, Fence(lang, formatted), true
+}
+
+// formatGo 用 gofmt 格式化, go/format 也接受声明或语句列表这样不完整的代码
+func formatGo(code string) (string, error) {
+	out, err := format.Source([]byte(strings.TrimSpace(code)))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func formatJSON(code string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(strings.TrimSpace(code)), "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,221 @@
+package codefmt
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var sqlKeywords = map[string]bool{}
+
+var sqlFunctions = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true, "COALESCE": true, "CAST": true,
+}
+
+func init() {
+	for _, k := range strings.Fields(`SELECT DISTINCT FROM WHERE AND OR NOT IN IS NULL LIKE BETWEEN
+		EXISTS AS ON JOIN LEFT RIGHT INNER OUTER FULL CROSS GROUP ORDER BY HAVING LIMIT OFFSET
+		UNION ALL INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX VIEW ALTER DROP ADD
+		PRIMARY KEY FOREIGN REFERENCES DEFAULT UNIQUE CASE WHEN THEN ELSE END ASC DESC WITH
+		RETURNING IF COUNT SUM AVG MIN MAX COALESCE CAST TRUE FALSE INTEGER INT BIGINT VARCHAR
+		TEXT BOOLEAN TIMESTAMP DATE AUTO_INCREMENT CONSTRAINT`) {
+		sqlKeywords[k] = true
+	}
+}
+
+// sqlClauses 在新的一行开始; 多个单词的子句按最长匹配
+var sqlClauses = [][]string{
+	{"SELECT"}, {"FROM"}, {"WHERE"}, {"GROUP", "BY"}, {"ORDER", "BY"}, {"HAVING"}, {"LIMIT"},
+	{"OFFSET"}, {"UNION", "ALL"}, {"UNION"}, {"VALUES"}, {"SET"}, {"INSERT", "INTO"}, {"UPDATE"},
+	{"DELETE", "FROM"}, {"RETURNING"}, {"WITH"}, {"JOIN"},
+	{"LEFT", "JOIN"}, {"RIGHT", "JOIN"}, {"INNER", "JOIN"}, {"CROSS", "JOIN"}, {"FULL", "JOIN"},
+	{"LEFT", "OUTER", "JOIN"}, {"RIGHT", "OUTER", "JOIN"}, {"FULL", "OUTER", "JOIN"},
+}
+
+type sqlToken struct {
+	text string
+	word bool // 标识符或关键字
+}
+
+var errUnterminated = errors.New("unterminated string or comment")
+
+func tokenizeSQL(src string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	r := []rune(src)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < len(r) && r[i+1] == '-':
+			j := i
+			for j < len(r) && r[j] != '\n' {
+				j++
+			}
+			tokens = append(tokens, sqlToken{text: string(r[i:j])})
+			i = j
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			end := strings.Index(string(r[i+2:]), "*/")
+			if end < 0 {
+				return nil, errUnterminated
+			}
+			n := len([]rune(string(r[i+2:])[:end]))
+			tokens = append(tokens, sqlToken{text: string(r[i : i+2+n+2])})
+			i += n + 4
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(r); j++ {
+				if r[j] == c {
+					// '' 是字符串中转义的引号
+					if j+1 < len(r) && r[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(r) {
+				return nil, errUnterminated
+			}
+			tokens = append(tokens, sqlToken{text: string(r[i : j+1]), word: c != '\''})
+			i = j + 1
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '@' || c == '$':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '$' || r[j] == '@' || r[j] == '.' && j+1 < len(r) && unicode.IsDigit(r[j+1])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{text: string(r[i:j]), word: true})
+			i = j
+		default:
+			op := string(c)
+			if i+1 < len(r) {
+				if two := string(r[i : i+2]); two == "<=" || two == ">=" || two == "<>" || two == "!=" || two == "::" || two == "||" {
+					op = two
+				}
+			}
+			tokens = append(tokens, sqlToken{text: op})
+			i += len([]rune(op))
+		}
+	}
+	return tokens, nil
+}
+
+// FormatSQL formats SQL statements: keywords are upper-cased, every clause
+// starts a new line, conditions joined by AND/OR are indented and
+// subqueries are indented one level deeper.
+func FormatSQL(src string) (string, error) {
+	tokens, err := tokenizeSQL(src)
+	if err != nil {
+		return "", err
+	}
+	for i := range tokens {
+		if up := strings.ToUpper(tokens[i].text); tokens[i].word && sqlKeywords[up] {
+			tokens[i].text = up
+		}
+	}
+
+	var b strings.Builder
+	depth := 0
+	var subquery []bool // 每层括号是否是子查询
+	between := false
+	newline := func(extra int) {
+		b.WriteString("\n")
+		b.WriteString(strings.Repeat("  ", depth+extra))
+	}
+	space := func() {
+		s := b.String()
+		if s == "" || strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, "(") || strings.HasSuffix(s, ".") {
+			return
+		}
+		b.WriteString(" ")
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if n := matchClause(tokens[i:]); n > 0 {
+			if b.Len() > 0 {
+				newline(0)
+			}
+			for k := 0; k < n; k++ {
+				if k > 0 {
+					b.WriteString(" ")
+				}
+				b.WriteString(tokens[i+k].text)
+			}
+			i += n - 1
+			continue
+		}
+		switch t.text {
+		case "(":
+			isSub := i+1 < len(tokens) && (tokens[i+1].text == "SELECT" || tokens[i+1].text == "WITH")
+			// 函数调用的括号前没有空格
+			if i > 0 && !(tokens[i-1].word && (!sqlKeywords[tokens[i-1].text] || sqlFunctions[tokens[i-1].text])) {
+				space()
+			}
+			b.WriteString("(")
+			subquery = append(subquery, isSub)
+			if isSub {
+				depth++
+			}
+		case ")":
+			if n := len(subquery); n > 0 {
+				if subquery[n-1] {
+					depth--
+					newline(0)
+				}
+				subquery = subquery[:n-1]
+			}
+			b.WriteString(")")
+		case ",", ".":
+			b.WriteString(t.text)
+			if t.text == "," {
+				b.WriteString(" ")
+			}
+		case ";":
+			b.WriteString(";")
+			if i+1 < len(tokens) {
+				b.WriteString("\n")
+			}
+		case "AND", "OR":
+			if t.text == "AND" && between {
+				between = false
+				space()
+				b.WriteString(t.text)
+				continue
+			}
+			newline(1)
+			b.WriteString(t.text)
+		default:
+			if t.text == "BETWEEN" {
+				between = true
+			}
+			space()
+			b.WriteString(t.text)
+			if strings.HasPrefix(t.text, "--") {
+				newline(0)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String()) + "\n", nil
+}
+
+// matchClause 返回从 tokens 开始的子句关键字的单词数, 不是子句时返回 0
+func matchClause(tokens []sqlToken) int {
+	best := 0
+	for _, clause := range sqlClauses {
+		if len(clause) > len(tokens) || len(clause) <= best {
+			continue
+		}
+		match := true
+		for k, w := range clause {
+			if !tokens[k].word || tokens[k].text != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			best = len(clause)
+		}
+	}
+	return best
+}
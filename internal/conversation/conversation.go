@@ -0,0 +1,175 @@
+// Package conversation keeps follow-up questions on a result. The history
+// is stored in the database and sent to the model on every question,
+// capped by an estimated token budget.
+package conversation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/models"
+	"github.com/zzhirong/contextdict/internal/summarize"
+)
+
+var (
+	ErrTooLong         = errors.New("question is too long")
+	ErrTextTooLong     = errors.New("text is too long for a conversation")
+	ErrTooManyMessages = errors.New("conversation has too many messages, start a new one")
+)
+
+// ChatFunc sends the history to the model and returns the answer.
+type ChatFunc func(ctx context.Context, messages []ai.Message) (string, error)
+
+type Manager struct {
+	repo database.ConversationRepository
+	cfg  config.ConversationConfig
+	wg   sync.WaitGroup
+}
+
+func New(repo database.ConversationRepository, cfg config.ConversationConfig) *Manager {
+	return &Manager{repo: repo, cfg: cfg}
+}
+
+// Create stores a conversation starting with text and its answer. The
+// selected part, if any, comes first like in the translate prompt. Both
+// are sent with every question, so they must fit in MaxHistoryTokens.
+func (m *Manager) Create(ctx context.Context, role, text, selected, answer string) (*models.Conversation, error) {
+	if selected != "" {
+		text = selected + "\n\n" + text
+	}
+	if m.cfg.MaxTextLen > 0 && (len([]rune(text)) > m.cfg.MaxTextLen || len([]rune(answer)) > m.cfg.MaxTextLen) {
+		return nil, fmt.Errorf("%w: text and result must be at most %d characters", ErrTextTooLong, m.cfg.MaxTextLen)
+	}
+	if tokens := summarize.EstimateTokens(text) + summarize.EstimateTokens(answer); m.cfg.MaxHistoryTokens > 0 && tokens > m.cfg.MaxHistoryTokens {
+		return nil, fmt.Errorf("%w: about %d tokens, limit is %d", ErrTextTooLong, tokens, m.cfg.MaxHistoryTokens)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	conv := &models.Conversation{
+		Token:    hex.EncodeToString(b),
+		Role:     role,
+		Selected: selected,
+		Messages: []models.ConversationMessage{
+			{Role: ai.RoleUser, Content: text},
+			{Role: ai.RoleAssistant, Content: answer},
+		},
+	}
+	if err := m.repo.CreateConversation(ctx, conv); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// Get returns the conversation with token, or nil if it does not exist.
+func (m *Manager) Get(ctx context.Context, token string) (*models.Conversation, error) {
+	return m.repo.GetConversation(ctx, token)
+}
+
+// Delete removes conv and its messages.
+func (m *Manager) Delete(ctx context.Context, conv *models.Conversation) error {
+	return m.repo.DeleteConversation(ctx, conv.ID)
+}
+
+// Ask sends question with the history of conv to chat and stores both the
+// question and the answer, which is returned.
+func (m *Manager) Ask(ctx context.Context, conv *models.Conversation, question string, chat ChatFunc) (*models.ConversationMessage, error) {
+	if m.cfg.MaxQuestionLen > 0 && len([]rune(question)) > m.cfg.MaxQuestionLen {
+		return nil, fmt.Errorf("%w: at most %d characters", ErrTooLong, m.cfg.MaxQuestionLen)
+	}
+	if m.cfg.MaxMessages > 0 && len(conv.Messages)+2 > m.cfg.MaxMessages {
+		return nil, ErrTooManyMessages
+	}
+	asked := append(conv.Messages[:len(conv.Messages):len(conv.Messages)],
+		models.ConversationMessage{Role: ai.RoleUser, Content: question})
+	answer, err := chat(ctx, History(asked, m.cfg.MaxHistoryTokens))
+	if err != nil {
+		return nil, err
+	}
+	added := []models.ConversationMessage{
+		{Role: ai.RoleUser, Content: question},
+		{Role: ai.RoleAssistant, Content: answer},
+	}
+	if err := m.repo.AddConversationMessages(ctx, conv.ID, added); err != nil {
+		return nil, err
+	}
+	conv.Messages = append(conv.Messages, added...)
+	return &conv.Messages[len(conv.Messages)-1], nil
+}
+
+// History returns the messages sent to the model. The original text and
+// its answer are always kept; of the rest, the latest messages that fit in
+// maxTokens are kept, starting with a question. maxTokens <= 0 keeps all.
+func History(messages []models.ConversationMessage, maxTokens int) []ai.Message {
+	pinned := min(2, len(messages))
+	budget := maxTokens
+	for _, m := range messages[:pinned] {
+		budget -= summarize.EstimateTokens(m.Content)
+	}
+	start := len(messages)
+	for start > pinned {
+		cost := summarize.EstimateTokens(messages[start-1].Content)
+		if maxTokens > 0 && cost > budget && start < len(messages) {
+			break
+		}
+		budget -= cost
+		start--
+	}
+	// 不能从回答开始, 否则模型看不到对应的问题
+	for start < len(messages)-1 && messages[start].Role != ai.RoleUser {
+		start++
+	}
+
+	history := make([]ai.Message, 0, pinned+len(messages)-start)
+	for _, m := range messages[:pinned] {
+		history = append(history, ai.Message{Role: m.Role, Content: m.Content})
+	}
+	for _, m := range messages[start:] {
+		history = append(history, ai.Message{Role: m.Role, Content: m.Content})
+	}
+	return history
+}
+
+// Start purges conversations without new messages for RetentionDays until
+// ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) {
+	if m.cfg.RetentionDays <= 0 {
+		return
+	}
+	m.wg.Add(1)
+	go m.cleanup(ctx)
+}
+
+// Wait blocks until the cleanup stopped after the context was cancelled.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) cleanup(ctx context.Context) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		before := time.Now().AddDate(0, 0, -m.cfg.RetentionDays)
+		if n, err := m.repo.PurgeConversations(ctx, before); err != nil {
+			log.Printf("Error purging old conversations: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d old conversations", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
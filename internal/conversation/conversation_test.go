@@ -0,0 +1,99 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// memoryRepo 是内存中的 ConversationRepository
+type memoryRepo struct {
+	convs map[string]*models.Conversation
+}
+
+func (r *memoryRepo) CreateConversation(ctx context.Context, conv *models.Conversation) error {
+	conv.ID = uint(len(r.convs) + 1)
+	r.convs[conv.Token] = conv
+	return nil
+}
+
+func (r *memoryRepo) GetConversation(ctx context.Context, token string) (*models.Conversation, error) {
+	return r.convs[token], nil
+}
+
+func (r *memoryRepo) AddConversationMessages(ctx context.Context, id uint, messages []models.ConversationMessage) error {
+	return nil
+}
+
+func (r *memoryRepo) DeleteConversation(ctx context.Context, id uint) error { return nil }
+
+func (r *memoryRepo) PurgeConversations(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func message(role string, tokens int) models.ConversationMessage {
+	return models.ConversationMessage{Role: role, Content: strings.Repeat("abcd", tokens)}
+}
+
+func TestHistory_KeepsOriginalAndLatest(t *testing.T) {
+	msgs := []models.ConversationMessage{
+		message(ai.RoleUser, 100), message(ai.RoleAssistant, 100), // 原文和回答
+		message(ai.RoleUser, 10), message(ai.RoleAssistant, 50),
+		message(ai.RoleUser, 10), message(ai.RoleAssistant, 50),
+		message(ai.RoleUser, 10),
+	}
+	assert.Len(t, History(msgs, 0), 7)
+
+	// 原文和回答占 200, 剩下的只够最后一轮问答和新问题
+	history := History(msgs, 280)
+	require.Len(t, history, 5)
+	assert.Equal(t, msgs[0].Content, history[0].Content)
+	assert.Equal(t, msgs[4].Content, history[2].Content)
+	assert.Equal(t, ai.RoleUser, history[4].Role)
+
+	// 只放得下回答时, 回答也被丢弃, 不能以回答开始
+	history = History(msgs, 265)
+	require.Len(t, history, 3)
+	assert.Equal(t, ai.RoleUser, history[2].Role)
+
+	// 新问题总是保留
+	assert.Len(t, History(msgs, 1), 3)
+}
+
+func TestAsk(t *testing.T) {
+	m := New(&memoryRepo{convs: map[string]*models.Conversation{}}, config.ConversationConfig{
+		MaxHistoryTokens: 1000, MaxQuestionLen: 20, MaxMessages: 4,
+	})
+	ctx := context.Background()
+	conv, err := m.Create(ctx, "analyze", "Having finished, he left.", "", "分词短语作状语")
+	require.NoError(t, err)
+	assert.Len(t, conv.Token, 32)
+
+	var sent []ai.Message
+	answer, err := m.Ask(ctx, conv, "为什么用 having?", func(ctx context.Context, messages []ai.Message) (string, error) {
+		sent = messages
+		return "表示动作先于主句完成", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "表示动作先于主句完成", answer.Content)
+	assert.Equal(t, []ai.Message{
+		{Role: ai.RoleUser, Content: "Having finished, he left."},
+		{Role: ai.RoleAssistant, Content: "分词短语作状语"},
+		{Role: ai.RoleUser, Content: "为什么用 having?"},
+	}, sent)
+	assert.Len(t, conv.Messages, 4)
+
+	_, err = m.Ask(ctx, conv, "还有吗?", nil)
+	assert.True(t, errors.Is(err, ErrTooManyMessages))
+	_, err = m.Ask(ctx, conv, strings.Repeat("长", 21), nil)
+	assert.True(t, errors.Is(err, ErrTooLong))
+}
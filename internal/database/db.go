@@ -2,29 +2,86 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/zzhirong/contextdict/config"          // Adjust import path if needed
 	"github.com/zzhirong/contextdict/internal/models" // Adjust import path
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Repository defines the interface for database operations.
 type Repository interface {
 	FindTranslation(ctx context.Context, text, selected string) (*models.TranslationResponse, error)
 	CreateTranslation(ctx context.Context, record *models.TranslationResponse) error
+	// 以下供管理接口使用
+	SearchTranslations(ctx context.Context, filter TranslationFilter) ([]models.TranslationResponse, int64, error)
+	GetTranslation(ctx context.Context, id uint) (*models.TranslationResponse, error)
+	DeleteTranslation(ctx context.Context, id uint) error
+	PurgeTranslations(ctx context.Context, filter TranslationFilter) (int64, error)
+	// AddCandidate 为已有的缓存条目增加一个新版本的结果
+	AddCandidate(ctx context.Context, record *models.TranslationResponse) error
+	PinCandidate(ctx context.Context, candidateID uint, pinned bool) error
+	// DeleteCandidate 删除候选结果, 删除最后一个时同时删除缓存条目
+	DeleteCandidate(ctx context.Context, candidateID uint) error
+	AddFeedback(ctx context.Context, feedback *models.Feedback) error
+	ListFeedback(ctx context.Context, translationID uint) ([]models.Feedback, error)
+	PoorlyRatedCandidates(ctx context.Context, limit int) ([]models.TranslationCandidate, error)
 	Close() error
 }
 
+// ErrEmptyFilter is returned by PurgeTranslations when no condition is set,
+// to avoid wiping the whole cache by accident.
+var ErrEmptyFilter = errors.New("purge filter must have at least one condition")
+
+// ErrNotFound is returned when the referenced translation or candidate does not exist.
+var ErrNotFound = errors.New("translation not found")
+
+// ErrLeaseLost is returned by RenewBatchJob when the job is no longer held
+// by the owner, for example after it was paused or its lease expired.
+var ErrLeaseLost = errors.New("batch job is no longer held by this instance")
+
+// TranslationFilter selects cached translations.
+// Pattern is a SQL LIKE pattern matched against Text and Selected;
+// zero values are ignored.
+type TranslationFilter struct {
+	Pattern string
+	Before  time.Time
+	After   time.Time
+	Limit   int
+	Offset  int
+}
+
+func (f TranslationFilter) empty() bool {
+	return f.Pattern == "" && f.Before.IsZero() && f.After.IsZero()
+}
+
+func (f TranslationFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Pattern != "" {
+		db = db.Where("(text LIKE ? OR selected LIKE ?)", f.Pattern, f.Pattern)
+	}
+	if !f.Before.IsZero() {
+		db = db.Where("created_at < ?", f.Before)
+	}
+	if !f.After.IsZero() {
+		db = db.Where("created_at >= ?", f.After)
+	}
+	return db
+}
+
 // GormRepository implements the Repository interface using GORM.
 type GormRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	policy string
 }
 
 // NewRepository creates a new database connection and repository instance.
-func NewRepository(cfg config.DatabaseConfig) (Repository, error) {
+func NewRepository(cfg config.DatabaseConfig) (*GormRepository, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		cfg.User,
 		cfg.Password,
@@ -41,7 +98,7 @@ func NewRepository(cfg config.DatabaseConfig) (Repository, error) {
 	log.Println("Database connection established.")
 
 	// Auto-migrate the schema
-	if err = db.AutoMigrate(&models.TranslationResponse{}); err != nil {
+	if err = migrate(db); err != nil {
 		// Attempt to close DB if migration fails
 		sqlDB, _ := db.DB()
 		if sqlDB != nil {
@@ -51,15 +108,75 @@ func NewRepository(cfg config.DatabaseConfig) (Repository, error) {
 	}
 	log.Println("Database schema migrated.")
 
-	return &GormRepository{db: db}, nil
+	return &GormRepository{db: db, policy: cfg.SelectionPolicy}, nil
+}
+
+func migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&models.TranslationResponse{},
+		&models.TranslationCandidate{},
+		&models.Feedback{},
+		&models.BatchJob{},
+		&models.BatchItem{},
+		&models.Job{},
+		&models.DictEntry{},
+		&models.WordSense{},
+		&models.Glossary{},
+		&models.GlossaryTerm{},
+		&models.Conversation{},
+		&models.ConversationMessage{},
+		&models.Audio{},
+		&models.ImageText{},
+	)
+	if err != nil {
+		return err
+	}
+	// 旧版本把结果和来源信息直接存在 translation_responses 中, 迁移为第一个候选结果后删除这些列
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.TranslationResponse{}, "translation") {
+		return nil
+	}
+	columns := []string{"translation"}
+	for _, column := range []string{"prompt", "prompt_hash", "model", "params"} {
+		// 更早的版本没有其中一些列
+		if migrator.HasColumn(&models.TranslationResponse{}, column) {
+			columns = append(columns, column)
+		}
+	}
+	err = db.Exec(fmt.Sprintf(`INSERT INTO translation_candidates (created_at, updated_at, translation_id, %s)
+		SELECT t.created_at, t.updated_at, t.id, t.%s FROM translation_responses t
+		WHERE t.translation <> '' AND NOT EXISTS (
+			SELECT 1 FROM translation_candidates c WHERE c.translation_id = t.id)`,
+		strings.Join(columns, ", "), strings.Join(columns, ", t."))).Error
+	if err != nil {
+		return fmt.Errorf("failed to migrate cached translations to candidates: %w", err)
+	}
+	log.Printf("Migrated cached translations to candidates (%s).", strings.Join(columns, ", "))
+	// 最后删除 translation, 中途失败时下次启动会重新执行迁移
+	for i := len(columns) - 1; i >= 0; i-- {
+		column := columns[i]
+		if err := migrator.DropColumn(&models.TranslationResponse{}, column); err != nil {
+			return fmt.Errorf("failed to drop column %s of translation_responses: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// selectCandidate fills the result fields of record from its candidates.
+func (r *GormRepository) selectCandidate(record *models.TranslationResponse) {
+	if c := models.SelectCandidate(record.Candidates, r.policy); c != nil {
+		record.Select(c)
+	}
 }
 
 // FindTranslation looks for an existing translation in the cache.
+// The returned record carries the candidate chosen by the selection policy.
 func (r *GormRepository) FindTranslation(ctx context.Context, text, selected string) (*models.TranslationResponse, error) {
 	var result models.TranslationResponse
 	result.Text = text
 	result.Selected = selected
 	err := r.db.WithContext(ctx).
+		Preload("Candidates").
 		Where(&result).
 		First(&result).Error
 
@@ -70,24 +187,295 @@ func (r *GormRepository) FindTranslation(ctx context.Context, text, selected str
 		// For other errors, return the error.
 		return nil, fmt.Errorf("error finding translation in DB: %w", err)
 	}
+	if len(result.Candidates) == 0 {
+		return nil, nil // 没有候选结果, 视为未命中, CreateTranslation 会复用该条目
+	}
+	r.selectCandidate(&result)
 	return &result, nil
 }
 
-// CreateTranslation saves a new translation record to the cache.
+// CreateTranslation saves a new cache entry with record's result as the
+// first candidate. If an entry for the same text already exists (for
+// example one left without candidates), the result is added to it instead.
 func (r *GormRepository) CreateTranslation(ctx context.Context, record *models.TranslationResponse) error {
-	// Use .WithContext for potential cancellation/timeouts
 	// Ensure we don't try to insert a record with an existing primary key if it came from FindTranslation
-	if record.ID != 0 {
-		record.ID = 0 // Reset ID to ensure GORM creates a new record
+	record.ID = 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.TranslationResponse
+		err := tx.Where("text = ? AND selected = ?", record.Text, record.Selected).First(&existing).Error
+		if err == nil {
+			record.ID, record.CreatedAt = existing.ID, existing.CreatedAt
+			candidate := record.Candidate()
+			if err := tx.Create(&candidate).Error; err != nil {
+				return err
+			}
+			record.CandidateID = candidate.ID
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		record.Candidates = []models.TranslationCandidate{record.Candidate()}
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		record.CandidateID = record.Candidates[0].ID
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error creating translation in DB: %w", err)
+	}
+	return nil
+}
+
+// AddCandidate stores record's result as a new candidate of the existing
+// entry record.ID.
+func (r *GormRepository) AddCandidate(ctx context.Context, record *models.TranslationResponse) error {
+	candidate := record.Candidate()
+	err := r.db.WithContext(ctx).Create(&candidate).Error
+	if err != nil {
+		return fmt.Errorf("error creating translation candidate in DB: %w", err)
 	}
+	record.CandidateID = candidate.ID
+	return nil
+}
+
+// PinCandidate pins or unpins a candidate. Pinning unpins the other
+// candidates of the same entry.
+func (r *GormRepository) PinCandidate(ctx context.Context, candidateID uint, pinned bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var candidate models.TranslationCandidate
+		if err := tx.First(&candidate, candidateID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("error loading candidate: %w", err)
+		}
+		if pinned {
+			err := tx.Model(&models.TranslationCandidate{}).
+				Where("translation_id = ? AND id <> ?", candidate.TranslationID, candidate.ID).
+				Update("pinned", false).Error
+			if err != nil {
+				return fmt.Errorf("error unpinning candidates: %w", err)
+			}
+		}
+		if err := tx.Model(&candidate).Update("pinned", pinned).Error; err != nil {
+			return fmt.Errorf("error pinning candidate: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteCandidate permanently removes a candidate and its feedback. When
+// it was the last candidate, the entry is removed too, so that the next
+// request generates a fresh result instead of finding an empty entry.
+func (r *GormRepository) DeleteCandidate(ctx context.Context, candidateID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var candidate models.TranslationCandidate
+		if err := tx.First(&candidate, candidateID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("error loading candidate: %w", err)
+		}
+		if err := tx.Unscoped().Where("candidate_id = ?", candidateID).Delete(&models.Feedback{}).Error; err != nil {
+			return fmt.Errorf("error deleting feedback from DB: %w", err)
+		}
+		if err := tx.Unscoped().Delete(&models.TranslationCandidate{}, candidateID).Error; err != nil {
+			return fmt.Errorf("error deleting candidate from DB: %w", err)
+		}
+		var remaining int64
+		err := tx.Model(&models.TranslationCandidate{}).Where("translation_id = ?", candidate.TranslationID).Count(&remaining).Error
+		if err != nil {
+			return fmt.Errorf("error counting candidates in DB: %w", err)
+		}
+		if remaining == 0 {
+			if err := deleteEntries(tx, []uint{candidate.TranslationID}); err != nil {
+				return fmt.Errorf("error deleting empty translation from DB: %w", err)
+			}
+		}
+		return nil
+	})
+}
 
-	err := r.db.WithContext(ctx).Create(record).Error
+// SearchTranslations returns one page of matching translations, newest first,
+// together with the total number of matches.
+func (r *GormRepository) SearchTranslations(ctx context.Context, filter TranslationFilter) ([]models.TranslationResponse, int64, error) {
+	var total int64
+	query := filter.apply(r.db.WithContext(ctx).Model(&models.TranslationResponse{}))
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("error counting translations in DB: %w", err)
+	}
+
+	var records []models.TranslationResponse
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	err := query.Preload("Candidates").Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&records).Error
 	if err != nil {
-		return fmt.Errorf("error creating translation in DB: %w", err)
+		return nil, 0, fmt.Errorf("error searching translations in DB: %w", err)
+	}
+	for i := range records {
+		r.selectCandidate(&records[i])
+	}
+	return records, total, nil
+}
+
+// GetTranslation returns the translation with id and all its candidates,
+// or nil if it does not exist.
+func (r *GormRepository) GetTranslation(ctx context.Context, id uint) (*models.TranslationResponse, error) {
+	var record models.TranslationResponse
+	err := r.db.WithContext(ctx).Preload("Candidates").First(&record, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting translation from DB: %w", err)
+	}
+	r.selectCandidate(&record)
+	return &record, nil
+}
+
+// DeleteTranslation permanently removes a cached translation with all its
+// candidates and feedback.
+func (r *GormRepository) DeleteTranslation(ctx context.Context, id uint) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteEntries(tx, []uint{id})
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting translation from DB: %w", err)
+	}
+	return nil
+}
+
+// PurgeTranslations permanently removes all matching translations and
+// returns how many were removed. Limit and Offset are ignored.
+func (r *GormRepository) PurgeTranslations(ctx context.Context, filter TranslationFilter) (int64, error) {
+	if filter.empty() {
+		return 0, ErrEmptyFilter
+	}
+	var deleted int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := filter.apply(tx.Model(&models.TranslationResponse{})).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		deleted = int64(len(ids))
+		return deleteEntries(tx, ids)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error purging translations from DB: %w", err)
+	}
+	return deleted, nil
+}
+
+func deleteEntries(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx = tx.Unscoped()
+	if err := tx.Where("translation_id IN ?", ids).Delete(&models.Feedback{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("translation_id IN ?", ids).Delete(&models.TranslationCandidate{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.TranslationResponse{}, ids).Error
+}
+
+// AddFeedback stores a rating and updates the vote counters of the rated
+// candidate in the same transaction. A voter who already rated the
+// candidate replaces the earlier rating instead of voting again.
+func (r *GormRepository) AddFeedback(ctx context.Context, feedback *models.Feedback) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var candidate models.TranslationCandidate
+		if err := tx.First(&candidate, feedback.CandidateID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("error loading rated candidate: %w", err)
+		}
+		feedback.TranslationID = candidate.TranslationID
+		if feedback.Voter != "" {
+			var previous models.Feedback
+			res := tx.Where("candidate_id = ? AND voter = ?", feedback.CandidateID, feedback.Voter).Limit(1).Find(&previous)
+			if res.Error != nil {
+				return fmt.Errorf("error loading previous feedback in DB: %w", res.Error)
+			}
+			if res.RowsAffected > 0 {
+				if previous.Rating != feedback.Rating {
+					if err := addVote(tx, &candidate, previous.Rating, -1); err != nil {
+						return err
+					}
+					if err := addVote(tx, &candidate, feedback.Rating, 1); err != nil {
+						return err
+					}
+				}
+				feedback.ID, feedback.CreatedAt = previous.ID, previous.CreatedAt
+				err := tx.Model(&previous).Select("Rating", "Comment").Updates(feedback).Error
+				if err != nil {
+					return fmt.Errorf("error updating feedback in DB: %w", err)
+				}
+				return nil
+			}
+		}
+		if err := addVote(tx, &candidate, feedback.Rating, 1); err != nil {
+			return err
+		}
+		if err := tx.Create(feedback).Error; err != nil {
+			return fmt.Errorf("error creating feedback in DB: %w", err)
+		}
+		return nil
+	})
+}
+
+// addVote adds delta to the upvotes or downvotes of candidate, depending on rating.
+func addVote(tx *gorm.DB, candidate *models.TranslationCandidate, rating, delta int) error {
+	column := "upvotes"
+	if rating < 0 {
+		column = "downvotes"
+	}
+	err := tx.Model(candidate).UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+	if err != nil {
+		return fmt.Errorf("error updating votes in DB: %w", err)
 	}
 	return nil
 }
 
+// ListFeedback returns the feedback on all candidates of a translation,
+// newest first.
+func (r *GormRepository) ListFeedback(ctx context.Context, translationID uint) ([]models.Feedback, error) {
+	var feedback []models.Feedback
+	err := r.db.WithContext(ctx).
+		Where("translation_id = ?", translationID).
+		Order("id DESC").
+		Find(&feedback).Error
+	if err != nil {
+		return nil, fmt.Errorf("error listing feedback from DB: %w", err)
+	}
+	return feedback, nil
+}
+
+// PoorlyRatedCandidates returns candidates with more down- than upvotes,
+// worst first, together with their cache entry.
+func (r *GormRepository) PoorlyRatedCandidates(ctx context.Context, limit int) ([]models.TranslationCandidate, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var candidates []models.TranslationCandidate
+	err := r.db.WithContext(ctx).
+		Preload("Entry").
+		Where("downvotes > upvotes").
+		Order("upvotes - downvotes ASC, id DESC").
+		Limit(limit).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("error listing poorly rated candidates from DB: %w", err)
+	}
+	return candidates, nil
+}
+
 // Close closes the underlying database connection.
 func (r *GormRepository) Close() error {
 	sqlDB, err := r.db.DB()
@@ -97,3 +485,528 @@ func (r *GormRepository) Close() error {
 	log.Println("Closing database connection.")
 	return sqlDB.Close()
 }
+
+// BatchRepository stores batch pre-translation jobs.
+type BatchRepository interface {
+	CreateBatchJob(ctx context.Context, job *models.BatchJob, items []models.BatchItem) error
+	GetBatchJob(ctx context.Context, id uint) (*models.BatchJob, error)
+	ListBatchJobs(ctx context.Context, limit int) ([]models.BatchJob, error)
+	// ClaimBatchJob 领取一个 pending 或租约过期的 running 任务, 没有任务时返回 nil
+	ClaimBatchJob(ctx context.Context, owner string, lease time.Duration) (*models.BatchJob, error)
+	// RenewBatchJob 延长 owner 持有的任务的租约, 不再持有时返回 ErrLeaseLost
+	RenewBatchJob(ctx context.Context, id uint, owner string, lease time.Duration) error
+	SetBatchJobStatus(ctx context.Context, id uint, status, errMsg string) error
+	PendingBatchItems(ctx context.Context, jobID uint, limit int) ([]models.BatchItem, error)
+	// FinishBatchItem 更新任务项的状态, 并累加任务的完成或失败计数
+	FinishBatchItem(ctx context.Context, item *models.BatchItem) error
+}
+
+// CreateBatchJob saves a job with all its items.
+func (r *GormRepository) CreateBatchJob(ctx context.Context, job *models.BatchJob, items []models.BatchItem) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		job.Total = len(items)
+		if err := tx.Create(job).Error; err != nil {
+			return fmt.Errorf("error creating batch job in DB: %w", err)
+		}
+		for i := range items {
+			items[i].JobID = job.ID
+			items[i].Status = models.StatusPending
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(items, 200).Error; err != nil {
+			return fmt.Errorf("error creating batch items in DB: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetBatchJob returns the job with id, or nil if it does not exist.
+func (r *GormRepository) GetBatchJob(ctx context.Context, id uint) (*models.BatchJob, error) {
+	var job models.BatchJob
+	err := r.db.WithContext(ctx).First(&job, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting batch job from DB: %w", err)
+	}
+	return &job, nil
+}
+
+// ListBatchJobs returns the most recent jobs, newest first.
+func (r *GormRepository) ListBatchJobs(ctx context.Context, limit int) ([]models.BatchJob, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var jobs []models.BatchJob
+	err := r.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&jobs).Error
+	if err != nil {
+		return nil, fmt.Errorf("error listing batch jobs from DB: %w", err)
+	}
+	return jobs, nil
+}
+
+// ClaimBatchJob marks the oldest claimable job as running by owner for
+// lease. Like ClaimJob, rows locked by other instances are skipped.
+func (r *GormRepository) ClaimBatchJob(ctx context.Context, owner string, lease time.Duration) (*models.BatchJob, error) {
+	var claimed *models.BatchJob
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var job models.BatchJob
+		now := time.Now()
+		// 升级前运行的任务没有租约, 可以直接领取
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND (lease_until IS NULL OR lease_until < ?))",
+				models.StatusPending, models.StatusRunning, now).
+			Order("id").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		until := now.Add(lease)
+		job.Status, job.Owner, job.LeaseUntil = models.StatusRunning, owner, &until
+		if err := tx.Select("Status", "Owner", "LeaseUntil").Save(&job).Error; err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error claiming batch job from DB: %w", err)
+	}
+	return claimed, nil
+}
+
+func (r *GormRepository) RenewBatchJob(ctx context.Context, id uint, owner string, lease time.Duration) error {
+	result := r.db.WithContext(ctx).Model(&models.BatchJob{}).
+		Where("id = ? AND owner = ? AND status = ?", id, owner, models.StatusRunning).
+		Update("lease_until", time.Now().Add(lease))
+	if result.Error != nil {
+		return fmt.Errorf("error renewing batch job lease in DB: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *GormRepository) SetBatchJobStatus(ctx context.Context, id uint, status, errMsg string) error {
+	err := r.db.WithContext(ctx).Model(&models.BatchJob{}).Where("id = ?", id).
+		Updates(map[string]any{"status": status, "error": errMsg}).Error
+	if err != nil {
+		return fmt.Errorf("error updating batch job status in DB: %w", err)
+	}
+	return nil
+}
+
+// PendingBatchItems returns up to limit items of the job that still need work.
+func (r *GormRepository) PendingBatchItems(ctx context.Context, jobID uint, limit int) ([]models.BatchItem, error) {
+	var items []models.BatchItem
+	err := r.db.WithContext(ctx).
+		Where("job_id = ? AND status = ?", jobID, models.StatusPending).
+		Order("id").
+		Limit(limit).
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("error listing batch items from DB: %w", err)
+	}
+	return items, nil
+}
+
+func (r *GormRepository) FinishBatchItem(ctx context.Context, item *models.BatchItem) error {
+	counter := "done"
+	if item.Status == models.StatusFailed {
+		counter = "failed"
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(item).Updates(map[string]any{"status": item.Status, "error": item.Error}).Error
+		if err != nil {
+			return fmt.Errorf("error updating batch item in DB: %w", err)
+		}
+		err = tx.Model(&models.BatchJob{}).Where("id = ?", item.JobID).
+			UpdateColumn(counter, gorm.Expr(counter+" + 1")).Error
+		if err != nil {
+			return fmt.Errorf("error updating batch job progress in DB: %w", err)
+		}
+		return nil
+	})
+}
+
+// JobRepository is the persistent queue of asynchronous jobs.
+type JobRepository interface {
+	CreateJob(ctx context.Context, job *models.Job) error
+	GetJob(ctx context.Context, token string) (*models.Job, error)
+	// ClaimJob 领取一个等待中或租约过期的任务, 没有任务时返回 nil
+	ClaimJob(ctx context.Context, lease time.Duration) (*models.Job, error)
+	SaveJob(ctx context.Context, job *models.Job) error
+	PurgeJobs(ctx context.Context, before time.Time) (int64, error)
+}
+
+func (r *GormRepository) CreateJob(ctx context.Context, job *models.Job) error {
+	if err := r.db.WithContext(ctx).Create(job).Error; err != nil {
+		return fmt.Errorf("error creating job in DB: %w", err)
+	}
+	return nil
+}
+
+// GetJob returns the job with token, or nil if it does not exist.
+func (r *GormRepository) GetJob(ctx context.Context, token string) (*models.Job, error) {
+	var job models.Job
+	err := r.db.WithContext(ctx).Where("token = ?", token).First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting job from DB: %w", err)
+	}
+	return &job, nil
+}
+
+// ClaimJob marks the oldest claimable job as running for lease. Rows locked
+// by other instances are skipped, so several replicas can share the queue.
+func (r *GormRepository) ClaimJob(ctx context.Context, lease time.Duration) (*models.Job, error) {
+	var claimed *models.Job
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var job models.Job
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND (lease_until IS NULL OR lease_until < ?))",
+				models.StatusPending, models.StatusRunning, now).
+			Order("id").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		until := now.Add(lease)
+		job.Status, job.LeaseUntil = models.StatusRunning, &until
+		job.Attempts++
+		if err := tx.Select("Status", "LeaseUntil", "Attempts").Save(&job).Error; err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error claiming job from DB: %w", err)
+	}
+	return claimed, nil
+}
+
+// SaveJob stores the state and result of a job.
+func (r *GormRepository) SaveJob(ctx context.Context, job *models.Job) error {
+	err := r.db.WithContext(ctx).Select("Status", "LeaseUntil", "Attempts", "Result", "Error").Save(job).Error
+	if err != nil {
+		return fmt.Errorf("error saving job in DB: %w", err)
+	}
+	return nil
+}
+
+// PurgeJobs permanently removes finished jobs last updated before before.
+func (r *GormRepository) PurgeJobs(ctx context.Context, before time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Unscoped().
+		Where("status IN ? AND updated_at < ?", []string{models.StatusDone, models.StatusFailed}, before).
+		Delete(&models.Job{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("error purging jobs from DB: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// DictRepository stores the offline dictionary.
+type DictRepository interface {
+	AddDictEntries(ctx context.Context, entries []models.DictEntry) error
+	// FindDictEntries 返回 words 中任意一个单词的所有词条
+	FindDictEntries(ctx context.Context, words []string) ([]models.DictEntry, error)
+	DeleteDictSource(ctx context.Context, source string) (int64, error)
+}
+
+func (r *GormRepository) AddDictEntries(ctx context.Context, entries []models.DictEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).CreateInBatches(entries, 500).Error; err != nil {
+		return fmt.Errorf("error adding dictionary entries to DB: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) FindDictEntries(ctx context.Context, words []string) ([]models.DictEntry, error) {
+	var entries []models.DictEntry
+	if err := r.db.WithContext(ctx).Where("word IN ?", words).Order("id").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("error finding dictionary entries in DB: %w", err)
+	}
+	return entries, nil
+}
+
+// DeleteDictSource removes all entries imported from source, so that a
+// dictionary can be imported again.
+func (r *GormRepository) DeleteDictSource(ctx context.Context, source string) (int64, error) {
+	res := r.db.WithContext(ctx).Where("source = ?", source).Delete(&models.DictEntry{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("error deleting dictionary entries from DB: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// WordSenseRepository caches structured word senses.
+type WordSenseRepository interface {
+	// FindWordSense 未命中时返回 nil, nil
+	FindWordSense(ctx context.Context, key string) (*models.WordSense, error)
+	// SaveWordSense 保存 record, 已有相同 Key 的记录时替换
+	SaveWordSense(ctx context.Context, record *models.WordSense) error
+}
+
+func (r *GormRepository) FindWordSense(ctx context.Context, key string) (*models.WordSense, error) {
+	var record models.WordSense
+	err := r.db.WithContext(ctx).Where("`key` = ?", key).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding word sense in DB: %w", err)
+	}
+	return &record, nil
+}
+
+func (r *GormRepository) SaveWordSense(ctx context.Context, record *models.WordSense) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "lemma", "pos", "sense", "translation", "example", "notes", "ai_model", "prompt_hash", "params"}),
+	}).Create(record).Error
+	if err != nil {
+		return fmt.Errorf("error saving word sense to DB: %w", err)
+	}
+	return nil
+}
+
+// AudioRepository is the blob store of generated speech.
+type AudioRepository interface {
+	// FindAudio 返回 key 对应的音频, 不存在时返回 nil, nil
+	FindAudio(ctx context.Context, key string) (*models.Audio, error)
+	SaveAudio(ctx context.Context, record *models.Audio) error
+}
+
+func (r *GormRepository) FindAudio(ctx context.Context, key string) (*models.Audio, error) {
+	var record models.Audio
+	err := r.db.WithContext(ctx).Where("`key` = ?", key).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding audio in DB: %w", err)
+	}
+	return &record, nil
+}
+
+func (r *GormRepository) SaveAudio(ctx context.Context, record *models.Audio) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "content_type", "data"}),
+	}).Create(record).Error
+	if err != nil {
+		return fmt.Errorf("error saving audio to DB: %w", err)
+	}
+	return nil
+}
+
+// ImageTextRepository caches the text recognized in images.
+type ImageTextRepository interface {
+	// FindImageText 返回 hash 对应图片的文本, 不存在时返回 nil, nil
+	FindImageText(ctx context.Context, hash string) (*models.ImageText, error)
+	SaveImageText(ctx context.Context, record *models.ImageText) error
+}
+
+func (r *GormRepository) FindImageText(ctx context.Context, hash string) (*models.ImageText, error) {
+	var record models.ImageText
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding image text in DB: %w", err)
+	}
+	return &record, nil
+}
+
+func (r *GormRepository) SaveImageText(ctx context.Context, record *models.ImageText) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "text", "mime_type", "ai_model", "prompt_hash"}),
+	}).Create(record).Error
+	if err != nil {
+		return fmt.Errorf("error saving image text to DB: %w", err)
+	}
+	return nil
+}
+
+// GlossaryRepository stores glossaries and their terms.
+type GlossaryRepository interface {
+	CreateGlossary(ctx context.Context, glossary *models.Glossary) error
+	// GetGlossary 返回包含所有术语的术语表, 不存在时返回 nil, nil
+	GetGlossary(ctx context.Context, slug string) (*models.Glossary, error)
+	UpdateGlossary(ctx context.Context, glossary *models.Glossary) error
+	DeleteGlossary(ctx context.Context, id uint) error
+	// SaveGlossaryTerms 添加术语, 已有相同 Source 的术语时替换译法和备注
+	SaveGlossaryTerms(ctx context.Context, glossaryID uint, terms []models.GlossaryTerm) error
+	DeleteGlossaryTerm(ctx context.Context, glossaryID, termID uint) error
+}
+
+func (r *GormRepository) CreateGlossary(ctx context.Context, glossary *models.Glossary) error {
+	if err := r.db.WithContext(ctx).Create(glossary).Error; err != nil {
+		return fmt.Errorf("error creating glossary in DB: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetGlossary(ctx context.Context, slug string) (*models.Glossary, error) {
+	var glossary models.Glossary
+	err := r.db.WithContext(ctx).
+		Preload("Terms", func(db *gorm.DB) *gorm.DB { return db.Order("source") }).
+		Where("slug = ?", slug).
+		First(&glossary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding glossary in DB: %w", err)
+	}
+	return &glossary, nil
+}
+
+func (r *GormRepository) UpdateGlossary(ctx context.Context, glossary *models.Glossary) error {
+	err := r.db.WithContext(ctx).Model(glossary).
+		Select("name", "owner").
+		Updates(glossary).Error
+	if err != nil {
+		return fmt.Errorf("error updating glossary in DB: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteGlossary(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("glossary_id = ?", id).Delete(&models.GlossaryTerm{}).Error; err != nil {
+			return fmt.Errorf("error deleting glossary terms from DB: %w", err)
+		}
+		if err := tx.Delete(&models.Glossary{}, id).Error; err != nil {
+			return fmt.Errorf("error deleting glossary from DB: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) SaveGlossaryTerms(ctx context.Context, glossaryID uint, terms []models.GlossaryTerm) error {
+	if len(terms) == 0 {
+		return nil
+	}
+	for i := range terms {
+		terms[i].GlossaryID = glossaryID
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "glossary_id"}, {Name: "source"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "target", "note"}),
+	}).CreateInBatches(terms, 500).Error
+	if err != nil {
+		return fmt.Errorf("error saving glossary terms to DB: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteGlossaryTerm(ctx context.Context, glossaryID, termID uint) error {
+	res := r.db.WithContext(ctx).Where("glossary_id = ?", glossaryID).Delete(&models.GlossaryTerm{}, termID)
+	if res.Error != nil {
+		return fmt.Errorf("error deleting glossary term from DB: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ConversationRepository stores follow-up conversations.
+type ConversationRepository interface {
+	// CreateConversation 保存对话和其中的消息
+	CreateConversation(ctx context.Context, conv *models.Conversation) error
+	// GetConversation 返回包含所有消息的对话, 不存在时返回 nil, nil
+	GetConversation(ctx context.Context, token string) (*models.Conversation, error)
+	// AddConversationMessages 添加消息并更新对话的 UpdatedAt
+	AddConversationMessages(ctx context.Context, conversationID uint, messages []models.ConversationMessage) error
+	DeleteConversation(ctx context.Context, id uint) error
+	// PurgeConversations 删除 before 之后没有新消息的对话
+	PurgeConversations(ctx context.Context, before time.Time) (int64, error)
+}
+
+func (r *GormRepository) CreateConversation(ctx context.Context, conv *models.Conversation) error {
+	if err := r.db.WithContext(ctx).Create(conv).Error; err != nil {
+		return fmt.Errorf("error creating conversation in DB: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetConversation(ctx context.Context, token string) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := r.db.WithContext(ctx).
+		Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("token = ?", token).
+		First(&conv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding conversation in DB: %w", err)
+	}
+	return &conv, nil
+}
+
+func (r *GormRepository) AddConversationMessages(ctx context.Context, conversationID uint, messages []models.ConversationMessage) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range messages {
+			messages[i].ConversationID = conversationID
+		}
+		if err := tx.Create(&messages).Error; err != nil {
+			return fmt.Errorf("error adding conversation messages to DB: %w", err)
+		}
+		err := tx.Model(&models.Conversation{}).Where("id = ?", conversationID).
+			Update("updated_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("error updating conversation in DB: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) DeleteConversation(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", id).Delete(&models.ConversationMessage{}).Error; err != nil {
+			return fmt.Errorf("error deleting conversation messages from DB: %w", err)
+		}
+		if err := tx.Unscoped().Delete(&models.Conversation{}, id).Error; err != nil {
+			return fmt.Errorf("error deleting conversation from DB: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) PurgeConversations(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		old := tx.Model(&models.Conversation{}).Unscoped().Select("id").Where("updated_at < ?", before)
+		if err := tx.Where("conversation_id IN (?)", old).Delete(&models.ConversationMessage{}).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().Where("updated_at < ?", before).Delete(&models.Conversation{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error purging conversations from DB: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder is a gorm logger that keeps the generated SQL.
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// newDryRunRepository returns a repository that only builds the MySQL
+// statements without connecting to a database.
+func newDryRunRepository(t *testing.T) (*GormRepository, *sqlRecorder) {
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test@tcp(127.0.0.1:1)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: recorder})
+	require.NoError(t, err)
+	return &GormRepository{db: db}, recorder
+}
+
+func TestPoorlyRatedCandidates_Query(t *testing.T) {
+	repo, recorder := newDryRunRepository(t)
+
+	_, err := repo.PoorlyRatedCandidates(context.Background(), 0)
+	require.NoError(t, err)
+	// 只返回差评多于好评的结果, 净评分最低的在前, 相同时新的在前
+	require.NotEmpty(t, recorder.statements)
+	assert.Equal(t, "SELECT * FROM `translation_candidates` WHERE downvotes > upvotes AND `translation_candidates`.`deleted_at` IS NULL "+
+		"ORDER BY upvotes - downvotes ASC, id DESC LIMIT 50", recorder.statements[0])
+}
+
+func TestListFeedback_Query(t *testing.T) {
+	repo, recorder := newDryRunRepository(t)
+
+	_, err := repo.ListFeedback(context.Background(), 7)
+	require.NoError(t, err)
+	require.NotEmpty(t, recorder.statements)
+	assert.Equal(t, "SELECT * FROM `feedbacks` WHERE translation_id = 7 AND `feedbacks`.`deleted_at` IS NULL ORDER BY id DESC",
+		recorder.statements[0])
+}
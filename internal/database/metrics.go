@@ -0,0 +1,53 @@
+package database
+
+import (
+	"time"
+
+	"github.com/zzhirong/contextdict/internal/metrics"
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// registrar 是 gorm 回调链中的一个位置
+type registrar interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// Instrument records the latency of every query in m.DBQueryDuration,
+// labelled with the operation and the role and model of the request, see
+// metrics.LabelsFrom.
+func (r *GormRepository) Instrument(m *metrics.Metrics) error {
+	cb := r.db.Callback()
+	operations := []struct {
+		name          string
+		before, after registrar
+	}{
+		{"create", cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")},
+		{"query", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")},
+		{"update", cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")},
+		{"delete", cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")},
+		{"row", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")},
+		{"raw", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")},
+	}
+	for _, op := range operations {
+		err := op.before.Register("metrics:before_"+op.name, func(db *gorm.DB) {
+			db.InstanceSet(startKey, time.Now())
+		})
+		if err != nil {
+			return err
+		}
+		err = op.after.Register("metrics:after_"+op.name, func(db *gorm.DB) {
+			start, ok := db.InstanceGet(startKey)
+			if !ok {
+				return
+			}
+			role, model := metrics.LabelsFrom(db.Statement.Context).Values()
+			m.DBQueryDuration.WithLabelValues(op.name, role, model).Observe(time.Since(start.(time.Time)).Seconds())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
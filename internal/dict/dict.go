@@ -0,0 +1,201 @@
+// Package dict is an offline dictionary consulted before the model for
+// single words. Entries are imported from ECDICT, StarDict or Wiktionary
+// dumps into the database.
+package dict
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// singleWord 匹配可以查词典的单个英文单词
+var singleWord = regexp.MustCompile(`^[A-Za-z][A-Za-z'-]{0,63}$`)
+
+// IsWord reports whether text is a single word that can be looked up.
+func IsWord(text string) bool {
+	return singleWord.MatchString(strings.TrimSpace(text))
+}
+
+type Dictionary struct {
+	repo database.DictRepository
+}
+
+func New(repo database.DictRepository) *Dictionary {
+	return &Dictionary{repo: repo}
+}
+
+// Sense is one part of speech of a word with its definitions.
+type Sense struct {
+	POS         string   `json:"pos,omitempty"`
+	Definitions []string `json:"definitions,omitempty"`
+	// Translations 是中文释义
+	Translations []string `json:"translations,omitempty"`
+	Source       string   `json:"source"`
+}
+
+// Result is the dictionary entry of a word.
+type Result struct {
+	Word     string  `json:"word"`
+	Lemma    string  `json:"lemma,omitempty"` // 查到的是原形时为原形, 否则为空
+	Phonetic string  `json:"phonetic,omitempty"`
+	Senses   []Sense `json:"senses"`
+}
+
+// Lookup returns the entry of word, or of its base form if the word itself
+// is not in the dictionary or is only an inflected form. It returns nil if
+// nothing is found.
+func (d *Dictionary) Lookup(ctx context.Context, word string) (*Result, error) {
+	word = strings.TrimSpace(word)
+	lower := strings.ToLower(word)
+	entries, err := d.repo.FindDictEntries(ctx, unique(word, lower))
+	if err != nil {
+		return nil, err
+	}
+
+	// 屈折变化形式的词条只指向原形, 释义以原形为准
+	lemma := ""
+	for _, e := range entries {
+		if e.Lemma != "" {
+			lemma = e.Lemma
+			break
+		}
+	}
+	var candidates []string
+	if lemma != "" {
+		candidates = []string{lemma}
+	} else if len(entries) == 0 {
+		candidates = Lemmas(lower)
+	}
+	if len(candidates) > 0 {
+		base, err := d.repo.FindDictEntries(ctx, candidates)
+		if err != nil {
+			return nil, err
+		}
+		// 规则产生的多个候选中, 取排在最前面的那个
+		for _, c := range candidates {
+			var found []models.DictEntry
+			for _, e := range base {
+				if strings.EqualFold(e.Word, c) {
+					found = append(found, e)
+				}
+			}
+			if len(found) > 0 {
+				lemma = c
+				entries = append(found, entries...)
+				break
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	res := &Result{Word: word}
+	if lemma != "" && !strings.EqualFold(lemma, word) {
+		res.Lemma = lemma
+	}
+	for _, e := range entries {
+		if res.Phonetic == "" {
+			res.Phonetic = e.Phonetic
+		}
+		sense := Sense{POS: e.POS, Source: e.Source, Definitions: lines(e.Definition), Translations: lines(e.Translation)}
+		if len(sense.Definitions) > 0 || len(sense.Translations) > 0 {
+			res.Senses = append(res.Senses, sense)
+		}
+	}
+	if len(res.Senses) == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+func unique(words ...string) []string {
+	var res []string
+	for _, w := range words {
+		if w != "" && !slices.Contains(res, w) {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+func lines(s string) []string {
+	var res []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// Markdown renders the result the way AI results are shown, so the
+// frontend can display both.
+func (r *Result) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**", r.Word)
+	if r.Phonetic != "" {
+		phonetic := strings.Trim(r.Phonetic, "/[]")
+		fmt.Fprintf(&b, " /%s/", phonetic)
+	}
+	if r.Lemma != "" {
+		fmt.Fprintf(&b, " → **%s**", r.Lemma)
+	}
+	b.WriteString("\n")
+	for _, s := range r.Senses {
+		b.WriteString("\n")
+		if s.POS != "" && !strings.Contains(s.POS, ":") {
+			fmt.Fprintf(&b, "*%s*\n\n", s.POS)
+		}
+		for _, t := range s.Translations {
+			fmt.Fprintf(&b, "- %s\n", t)
+		}
+		for _, d := range s.Definitions {
+			fmt.Fprintf(&b, "- %s\n", d)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Writer stores imported entries in batches.
+type Writer struct {
+	ctx     context.Context
+	repo    database.DictRepository
+	pending []models.DictEntry
+	count   int
+}
+
+func NewWriter(ctx context.Context, repo database.DictRepository) *Writer {
+	return &Writer{ctx: ctx, repo: repo}
+}
+
+// Add queues entry and writes the queue when it is full. It can be passed
+// as emit to the Read functions.
+func (w *Writer) Add(entry models.DictEntry) error {
+	w.pending = append(w.pending, entry)
+	if len(w.pending) >= 1000 {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes the queued entries.
+func (w *Writer) Flush() error {
+	if err := w.repo.AddDictEntries(w.ctx, w.pending); err != nil {
+		return err
+	}
+	w.count += len(w.pending)
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// Count returns the number of entries written.
+func (w *Writer) Count() int {
+	return w.count
+}
@@ -0,0 +1,168 @@
+package dict
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+func TestLemmas(t *testing.T) {
+	tests := map[string]string{
+		"running": "run", "stopped": "stop", "making": "make", "used": "use",
+		"studies": "study", "boxes": "box", "cats": "cat", "knives": "knife",
+		"happier": "happy", "bigger": "big", "went": "go", "children": "child",
+		"quickly": "quick",
+	}
+	for word, lemma := range tests {
+		assert.Contains(t, Lemmas(word), lemma, word)
+	}
+	// 词典里没有屈折形式时 (例如 StarDict), 取第一个找到的候选
+	first := map[string]string{
+		"using": "use", "used": "use", "uses": "use", "caring": "care", "hoped": "hope",
+		"making": "make", "running": "run", "hopped": "hop", "stopped": "stop", "boxes": "box",
+		"happier": "happy", "went": "go", "cats": "cat", "classes": "class",
+	}
+	for word, lemma := range first {
+		if lemmas := Lemmas(word); assert.NotEmpty(t, lemmas, word) {
+			assert.Equal(t, lemma, lemmas[0], word)
+		}
+	}
+	assert.Empty(t, Lemmas("run"))
+	assert.NotContains(t, Lemmas("class"), "clas")
+}
+
+func collect(entries *[]models.DictEntry) func(models.DictEntry) error {
+	return func(e models.DictEntry) error {
+		*entries = append(*entries, e)
+		return nil
+	}
+}
+
+func TestReadECDICT(t *testing.T) {
+	csv := "word,phonetic,definition,translation,pos,collins,oxford,tag,bnc,frq,exchange,detail,audio\n" +
+		`run,rʌn,"n. a race\nv. move fast","n. 跑步\nv. 跑",v:70/n:30,5,1,zk,100,100,p:ran/d:run/i:running/3:runs,,` + "\n" +
+		`running,'rʌniŋ,,"a. 跑着的",,,,,,,0:run/1:i,,` + "\n" +
+		"empty,,,,,,,,,,,,\n"
+
+	var entries []models.DictEntry
+	require.NoError(t, ReadECDICT(strings.NewReader(csv), collect(&entries)))
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.DictEntry{
+		Word: "run", Phonetic: "rʌn", POS: "v:70/n:30",
+		Definition: "n. a race\nv. move fast", Translation: "n. 跑步\nv. 跑", Source: SourceECDICT,
+	}, entries[0])
+	assert.Equal(t, "run", entries[1].Lemma)
+}
+
+func TestReadStarDict(t *testing.T) {
+	var dict, idx bytes.Buffer
+	add := func(word, data string) {
+		idx.WriteString(word + "\x00")
+		_ = binary.Write(&idx, binary.BigEndian, uint32(dict.Len()))
+		_ = binary.Write(&idx, binary.BigEndian, uint32(len(data)))
+		dict.WriteString(data)
+	}
+	add("closure", "kləʊʒə\x00n. 闭包<br>n. 关闭")
+	add("run", "rʌn\x00v. 跑")
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(dict.Bytes())
+	require.NoError(t, zw.Close())
+
+	ifo := "StarDict's dict ifo file\nversion=2.4.2\nwordcount=2\nsametypesequence=th\n"
+	var entries []models.DictEntry
+	require.NoError(t, ReadStarDict(strings.NewReader(ifo), &idx, &gz, collect(&entries)))
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.DictEntry{Word: "closure", Phonetic: "kləʊʒə", Definition: "n. 闭包\nn. 关闭", Source: SourceStarDict}, entries[0])
+	assert.Equal(t, "run", entries[1].Word)
+}
+
+func TestReadWiktionary(t *testing.T) {
+	dump := `{"word": "run", "pos": "verb", "lang_code": "en", "sounds": [{"tags": ["UK"]}, {"ipa": "/ɹʌn/"}], "senses": [{"glosses": ["To move swiftly."]}, {"glosses": ["To execute a program."]}]}
+{"word": "running", "pos": "verb", "lang_code": "en", "senses": [{"glosses": ["present participle of run"], "form_of": [{"word": "run"}]}]}
+{"word": "run", "pos": "verb", "lang_code": "de", "senses": [{"glosses": ["other language"]}]}
+`
+	var entries []models.DictEntry
+	require.NoError(t, ReadWiktionary(strings.NewReader(dump), "en", collect(&entries)))
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.DictEntry{
+		Word: "run", POS: "verb", Phonetic: "/ɹʌn/",
+		Definition: "1. To move swiftly.\n2. To execute a program.", Source: SourceWiktionary,
+	}, entries[0])
+	assert.Equal(t, "run", entries[1].Lemma)
+}
+
+// memoryRepo is an in-memory DictRepository.
+type memoryRepo struct {
+	entries []models.DictEntry
+}
+
+func (r *memoryRepo) AddDictEntries(_ context.Context, entries []models.DictEntry) error {
+	r.entries = append(r.entries, entries...)
+	return nil
+}
+
+func (r *memoryRepo) FindDictEntries(_ context.Context, words []string) ([]models.DictEntry, error) {
+	var res []models.DictEntry
+	for _, e := range r.entries {
+		for _, w := range words {
+			if e.Word == w {
+				res = append(res, e)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryRepo) DeleteDictSource(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+func TestLookup(t *testing.T) {
+	repo := &memoryRepo{}
+	w := NewWriter(context.Background(), repo)
+	for _, e := range []models.DictEntry{
+		{Word: "run", Phonetic: "rʌn", POS: "v:70/n:30", Translation: "v. 跑\nn. 跑步", Source: SourceECDICT},
+		{Word: "running", Lemma: "run", Translation: "a. 跑着的", Source: SourceECDICT},
+		{Word: "study", Phonetic: "ˈstʌdi", Translation: "v. 学习", Source: SourceECDICT},
+	} {
+		require.NoError(t, w.Add(e))
+	}
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 3, w.Count())
+	d := New(repo)
+
+	res, err := d.Lookup(context.Background(), "Running")
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, "run", res.Lemma)
+	assert.Equal(t, "rʌn", res.Phonetic)
+	assert.Equal(t, []string{"v. 跑", "n. 跑步"}, res.Senses[0].Translations)
+	assert.Equal(t, []string{"a. 跑着的"}, res.Senses[1].Translations)
+	assert.Equal(t, "**Running** /rʌn/ → **run**\n\n- v. 跑\n- n. 跑步\n\n- a. 跑着的", res.Markdown())
+
+	// 不在词典中的屈折形式通过规则找到原形
+	res, err = d.Lookup(context.Background(), "studies")
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, "study", res.Lemma)
+
+	res, err = d.Lookup(context.Background(), "closure")
+	require.NoError(t, err)
+	assert.Nil(t, res)
+}
+
+func TestIsWord(t *testing.T) {
+	assert.True(t, IsWord("closure"))
+	assert.True(t, IsWord(" well-known "))
+	assert.False(t, IsWord("two words"))
+	assert.False(t, IsWord("闭包"))
+}
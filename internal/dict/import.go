@@ -0,0 +1,268 @@
+package dict
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// Sources of imported entries.
+const (
+	SourceECDICT     = "ecdict"
+	SourceStarDict   = "stardict"
+	SourceWiktionary = "wiktionary"
+)
+
+// ReadECDICT reads the CSV release of ECDICT
+// (https://github.com/skywind3000/ECDICT) and calls emit for every word.
+func ReadECDICT(r io.Reader, emit func(models.DictEntry) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("error reading ECDICT header: %w", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	if _, ok := col["word"]; !ok {
+		return errors.New("error reading ECDICT: missing column 'word'")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			// ECDICT 中的换行写作 \n
+			return strings.TrimSpace(strings.ReplaceAll(rec[i], `\n`, "\n"))
+		}
+		return ""
+	}
+
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading ECDICT: %w", err)
+		}
+		entry := models.DictEntry{
+			Word:        field(rec, "word"),
+			Phonetic:    field(rec, "phonetic"),
+			POS:         field(rec, "pos"),
+			Definition:  field(rec, "definition"),
+			Translation: field(rec, "translation"),
+			Source:      SourceECDICT,
+		}
+		// exchange 形如 "p:ran/d:run/i:running/3:runs", "0:" 后是原形
+		for _, ex := range strings.Split(field(rec, "exchange"), "/") {
+			if lemma, ok := strings.CutPrefix(ex, "0:"); ok && lemma != entry.Word {
+				entry.Lemma = lemma
+			}
+		}
+		if entry.Word == "" || (entry.Definition == "" && entry.Translation == "") {
+			continue
+		}
+		if err := emit(entry); err != nil {
+			return err
+		}
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// ReadStarDict reads a StarDict dictionary from its .ifo, .idx and .dict
+// files; a .dict.dz file is a gzip stream and is decompressed here.
+func ReadStarDict(ifo, idx, dict io.Reader, emit func(models.DictEntry) error) error {
+	info := map[string]string{}
+	sc := bufio.NewScanner(ifo)
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), "="); ok {
+			info[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading StarDict .ifo: %w", err)
+	}
+	offsetSize := 4
+	if info["idxoffsetbits"] == "64" {
+		offsetSize = 8
+	}
+
+	br := bufio.NewReader(dict)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("error reading StarDict .dict.dz: %w", err)
+		}
+		defer gz.Close()
+		dict = gz
+	} else {
+		dict = br
+	}
+	data, err := io.ReadAll(dict)
+	if err != nil {
+		return fmt.Errorf("error reading StarDict .dict: %w", err)
+	}
+
+	ir := bufio.NewReader(idx)
+	for {
+		word, err := ir.ReadString(0)
+		if err == io.EOF && word == "" {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading StarDict .idx: %w", err)
+		}
+		buf := make([]byte, offsetSize+4)
+		if _, err := io.ReadFull(ir, buf); err != nil {
+			return fmt.Errorf("error reading StarDict .idx: %w", err)
+		}
+		var offset uint64
+		if offsetSize == 8 {
+			offset = binary.BigEndian.Uint64(buf)
+		} else {
+			offset = uint64(binary.BigEndian.Uint32(buf))
+		}
+		size := uint64(binary.BigEndian.Uint32(buf[offsetSize:]))
+		if offset+size > uint64(len(data)) {
+			return fmt.Errorf("error reading StarDict: entry '%s' is out of range", word)
+		}
+		entry := models.DictEntry{Word: strings.TrimSuffix(word, "\x00"), Source: SourceStarDict}
+		parseStarDictData(data[offset:offset+size], info["sametypesequence"], &entry)
+		if entry.Definition == "" {
+			continue
+		}
+		if err := emit(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// parseStarDictData 解析一个词条的数据. 没有 sametypesequence 时每个字段以类型字母开头;
+// 小写类型是以 \0 结尾的文本, t 是音标, 其余文本类型作为释义.
+func parseStarDictData(data []byte, types string, entry *models.DictEntry) {
+	var defs []string
+	addField := func(typ byte, text string) {
+		switch typ {
+		case 't':
+			entry.Phonetic = strings.TrimSpace(text)
+		case 'm', 'l', 'y', 'k':
+			defs = append(defs, strings.TrimSpace(text))
+		case 'g', 'h', 'x':
+			text = strings.ReplaceAll(text, "<br>", "\n")
+			defs = append(defs, strings.TrimSpace(htmlTag.ReplaceAllString(text, "")))
+		}
+	}
+
+	if types != "" {
+		for i := 0; i < len(types); i++ {
+			if i == len(types)-1 {
+				addField(types[i], string(data))
+				break
+			}
+			end := bytes.IndexByte(data, 0)
+			if end < 0 {
+				end = len(data)
+			}
+			addField(types[i], string(data[:end]))
+			data = data[min(end+1, len(data)):]
+		}
+	} else {
+		for len(data) > 1 {
+			typ := data[0]
+			data = data[1:]
+			if typ < 'a' || typ > 'z' {
+				// 大写类型是二进制数据 (图片, 声音), 前 4 字节是长度
+				if len(data) < 4 {
+					break
+				}
+				n := min(int(binary.BigEndian.Uint32(data)), len(data)-4)
+				data = data[4+n:]
+				continue
+			}
+			end := bytes.IndexByte(data, 0)
+			if end < 0 {
+				end = len(data)
+			}
+			addField(typ, string(data[:end]))
+			data = data[min(end+1, len(data)):]
+		}
+	}
+	entry.Definition = strings.Join(defs, "\n")
+}
+
+type wiktionaryLine struct {
+	Word     string `json:"word"`
+	POS      string `json:"pos"`
+	LangCode string `json:"lang_code"`
+	Sounds   []struct {
+		IPA string `json:"ipa"`
+	} `json:"sounds"`
+	Senses []struct {
+		Glosses []string `json:"glosses"`
+		FormOf  []struct {
+			Word string `json:"word"`
+		} `json:"form_of"`
+	} `json:"senses"`
+}
+
+// ReadWiktionary reads a Wiktionary dump extracted by wiktextract (the
+// JSON lines files published on kaikki.org), keeping words of lang.
+func ReadWiktionary(r io.Reader, lang string, emit func(models.DictEntry) error) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	for line := 1; ; line++ {
+		raw, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			var w wiktionaryLine
+			if jerr := json.Unmarshal(raw, &w); jerr != nil {
+				return fmt.Errorf("error parsing Wiktionary line %d: %w", line, jerr)
+			}
+			if entry, ok := wiktionaryEntry(&w, lang); ok {
+				if err := emit(entry); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading Wiktionary: %w", err)
+		}
+	}
+}
+
+func wiktionaryEntry(w *wiktionaryLine, lang string) (models.DictEntry, bool) {
+	if w.Word == "" || (lang != "" && w.LangCode != lang) {
+		return models.DictEntry{}, false
+	}
+	entry := models.DictEntry{Word: w.Word, POS: w.POS, Source: SourceWiktionary}
+	for _, s := range w.Sounds {
+		if s.IPA != "" {
+			entry.Phonetic = s.IPA
+			break
+		}
+	}
+	var defs []string
+	for _, s := range w.Senses {
+		if len(s.FormOf) > 0 && entry.Lemma == "" {
+			entry.Lemma = s.FormOf[0].Word
+		}
+		if len(s.Glosses) > 0 {
+			defs = append(defs, strconv.Itoa(len(defs)+1)+". "+strings.Join(s.Glosses, "; "))
+		}
+	}
+	entry.Definition = strings.Join(defs, "\n")
+	return entry, entry.Definition != ""
+}
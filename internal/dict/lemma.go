@@ -0,0 +1,94 @@
+package dict
+
+import "strings"
+
+// irregular 是常见的不规则变化, 规则变化由 Lemmas 中的后缀规则处理
+var irregular = map[string]string{
+	"am": "be", "is": "be", "are": "be", "was": "be", "were": "be", "been": "be", "being": "be",
+	"has": "have", "had": "have", "does": "do", "did": "do", "done": "do",
+	"went": "go", "gone": "go", "ran": "run", "came": "come", "became": "become",
+	"saw": "see", "seen": "see", "took": "take", "taken": "take", "gave": "give", "given": "give",
+	"made": "make", "said": "say", "got": "get", "gotten": "get", "knew": "know", "known": "know",
+	"thought": "think", "brought": "bring", "bought": "buy", "caught": "catch", "taught": "teach",
+	"found": "find", "told": "tell", "left": "leave", "felt": "feel", "kept": "keep", "held": "hold",
+	"wrote": "write", "written": "write", "spoke": "speak", "spoken": "speak", "broke": "break",
+	"broken": "break", "chose": "choose", "chosen": "choose", "began": "begin", "begun": "begin",
+	"ate": "eat", "eaten": "eat", "fell": "fall", "fallen": "fall", "drove": "drive", "driven": "drive",
+	"rose": "rise", "risen": "rise", "grew": "grow", "grown": "grow", "drew": "draw", "drawn": "draw",
+	"threw": "throw", "thrown": "throw", "flew": "fly", "flown": "fly", "sang": "sing", "sung": "sing",
+	"led": "lead", "meant": "mean", "met": "meet", "paid": "pay", "sent": "send", "spent": "spend",
+	"built": "build", "lost": "lose", "sold": "sell", "stood": "stand", "understood": "understand",
+	"won": "win", "wore": "wear", "worn": "wear", "hid": "hide", "hidden": "hide", "lay": "lie",
+	"better": "good", "best": "good", "worse": "bad", "worst": "bad",
+	"children": "child", "men": "man", "women": "woman", "people": "person", "feet": "foot",
+	"teeth": "tooth", "mice": "mouse", "geese": "goose", "indices": "index", "matrices": "matrix",
+	"vertices": "vertex", "analyses": "analysis", "theses": "thesis", "criteria": "criterion",
+	"phenomena": "phenomenon", "data": "datum",
+}
+
+// Lemmas returns the possible base forms of an English word, most likely
+// first. The word itself is not included. The rules over-generate on
+// purpose ("using" gives both "use" and "us"); the first form found in the
+// dictionary is used, so the order matters when the dictionary has no
+// entries for inflected forms.
+func Lemmas(word string) []string {
+	w := strings.ToLower(word)
+	var res []string
+	seen := map[string]bool{w: true}
+	add := func(s string) {
+		if len(s) >= 2 && !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	if base, ok := irregular[w]; ok {
+		add(base)
+	}
+
+	switch {
+	case strings.HasSuffix(w, "ies") || strings.HasSuffix(w, "ied"):
+		add(w[:len(w)-3] + "y")
+	case strings.HasSuffix(w, "ves"):
+		add(w[:len(w)-3] + "f")
+		add(w[:len(w)-3] + "fe")
+	}
+	// -es 只在 ss, x, z, ch, sh 之后优先, 否则 uses -> us 会排在 use 前面
+	if stem, ok := strings.CutSuffix(w, "es"); ok && hasSibilantEnding(stem) {
+		add(stem)
+	}
+	if strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+		add(w[:len(w)-1])
+	}
+	if strings.HasSuffix(w, "es") {
+		add(w[:len(w)-2])
+	}
+	for _, suffix := range []string{"ing", "ed", "er", "est"} {
+		if !strings.HasSuffix(w, suffix) || len(w) <= len(suffix)+1 {
+			continue
+		}
+		stem := w[:len(w)-len(suffix)]
+		// running -> run, stopped -> stop
+		if n := len(stem); n >= 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+			add(stem[:n-1])
+		}
+		if (suffix == "er" || suffix == "est") && strings.HasSuffix(stem, "i") {
+			add(stem[:len(stem)-1] + "y") // happier -> happy
+		}
+		// 末尾没有双写辅音时, 词根通常以 e 结尾: making -> make, hoped -> hope
+		add(stem + "e")
+		add(stem)
+	}
+	if strings.HasSuffix(w, "ly") && len(w) > 4 {
+		add(w[:len(w)-2]) // quickly -> quick
+	}
+	return res
+}
+
+func hasSibilantEnding(stem string) bool {
+	for _, end := range []string{"ss", "x", "z", "ch", "sh"} {
+		if strings.HasSuffix(stem, end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxChapterBytes 限制解压后单个章节的大小, 防止 zip 炸弹
+const maxChapterBytes = 50 << 20
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Title    string `xml:"metadata>title"`
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractEPUB returns the text of the chapters of an EPUB in reading
+// order, as listed in the spine of its package document.
+func extractEPUB(data []byte) (title, text string, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", "", fmt.Errorf("error reading EPUB: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var container epubContainer
+	if err := readXML(files, "META-INF/container.xml", &container); err != nil {
+		return "", "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", "", fmt.Errorf("error reading EPUB: no package document")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := readXML(files, opfPath, &pkg); err != nil {
+		return "", "", err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+	var b strings.Builder
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		// href 相对于 package 文档所在的目录
+		f, ok := files[path.Join(path.Dir(opfPath), href)]
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", "", fmt.Errorf("error reading EPUB chapter %s: %w", href, err)
+		}
+		_, chapter := extractHTML(io.LimitReader(rc, maxChapterBytes))
+		rc.Close()
+		b.WriteString(chapter)
+		b.WriteString("\n\n")
+	}
+	return strings.TrimSpace(pkg.Title), b.String(), nil
+}
+
+func readXML(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("error reading EPUB: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("error reading EPUB %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, 10<<20)).Decode(v); err != nil {
+		return fmt.Errorf("error parsing EPUB %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package extract extracts plain text from uploaded documents (PDF, EPUB
+// and HTML) without external services.
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/textclean"
+)
+
+// Formats of uploaded documents.
+const (
+	FormatPDF  = "pdf"
+	FormatEPUB = "epub"
+	FormatHTML = "html"
+	FormatText = "text"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported document format")
+	ErrNoText      = errors.New("document contains no extractable text")
+)
+
+// Document is the text extracted from an uploaded file.
+type Document struct {
+	Format string
+	Title  string
+	Text   string
+}
+
+// Detect returns the format of data, using the content first and the file
+// name as a hint for formats that cannot be sniffed reliably.
+func Detect(filename string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return FormatPDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		// EPUB 是 zip, 第一个文件是未压缩的 mimetype
+		if bytes.Contains(data[:min(len(data), 100)], []byte("application/epub+zip")) ||
+			strings.EqualFold(filepath.Ext(filename), ".epub") {
+			return FormatEPUB
+		}
+		return ""
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".html", ".htm", ".xhtml":
+		return FormatHTML
+	case ".txt", ".md":
+		return FormatText
+	}
+	contentType := http.DetectContentType(data)
+	switch {
+	case strings.HasPrefix(contentType, "text/html"):
+		return FormatHTML
+	case strings.HasPrefix(contentType, "text/plain"):
+		return FormatText
+	}
+	return ""
+}
+
+// Extract extracts the text of a document and cleans up the artifacts of
+// the page layout.
+func Extract(filename string, data []byte) (*Document, error) {
+	doc := &Document{Format: Detect(filename, data)}
+	var err error
+	switch doc.Format {
+	case FormatPDF:
+		doc.Title, doc.Text, err = extractPDF(data)
+	case FormatEPUB:
+		doc.Title, doc.Text, err = extractEPUB(data)
+	case FormatHTML:
+		doc.Title, doc.Text = extractHTML(bytes.NewReader(data))
+	case FormatText:
+		doc.Text = string(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Text = textclean.Clean(doc.Text)
+	if doc.Text == "" {
+		return nil, ErrNoText
+	}
+	return doc, nil
+}
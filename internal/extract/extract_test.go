@@ -0,0 +1,103 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildPDF returns a one-page PDF showing the given content stream with
+// font F1.
+func buildPDF(content string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Title (Sample) >>",
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestExtract_PDF(t *testing.T) {
+	data := buildPDF("BT /F1 12 Tf 72 720 Td (The first won-) Tj 0 -14 Td (derful line.) Tj " +
+		"0 -40 Td (Next paragraph.) Tj ET")
+
+	doc, err := Extract("sample.pdf", data)
+	require.NoError(t, err)
+	assert.Equal(t, FormatPDF, doc.Format)
+	assert.Equal(t, "Sample", doc.Title)
+	assert.Equal(t, "The first wonderful line.\n\nNext paragraph.", doc.Text)
+}
+
+func TestExtract_HTML(t *testing.T) {
+	page := `<html><head><title>Closures</title><style>p { color: red }</style></head>
+<body><nav>Home | Blog</nav>
+<h1>Closures</h1>
+<p>A closure   captures <em>variables</em> from its
+   enclosing scope.</p>
+<script>alert("x")</script>
+<pre>func f() {
+	return
+}</pre>
+<p>Tom &amp; Jerry<br>second line</p>
+</body></html>`
+
+	doc, err := Extract("page.html", []byte(page))
+	require.NoError(t, err)
+	assert.Equal(t, FormatHTML, doc.Format)
+	assert.Equal(t, "Closures", doc.Title)
+	assert.Equal(t, "# Closures\n\nA closure captures variables from its enclosing scope.\n\n"+
+		"func f() {\n\treturn\n}\n\nTom & Jerry second line", doc.Text)
+}
+
+func TestExtract_EPUB(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct{ name, body string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`},
+		{"OEBPS/content.opf", `<package><metadata><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Book</dc:title></metadata>
+<manifest><item id="c2" href="text/two.xhtml"/><item id="c1" href="text/one.xhtml"/></manifest>
+<spine><itemref idref="c1"/><itemref idref="c2"/></spine></package>`},
+		{"OEBPS/text/one.xhtml", `<html><body><h2>One</h2><p>First chapter.</p></body></html>`},
+		{"OEBPS/text/two.xhtml", `<html><body><h2>Two</h2><p>Second chapter.</p></body></html>`},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		require.NoError(t, err)
+		_, _ = w.Write([]byte(f.body))
+	}
+	require.NoError(t, zw.Close())
+
+	doc, err := Extract("book.epub", buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, FormatEPUB, doc.Format)
+	assert.Equal(t, "Book", doc.Title)
+	assert.Equal(t, "## One\n\nFirst chapter.\n\n## Two\n\nSecond chapter.", doc.Text)
+}
+
+func TestExtract_Errors(t *testing.T) {
+	_, err := Extract("image.png", []byte("\x89PNG\r\n\x1a\n0000"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = Extract("empty.html", []byte("<html><body><script>x</script></body></html>"))
+	assert.ErrorIs(t, err, ErrNoText)
+}
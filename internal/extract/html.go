@@ -0,0 +1,94 @@
+package extract
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skipped 元素的内容不是正文
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Head: true, atom.Nav: true, atom.Svg: true, atom.Iframe: true,
+}
+
+// blockElements 前后换行, 其余元素的文本连在一起
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Li: true, atom.Ul: true, atom.Ol: true,
+	atom.Tr: true, atom.Table: true, atom.Header: true, atom.Footer: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Dd: true, atom.Dt: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+var headingLevel = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// extractHTML returns the title and the text of an HTML document. Headings
+// become Markdown headings so that later steps can follow the structure.
+func extractHTML(r io.Reader) (title, text string) {
+	var b strings.Builder
+	z := html.NewTokenizer(r)
+	skip, inTitle, inPre := 0, false, false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return strings.TrimSpace(title), b.String()
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			start := tt != html.EndTagToken
+			switch {
+			case a == atom.Title:
+				inTitle = start
+			case skipped[a] && tt != html.SelfClosingTagToken:
+				if start {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			case a == atom.Br:
+				b.WriteString("\n")
+			case blockElements[a]:
+				b.WriteString("\n\n")
+				if a == atom.Pre {
+					inPre = start
+				}
+				if level := headingLevel[a]; level > 0 && start && skip == 0 {
+					b.WriteString(strings.Repeat("#", level) + " ")
+				}
+			}
+		case html.TextToken:
+			data := string(z.Text())
+			if inTitle {
+				title += data
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			if !inPre {
+				data = strings.Join(strings.Fields(data), " ") + trailingSpaceOf(data)
+				if strings.TrimSpace(data) != "" && startsWithSpace(string(z.Raw())) {
+					data = " " + data
+				}
+			}
+			b.WriteString(data)
+		}
+	}
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r", rune(s[0]))
+}
+
+func trailingSpaceOf(s string) string {
+	if strings.TrimSpace(s) != "" && strings.ContainsRune(" \t\n\r", rune(s[len(s)-1])) {
+		return " "
+	}
+	return ""
+}
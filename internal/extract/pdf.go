@@ -0,0 +1,71 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF returns the text of a PDF, rebuilt from the positions of the
+// glyphs: glyphs on the same baseline form a line, a horizontal gap
+// becomes a space and a large vertical gap starts a new paragraph.
+func extractPDF(data []byte) (title, text string, err error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", "", fmt.Errorf("error reading PDF: %w", err)
+	}
+	title = r.Trailer().Key("Info").Key("Title").Text()
+
+	var b strings.Builder
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		pageText, err := pageText(page)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading PDF page %d: %w", i, err)
+		}
+		b.WriteString(pageText)
+		b.WriteString("\n\n")
+	}
+	return title, b.String(), nil
+}
+
+func pageText(page pdf.Page) (text string, err error) {
+	// 解析损坏的内容流时 pdf 包会 panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	var b strings.Builder
+	var last pdf.Text
+	lineHeight := 0.0
+	for i, t := range page.Content().Text {
+		size := math.Max(t.FontSize, 1)
+		if i > 0 {
+			dy := last.Y - t.Y
+			switch {
+			case math.Abs(dy) > size*0.5 || t.X < last.X-size:
+				// 行距明显大于上一行时认为是新的段落
+				if lineHeight > 0 && dy > lineHeight*1.5 {
+					b.WriteString("\n")
+				}
+				if dy > 0 {
+					lineHeight = dy
+				}
+				b.WriteString("\n")
+			case t.X-(last.X+last.W) > size*0.15 && t.S != " " && last.S != " ":
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(t.S)
+		last = t
+	}
+	return b.String(), nil
+}
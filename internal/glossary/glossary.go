@@ -0,0 +1,147 @@
+// Package glossary makes translations use the terms of a team's glossary:
+// the terms found in the text are added to the prompt, and the output is
+// checked for the required translations afterwards.
+package glossary
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// MaxTerms limits the number of terms imported at once.
+const MaxTerms = 5000
+
+// Violation is a term whose required translation is missing from the output.
+type Violation struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Match returns the terms whose source appears in text. Latin terms match
+// whole words, case-insensitively and with a plural "s" or "es".
+func Match(terms []models.GlossaryTerm, text string) []models.GlossaryTerm {
+	var matched []models.GlossaryTerm
+	lower := strings.ToLower(text)
+	for _, t := range terms {
+		source := strings.ToLower(strings.TrimSpace(t.Source))
+		if source == "" || !strings.Contains(lower, source) {
+			continue
+		}
+		if isLatin(source) && !wordPattern(source).MatchString(lower) {
+			continue
+		}
+		matched = append(matched, t)
+	}
+	return matched
+}
+
+func wordPattern(source string) *regexp.Regexp {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(source) + `(?:s|es)?\b`)
+}
+
+func isLatin(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxLatin1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Prompt returns the instructions appended to the system prompt for terms.
+func Prompt(terms []models.GlossaryTerm) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n# 术语表\n以下术语必须使用指定的译法, 多个译法用 | 分隔时任选其一:\n")
+	for _, t := range terms {
+		fmt.Fprintf(&b, "- %s → %s", t.Source, t.Target)
+		if t.Note != "" {
+			fmt.Fprintf(&b, " (%s)", t.Note)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Check returns the terms for which output contains none of the accepted
+// translations.
+func Check(terms []models.GlossaryTerm, output string) []Violation {
+	violations := []Violation{}
+	lower := strings.ToLower(output)
+	for _, t := range terms {
+		found := false
+		for _, target := range strings.Split(t.Target, "|") {
+			target = strings.ToLower(strings.TrimSpace(target))
+			if target != "" && strings.Contains(lower, target) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violations = append(violations, Violation{Source: t.Source, Target: t.Target})
+		}
+	}
+	return violations
+}
+
+// ReadCSV reads terms as "source,target[,note]" rows. A first row starting
+// with "source" is taken as a header.
+func ReadCSV(r io.Reader) ([]models.GlossaryTerm, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var terms []models.GlossaryTerm
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "source") {
+			continue
+		}
+		if len(record) < 2 || strings.TrimSpace(record[0]) == "" || strings.TrimSpace(record[1]) == "" {
+			return nil, fmt.Errorf("line %d: expected source,target[,note]", line)
+		}
+		term := models.GlossaryTerm{Source: strings.TrimSpace(record[0]), Target: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			term.Note = strings.TrimSpace(record[2])
+		}
+		terms = append(terms, term)
+		if len(terms) > MaxTerms {
+			return nil, fmt.Errorf("too many terms, at most %d can be imported at once", MaxTerms)
+		}
+	}
+	return terms, nil
+}
+
+// NewCredentials returns a random public slug and edit token for a new
+// glossary.
+func NewCredentials() (slug, token string, err error) {
+	b := make([]byte, 28)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b[:12]), hex.EncodeToString(b[12:]), nil
+}
+
+// HashToken returns the stored form of an edit token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package glossary
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+var terms = []models.GlossaryTerm{
+	{Source: "closure", Target: "闭包"},
+	{Source: "goroutine", Target: "协程|goroutine", Note: "不要译为线程"},
+	{Source: "map", Target: "映射"},
+	{Source: "通道", Target: "channel"},
+}
+
+func sources(terms []models.GlossaryTerm) []string {
+	var s []string
+	for _, t := range terms {
+		s = append(s, t.Source)
+	}
+	return s
+}
+
+func TestMatch(t *testing.T) {
+	matched := Match(terms, "Closures capture variables; each Goroutine has its own stack. See the bitmap.")
+	assert.Equal(t, []string{"closure", "goroutine"}, sources(matched))
+
+	matched = Match(terms, "数据通过通道发送")
+	assert.Equal(t, []string{"通道"}, sources(matched))
+}
+
+func TestPrompt(t *testing.T) {
+	assert.Empty(t, Prompt(nil))
+	p := Prompt(terms[:2])
+	assert.Contains(t, p, "- closure → 闭包\n")
+	assert.Contains(t, p, "- goroutine → 协程|goroutine (不要译为线程)\n")
+}
+
+func TestCheck(t *testing.T) {
+	violations := Check(terms[:2], "闭包会捕获变量, 每个 Goroutine 都有自己的栈")
+	assert.Empty(t, violations)
+
+	violations = Check(terms[:2], "闭合函数会捕获变量, 每个线程都有自己的栈")
+	assert.Equal(t, []Violation{{Source: "closure", Target: "闭包"}, {Source: "goroutine", Target: "协程|goroutine"}}, violations)
+}
+
+func TestReadCSV(t *testing.T) {
+	input := "source,target,note\nclosure,闭包\n\n\"goroutine\", 协程|goroutine, 不要译为线程\n"
+	got, err := ReadCSV(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []models.GlossaryTerm{
+		{Source: "closure", Target: "闭包"},
+		{Source: "goroutine", Target: "协程|goroutine", Note: "不要译为线程"},
+	}, got)
+
+	_, err = ReadCSV(strings.NewReader("closure,闭包\n\nmap\n"))
+	assert.ErrorContains(t, err, "line 3")
+}
+
+func TestCredentials(t *testing.T) {
+	slug, token, err := NewCredentials()
+	require.NoError(t, err)
+	assert.Len(t, slug, 24)
+	assert.Len(t, token, 32)
+	assert.Equal(t, HashToken(token), HashToken(token))
+	assert.NotEqual(t, token, HashToken(token))
+}
@@ -0,0 +1,278 @@
+// Package grammar asks the model for a structured grammatical analysis of
+// a sentence: clauses, phrases, sentence elements and dependency arcs.
+//
+// The sentence is split into numbered tokens before it is sent, and the
+// model refers to tokens by index. Character spans into the original text
+// are computed from the tokens, so they are always exact, and the frontend
+// can highlight every component.
+package grammar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zzhirong/contextdict/internal/ai"
+)
+
+// MaxAttempts is the number of times the model is asked before giving up
+// on invalid output.
+const MaxAttempts = 3
+
+// MaxTokens limits the length of the analysed text.
+const MaxTokens = 200
+
+// ErrTooLong is returned for text with more than MaxTokens tokens.
+var ErrTooLong = fmt.Errorf("text is too long for structured analysis, at most %d words", MaxTokens)
+
+// Allowed values of the type fields.
+var (
+	ClauseTypes  = []string{"main", "coordinate", "relative", "adverbial", "noun", "non-finite"}
+	PhraseTypes  = []string{"noun", "verb", "prepositional", "adjective", "adverb", "infinitive", "participle", "gerund", "absolute"}
+	ElementTypes = []string{"subject", "verb", "object", "indirect_object", "complement", "object_complement", "adverbial"}
+	Structures   = []string{"simple", "compound", "complex", "compound-complex", "fragment"}
+)
+
+// Span is a range of characters (Unicode code points) in the original
+// text; End is exclusive.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Token is a word or punctuation mark of the text.
+type Token struct {
+	Text string `json:"text"`
+	Span Span   `json:"span"`
+}
+
+// Range is a range of token indexes, both inclusive, as returned by the
+// model.
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Component is a clause, phrase or sentence element. Text and Span are
+// filled from the tokens.
+type Component struct {
+	Type     string `json:"type"`
+	Function string `json:"function"` // 在句子中的作用, 简体中文
+	Tokens   Range  `json:"tokens"`
+	Text     string `json:"text"`
+	Span     Span   `json:"span"`
+}
+
+// Clause is a clause with its sentence elements.
+type Clause struct {
+	Component
+	Elements []Component `json:"elements"`
+}
+
+// Arc is a dependency between two tokens, for example "nsubj" from the
+// verb to its subject.
+type Arc struct {
+	Head      int    `json:"head"`
+	Dependent int    `json:"dependent"`
+	Relation  string `json:"relation"`
+}
+
+// Analysis is the validated result.
+type Analysis struct {
+	Tokens    []Token     `json:"tokens"`
+	Structure string      `json:"structure"`
+	Clauses   []Clause    `json:"clauses"`
+	Phrases   []Component `json:"phrases"`
+	Arcs      []Arc       `json:"arcs"`
+	Notes     string      `json:"notes"` // 时态, 语态, 特殊句式等, 简体中文
+
+	runes []rune
+}
+
+// Schema is the JSON schema of the model output. Text and Span are not
+// part of it; they are computed.
+var Schema = ai.Schema{Name: "grammar_analysis", Schema: json.RawMessage(schema())}
+
+func schema() string {
+	enum := func(values []string) string {
+		b, _ := json.Marshal(values)
+		return string(b)
+	}
+	rangeSchema := `{"type": "object", "properties": {"start": {"type": "integer"}, "end": {"type": "integer"}},
+      "required": ["start", "end"], "additionalProperties": false}`
+	component := func(types []string) string {
+		return `{"type": "object", "properties": {
+        "type": {"type": "string", "enum": ` + enum(types) + `},
+        "function": {"type": "string"},
+        "tokens": ` + rangeSchema + `},
+      "required": ["type", "function", "tokens"], "additionalProperties": false}`
+	}
+	return `{
+  "type": "object",
+  "properties": {
+    "structure": {"type": "string", "enum": ` + enum(Structures) + `},
+    "clauses": {"type": "array", "items": {"type": "object", "properties": {
+      "type": {"type": "string", "enum": ` + enum(ClauseTypes) + `},
+      "function": {"type": "string"},
+      "tokens": ` + rangeSchema + `,
+      "elements": {"type": "array", "items": ` + component(ElementTypes) + `}},
+      "required": ["type", "function", "tokens", "elements"], "additionalProperties": false}},
+    "phrases": {"type": "array", "items": ` + component(PhraseTypes) + `},
+    "arcs": {"type": "array", "items": {"type": "object", "properties": {
+      "head": {"type": "integer"}, "dependent": {"type": "integer"}, "relation": {"type": "string"}},
+      "required": ["head", "dependent", "relation"], "additionalProperties": false}},
+    "notes": {"type": "string"}
+  },
+  "required": ["structure", "clauses", "phrases", "arcs", "notes"],
+  "additionalProperties": false
+}`
+}
+
+var tokenPattern = regexp.MustCompile(`\p{Han}|[\p{L}\p{N}]+(?:['’.-][\p{L}\p{N}]+)*|\S`)
+
+// Tokenize splits text into words and punctuation marks.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	runes, last := 0, 0
+	for _, loc := range tokenPattern.FindAllStringIndex(text, -1) {
+		runes += utf8.RuneCountInString(text[last:loc[0]])
+		n := utf8.RuneCountInString(text[loc[0]:loc[1]])
+		tokens = append(tokens, Token{Text: text[loc[0]:loc[1]], Span: Span{Start: runes, End: runes + n}})
+		runes += n
+		last = loc[1]
+	}
+	return tokens
+}
+
+// Numbered returns the tokens as sent to the model, "index:token" separated
+// by spaces.
+func Numbered(tokens []Token) string {
+	parts := make([]string, len(tokens))
+	for i, t := range tokens {
+		parts[i] = strconv.Itoa(i) + ":" + t.Text
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse validates the model output for text and fills in the text and
+// span of every component.
+func Parse(output, text string) (*Analysis, error) {
+	var a Analysis
+	if err := json.Unmarshal([]byte(ai.TrimCodeFence(output)), &a); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	a.Tokens = Tokenize(text)
+	a.runes = []rune(text)
+	a.Structure = strings.ToLower(strings.TrimSpace(a.Structure))
+	if !slices.Contains(Structures, a.Structure) {
+		return nil, fmt.Errorf("invalid structure %q", a.Structure)
+	}
+	if len(a.Clauses) == 0 {
+		return nil, errors.New("no clauses")
+	}
+	for i := range a.Clauses {
+		c := &a.Clauses[i]
+		if err := a.fill(&c.Component, ClauseTypes); err != nil {
+			return nil, fmt.Errorf("clause %d: %w", i, err)
+		}
+		for j := range c.Elements {
+			if err := a.fill(&c.Elements[j], ElementTypes); err != nil {
+				return nil, fmt.Errorf("clause %d element %d: %w", i, j, err)
+			}
+		}
+		if c.Elements == nil {
+			c.Elements = []Component{}
+		}
+	}
+	for i := range a.Phrases {
+		if err := a.fill(&a.Phrases[i], PhraseTypes); err != nil {
+			return nil, fmt.Errorf("phrase %d: %w", i, err)
+		}
+	}
+	for i, arc := range a.Arcs {
+		switch {
+		case !a.valid(arc.Head) || !a.valid(arc.Dependent):
+			return nil, fmt.Errorf("arc %d: token index out of range", i)
+		case arc.Head == arc.Dependent:
+			return nil, fmt.Errorf("arc %d: head and dependent are the same token", i)
+		case strings.TrimSpace(arc.Relation) == "":
+			return nil, fmt.Errorf("arc %d: missing relation", i)
+		}
+	}
+	if a.Arcs == nil {
+		a.Arcs = []Arc{}
+	}
+	if a.Phrases == nil {
+		a.Phrases = []Component{}
+	}
+	return &a, nil
+}
+
+func (a *Analysis) valid(index int) bool {
+	return index >= 0 && index < len(a.Tokens)
+}
+
+// fill checks the type and token range of c and sets its text and span.
+func (a *Analysis) fill(c *Component, types []string) error {
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	if !slices.Contains(types, c.Type) {
+		return fmt.Errorf("invalid type %q", c.Type)
+	}
+	r := c.Tokens
+	if !a.valid(r.Start) || !a.valid(r.End) || r.Start > r.End {
+		return fmt.Errorf("invalid token range %d-%d", r.Start, r.End)
+	}
+	c.Span = Span{Start: a.Tokens[r.Start].Span.Start, End: a.Tokens[r.End].Span.End}
+	c.Text = string(a.runes[c.Span.Start:c.Span.End])
+	return nil
+}
+
+// Analyze asks client for the analysis of text and retries while the output
+// is invalid, see ai.GenerateJSON.
+func Analyze(ctx context.Context, client ai.Client, prompt, text string, onInvalid func(error)) (*Analysis, error) {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return nil, errors.New("no words to analyse")
+	}
+	if len(tokens) > MaxTokens {
+		return nil, ErrTooLong
+	}
+	parse := func(output string) (*Analysis, error) { return Parse(output, text) }
+	return ai.GenerateJSON(ctx, client, Schema, MaxAttempts, parse, onInvalid, prompt, text, Numbered(tokens))
+}
+
+// Markdown renders a as a list for display.
+func (a *Analysis) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n", a.Structure)
+	for _, c := range a.Clauses {
+		fmt.Fprintf(&b, "\n- %s clause: %s", c.Type, c.Text)
+		if c.Function != "" {
+			fmt.Fprintf(&b, " (%s)", c.Function)
+		}
+		b.WriteString("\n")
+		for _, e := range c.Elements {
+			fmt.Fprintf(&b, "    - %s: %s\n", e.Type, e.Text)
+		}
+	}
+	if len(a.Phrases) > 0 {
+		b.WriteString("\n")
+	}
+	for _, p := range a.Phrases {
+		fmt.Fprintf(&b, "- %s phrase: %s", p.Type, p.Text)
+		if p.Function != "" {
+			fmt.Fprintf(&b, " (%s)", p.Function)
+		}
+		b.WriteString("\n")
+	}
+	if a.Notes != "" {
+		fmt.Fprintf(&b, "\n%s\n", a.Notes)
+	}
+	return strings.TrimSpace(b.String())
+}
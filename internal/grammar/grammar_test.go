@@ -0,0 +1,106 @@
+package grammar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/internal/ai"
+)
+
+const sentence = "Having finished, he left the café."
+
+// 0:Having 1:finished 2:, 3:he 4:left 5:the 6:café 7:.
+const valid = `{
+  "structure": "Complex",
+  "clauses": [
+    {"type": "main", "function": "主句", "tokens": {"start": 3, "end": 7}, "elements": [
+      {"type": "subject", "function": "", "tokens": {"start": 3, "end": 3}},
+      {"type": "verb", "function": "", "tokens": {"start": 4, "end": 4}},
+      {"type": "object", "function": "", "tokens": {"start": 5, "end": 6}}
+    ]},
+    {"type": "non-finite", "function": "时间状语", "tokens": {"start": 0, "end": 1}, "elements": []}
+  ],
+  "phrases": [{"type": "participle", "function": "表示先于主句的动作", "tokens": {"start": 0, "end": 1}}],
+  "arcs": [{"head": 4, "dependent": 3, "relation": "nsubj"}],
+  "notes": "完成式分词"
+}`
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize(sentence)
+	var texts []string
+	for _, tok := range tokens {
+		texts = append(texts, tok.Text)
+	}
+	assert.Equal(t, []string{"Having", "finished", ",", "he", "left", "the", "café", "."}, texts)
+	// 位置按字符计算, é 是一个字符
+	assert.Equal(t, Span{Start: 29, End: 33}, tokens[6].Span)
+	assert.Equal(t, Span{Start: 33, End: 34}, tokens[7].Span)
+
+	assert.Len(t, Tokenize("don't well-known 3.14"), 3)
+	assert.Equal(t, "0:he 1:left", Numbered(Tokenize("he left")))
+}
+
+func TestSchemaIsValidJSON(t *testing.T) {
+	assert.True(t, json.Valid(Schema.Schema))
+}
+
+func TestParse(t *testing.T) {
+	a, err := Parse(valid, sentence)
+	require.NoError(t, err)
+	assert.Equal(t, "complex", a.Structure)
+	main := a.Clauses[0]
+	assert.Equal(t, "he left the café.", main.Text)
+	assert.Equal(t, Span{Start: 17, End: 34}, main.Span)
+	assert.Equal(t, "the café", main.Elements[2].Text)
+	assert.Equal(t, "Having finished", a.Phrases[0].Text)
+
+	for name, bad := range map[string]string{
+		"range":    strings.Replace(valid, `"start": 5, "end": 6`, `"start": 6, "end": 5`, 1),
+		"index":    strings.Replace(valid, `"head": 4`, `"head": 8`, 1),
+		"type":     strings.Replace(valid, `"type": "participle"`, `"type": "gerundive"`, 1),
+		"same":     strings.Replace(valid, `"head": 4`, `"head": 3`, 1),
+		"clauses":  `{"structure": "simple", "clauses": [], "phrases": [], "arcs": [], "notes": ""}`,
+		"not json": "The sentence is complex.",
+	} {
+		_, err := Parse(bad, sentence)
+		assert.Error(t, err, name)
+	}
+}
+
+// fakeClient 依次返回 outputs 中的结果, 并记录发送的文本
+type fakeClient struct {
+	outputs []string
+	texts   []string
+}
+
+func (c *fakeClient) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
+	c.texts = texts
+	out := c.outputs[0]
+	c.outputs = c.outputs[1:]
+	return out, nil
+}
+
+func (c *fakeClient) Model() string { return "test-model" }
+
+func TestAnalyze(t *testing.T) {
+	client := &fakeClient{outputs: []string{`{"structure": "complex"}`, "```json\n" + valid + "\n```"}}
+	invalid := 0
+	a, err := Analyze(context.Background(), client, "prompt", sentence, func(error) { invalid++ })
+	require.NoError(t, err)
+	assert.Equal(t, 1, invalid)
+	assert.Len(t, a.Tokens, 8)
+	assert.Equal(t, []string{sentence, "0:Having 1:finished 2:, 3:he 4:left 5:the 6:café 7:."}, client.texts)
+
+	_, err = Analyze(context.Background(), client, "prompt", strings.Repeat("word ", MaxTokens+1), nil)
+	assert.True(t, errors.Is(err, ErrTooLong))
+
+	client = &fakeClient{outputs: []string{"a", "b", "c"}}
+	_, err = Analyze(context.Background(), client, "prompt", sentence, nil)
+	assert.True(t, errors.Is(err, ai.ErrInvalidOutput))
+}
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	_ "embed"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/batch"
+	"github.com/zzhirong/contextdict/internal/budget"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+//go:embed admin.html
+var adminPage []byte
+
+// AdminHandler 提供 /admin 下的管理接口, 由 middleware.AdminAuth 保护.
+type AdminHandler struct {
+	API    *APIHandler
+	Budget *budget.Budget
+	// Batch 和 Jobs 为 nil 时不提供批量预翻译接口
+	Batch *batch.Runner
+	Jobs  database.BatchRepository
+}
+
+func NewAdminHandler(api *APIHandler, b *budget.Budget) *AdminHandler {
+	return &AdminHandler{API: api, Budget: b}
+}
+
+// Page 返回内嵌的管理页面, 页面本身不含数据, 由前端携带 token 调用管理接口.
+func (h *AdminHandler) Page(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", adminPage)
+}
+
+// BudgetStatus 返回当前各个预算窗口的消耗情况.
+func (h *AdminHandler) BudgetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Budget.Status())
+}
+
+// TripBudget 手动断开 AI 调用, 之后只返回缓存结果.
+func (h *AdminHandler) TripBudget(c *gin.Context) {
+	h.Budget.Trip()
+	c.JSON(http.StatusOK, h.Budget.Status())
+}
+
+// ResetBudget 清空已消耗的 token 并恢复 AI 调用.
+func (h *AdminHandler) ResetBudget(c *gin.Context) {
+	h.Budget.Reset()
+	c.JSON(http.StatusOK, h.Budget.Status())
+}
+
+// translationView 是缓存记录在管理接口中的表示, 结果字段来自被选中的候选结果
+type translationView struct {
+	ID          uint            `json:"id"`
+	Text        string          `json:"text"`
+	Selected    string          `json:"selected"`
+	CandidateID uint            `json:"candidate_id"`
+	Translation string          `json:"translation"`
+	Prompt      string          `json:"prompt"`
+	PromptHash  string          `json:"prompt_hash"`
+	Model       string          `json:"model"`
+	Params      string          `json:"params"`
+	Upvotes     int             `json:"upvotes"`
+	Downvotes   int             `json:"downvotes"`
+	Candidates  []candidateView `json:"candidates"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type candidateView struct {
+	ID            uint      `json:"id"`
+	TranslationID uint      `json:"translation_id"`
+	Translation   string    `json:"translation"`
+	Prompt        string    `json:"prompt"`
+	PromptHash    string    `json:"prompt_hash"`
+	Model         string    `json:"model"`
+	Params        string    `json:"params"`
+	Upvotes       int       `json:"upvotes"`
+	Downvotes     int       `json:"downvotes"`
+	Pinned        bool      `json:"pinned"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newCandidateView(c *models.TranslationCandidate) candidateView {
+	return candidateView{
+		ID:            c.ID,
+		TranslationID: c.TranslationID,
+		Translation:   c.Translation,
+		Prompt:        c.Prompt,
+		PromptHash:    c.PromptHash,
+		Model:         c.AIModel,
+		Params:        c.Params,
+		Upvotes:       c.Upvotes,
+		Downvotes:     c.Downvotes,
+		Pinned:        c.Pinned,
+		CreatedAt:     c.CreatedAt,
+	}
+}
+
+func newTranslationView(r *models.TranslationResponse) translationView {
+	v := translationView{
+		ID:          r.ID,
+		Text:        r.Text,
+		Selected:    r.Selected,
+		CandidateID: r.CandidateID,
+		Translation: r.Translation,
+		Prompt:      r.Prompt,
+		PromptHash:  r.PromptHash,
+		Model:       r.AIModel,
+		Params:      r.Params,
+		Candidates:  make([]candidateView, len(r.Candidates)),
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+	for i := range r.Candidates {
+		c := &r.Candidates[i]
+		v.Candidates[i] = newCandidateView(c)
+		if c.ID == r.CandidateID {
+			v.Upvotes, v.Downvotes = c.Upvotes, c.Downvotes
+		}
+	}
+	return v
+}
+
+// parseTime 接受 RFC3339 或者 2006-01-02 格式, 空字符串返回零值
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
+
+type filterParams struct {
+	Pattern string `form:"pattern" json:"pattern"`
+	Before  string `form:"before" json:"before"`
+	After   string `form:"after" json:"after"`
+	Limit   int    `form:"limit" json:"-"`
+	Offset  int    `form:"offset" json:"-"`
+}
+
+func (p filterParams) filter() (database.TranslationFilter, error) {
+	before, err := parseTime(p.Before)
+	if err != nil {
+		return database.TranslationFilter{}, err
+	}
+	after, err := parseTime(p.After)
+	if err != nil {
+		return database.TranslationFilter{}, err
+	}
+	return database.TranslationFilter{
+		Pattern: p.Pattern,
+		Before:  before,
+		After:   after,
+		Limit:   p.Limit,
+		Offset:  p.Offset,
+	}, nil
+}
+
+// SearchTranslations 按 pattern (SQL LIKE) 和日期范围查询缓存.
+func (h *AdminHandler) SearchTranslations(c *gin.Context) {
+	var params filterParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	filter, err := params.filter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date: " + err.Error()})
+		return
+	}
+	records, total, err := h.API.Repo.SearchTranslations(c.Request.Context(), filter)
+	if err != nil {
+		log.Printf("Error searching translations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error searching cache"})
+		return
+	}
+	items := make([]translationView, len(records))
+	for i := range records {
+		items[i] = newTranslationView(&records[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "items": items})
+}
+
+// loadTranslation 读取路径参数 id 对应的记录, 失败时已写入响应.
+func (h *AdminHandler) loadTranslation(c *gin.Context) (*models.TranslationResponse, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return nil, false
+	}
+	record, err := h.API.Repo.GetTranslation(c.Request.Context(), uint(id))
+	if err != nil {
+		log.Printf("Error loading translation %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading translation"})
+		return nil, false
+	}
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Translation not found"})
+		return nil, false
+	}
+	return record, true
+}
+
+func (h *AdminHandler) GetTranslation(c *gin.Context) {
+	record, ok := h.loadTranslation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newTranslationView(record))
+}
+
+// UpdateTranslation 手动修正缓存的结果, 修正的结果作为新的候选版本并被固定.
+func (h *AdminHandler) UpdateTranslation(c *gin.Context) {
+	var body struct {
+		Translation string `json:"translation" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: translation"})
+		return
+	}
+	record, ok := h.loadTranslation(c)
+	if !ok {
+		return
+	}
+	record.Translation = body.Translation
+	record.Prompt, record.PromptHash, record.AIModel, record.Params = "manual", "", "", ""
+	if !h.addCandidate(c, record) {
+		return
+	}
+	if err := h.API.Repo.PinCandidate(c.Request.Context(), record.CandidateID, true); err != nil {
+		log.Printf("Error pinning candidate %d: %v", record.CandidateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error pinning candidate"})
+		return
+	}
+	h.respondTranslation(c, record.ID)
+}
+
+// addCandidate 保存 record 的结果为新的候选版本, 失败时已写入响应.
+func (h *AdminHandler) addCandidate(c *gin.Context, record *models.TranslationResponse) bool {
+	if err := h.API.Repo.AddCandidate(c.Request.Context(), record); err != nil {
+		log.Printf("Error adding candidate to translation %d: %v", record.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error saving candidate"})
+		return false
+	}
+	return true
+}
+
+// respondTranslation 重新读取记录, 返回选择策略应用后的结果.
+func (h *AdminHandler) respondTranslation(c *gin.Context, id uint) {
+	record, err := h.API.Repo.GetTranslation(c.Request.Context(), id)
+	if err != nil || record == nil {
+		log.Printf("Error reloading translation %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading translation"})
+		return
+	}
+	c.JSON(http.StatusOK, newTranslationView(record))
+}
+
+func (h *AdminHandler) DeleteTranslation(c *gin.Context) {
+	record, ok := h.loadTranslation(c)
+	if !ok {
+		return
+	}
+	if err := h.API.Repo.DeleteTranslation(c.Request.Context(), record.ID); err != nil {
+		log.Printf("Error deleting translation %d: %v", record.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting translation"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateTranslation 忽略缓存重新调用 AI, 新结果作为新的候选版本保存.
+func (h *AdminHandler) RegenerateTranslation(c *gin.Context) {
+	model := c.Query("model")
+	if model != "" && !h.API.allowedModel(model) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid model"})
+		return
+	}
+	record, ok := h.loadTranslation(c)
+	if !ok {
+		return
+	}
+	fresh, err := h.API.generateTranslation(c.Request.Context(), "translate", record.Text, record.Selected, model, nil)
+	if err != nil {
+		log.Printf("AI regeneration failed for translation %d: %v", record.ID, err)
+		abortOnAIError(c, err, "AI service failed to generate translation")
+		return
+	}
+	if fresh.Translation == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI service returned an empty result"})
+		return
+	}
+	fresh.ID = record.ID
+	if !h.addCandidate(c, fresh) {
+		return
+	}
+	h.respondTranslation(c, record.ID)
+}
+
+// PurgeTranslations 按 pattern 和日期批量删除缓存, 至少需要一个条件.
+func (h *AdminHandler) PurgeTranslations(c *gin.Context) {
+	var params filterParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	filter, err := params.filter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date: " + err.Error()})
+		return
+	}
+	deleted, err := h.API.Repo.PurgeTranslations(c.Request.Context(), filter)
+	if errors.Is(err, database.ErrEmptyFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error purging translations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error purging cache"})
+		return
+	}
+	log.Printf("Purged %d cached translations (pattern='%s', before='%s', after='%s')",
+		deleted, params.Pattern, params.Before, params.After)
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// PoorlyRated 列出差评多于好评的候选结果, 最差的在前.
+func (h *AdminHandler) PoorlyRated(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	candidates, err := h.API.Repo.PoorlyRatedCandidates(c.Request.Context(), limit)
+	if err != nil {
+		log.Printf("Error listing poorly rated candidates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error listing feedback"})
+		return
+	}
+	type poorlyRatedView struct {
+		candidateView
+		Text     string `json:"text"`
+		Selected string `json:"selected"`
+	}
+	items := make([]poorlyRatedView, len(candidates))
+	for i := range candidates {
+		items[i].candidateView = newCandidateView(&candidates[i])
+		if entry := candidates[i].Entry; entry != nil {
+			items[i].Text, items[i].Selected = entry.Text, entry.Selected
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// candidateID 读取路径参数 id, 失败时已写入响应.
+func candidateID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// PinCandidate 固定候选结果, 之后总是返回它. DELETE 方法取消固定.
+func (h *AdminHandler) PinCandidate(c *gin.Context) {
+	id, ok := candidateID(c)
+	if !ok {
+		return
+	}
+	pinned := c.Request.Method != http.MethodDelete
+	err := h.API.Repo.PinCandidate(c.Request.Context(), id, pinned)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Candidate not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error pinning candidate %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error pinning candidate"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "pinned": pinned})
+}
+
+func (h *AdminHandler) DeleteCandidate(c *gin.Context) {
+	id, ok := candidateID(c)
+	if !ok {
+		return
+	}
+	err := h.API.Repo.DeleteCandidate(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Candidate not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting candidate %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting candidate"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type feedbackView struct {
+	ID          uint      `json:"id"`
+	CandidateID uint      `json:"candidate_id"`
+	Rating      int       `json:"rating"`
+	Comment     string    `json:"comment"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListFeedback 返回某个缓存条目所有候选结果收到的评价.
+func (h *AdminHandler) ListFeedback(c *gin.Context) {
+	record, ok := h.loadTranslation(c)
+	if !ok {
+		return
+	}
+	feedback, err := h.API.Repo.ListFeedback(c.Request.Context(), record.ID)
+	if err != nil {
+		log.Printf("Error listing feedback for translation %d: %v", record.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error listing feedback"})
+		return
+	}
+	items := make([]feedbackView, len(feedback))
+	for i, f := range feedback {
+		items[i] = feedbackView{
+			ID:          f.ID,
+			CandidateID: f.CandidateID,
+			Rating:      f.Rating,
+			Comment:     f.Comment,
+			CreatedAt:   f.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
@@ -1,16 +1,38 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/config"
 	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/budget"
+	"github.com/zzhirong/contextdict/internal/codefmt"
+	"github.com/zzhirong/contextdict/internal/conversation"
 	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/dict"
+	"github.com/zzhirong/contextdict/internal/glossary"
+	"github.com/zzhirong/contextdict/internal/grammar"
+	"github.com/zzhirong/contextdict/internal/guard"
+	"github.com/zzhirong/contextdict/internal/jobs"
 	"github.com/zzhirong/contextdict/internal/metrics"
 	"github.com/zzhirong/contextdict/internal/models"
+	"github.com/zzhirong/contextdict/internal/moderation"
+	"github.com/zzhirong/contextdict/internal/ocr"
+	"github.com/zzhirong/contextdict/internal/reporting"
+	"github.com/zzhirong/contextdict/internal/summarize"
+	"github.com/zzhirong/contextdict/internal/textclean"
+	"github.com/zzhirong/contextdict/internal/tts"
+	"github.com/zzhirong/contextdict/internal/wordsense"
 	"gorm.io/gorm"
 )
 
@@ -18,6 +40,16 @@ type query struct {
 	Text     string `form:"text" binding:"required"`
 	Role     string `form:"role" binding:"required"`
 	Selected string `form:"selected"`
+	// Regenerate 忽略缓存重新生成, 并替换缓存中的结果
+	Regenerate bool   `form:"regenerate"`
+	Model      string `form:"model"`
+	// AI 为 true 时单词也交给 AI 结合上下文翻译, 不查离线词典
+	AI bool `form:"ai"`
+	// Structured 为 true 时 translate 以 JSON 返回 selected 在上下文中的词义,
+	// analyze 返回句子结构, 用于前端高亮各个成分
+	Structured bool `form:"structured"`
+	// Glossary 是术语表的 id, 翻译时必须使用其中术语的译法
+	Glossary string `form:"glossary"`
 }
 
 type APIHandler struct {
@@ -25,6 +57,36 @@ type APIHandler struct {
 	AIClient ai.Client
 	Metrics  *metrics.Metrics
 	Prompts  map[string]string
+	// Budget 为 nil 时不限制 AI 调用
+	Budget *budget.Budget
+	// Models 是重新生成时允许选择的其他模型
+	Models []string
+	// Jobs 为 nil 时不提供异步任务接口
+	Jobs *jobs.Queue
+	// MaxUploadBytes 限制上传文件的大小, 0 表示不限制
+	MaxUploadBytes int64
+	// Dict 为 nil 时不查离线词典
+	Dict *dict.Dictionary
+	// Conversations 为 nil 时不提供追问
+	Conversations *conversation.Manager
+	// Glossaries 为 nil 时不提供术语表
+	Glossaries database.GlossaryRepository
+	// Senses 为 nil 时不缓存结构化的词义
+	Senses database.WordSenseRepository
+	// Summarizer 为 nil 时 summarize 不分块, 整个文本作为一条消息发送
+	Summarizer *summarize.Summarizer
+	// TTS 为 nil 时不提供朗读
+	TTS *tts.Service
+	// OCR 为 nil 时不提供图片识别
+	OCR *ocr.Reader
+	// Timeouts 是每个请求的 AI 截止时间, 零值表示不限制
+	Timeouts config.TimeoutConfig
+	// Language 配置输入语言的检测和路由, Target 为空时不检测
+	Language config.LanguageConfig
+	// Reporter 上报 AI 调用的失败, 默认不上报
+	Reporter reporting.Reporter
+
+	background sync.WaitGroup
 }
 
 func NewAPIHandler(repo database.Repository, aiClient ai.Client, metrics *metrics.Metrics, prompts map[string]string) *APIHandler {
@@ -33,6 +95,7 @@ func NewAPIHandler(repo database.Repository, aiClient ai.Client, metrics *metric
 		AIClient: aiClient,
 		Metrics:  metrics,
 		Prompts:  prompts,
+		Reporter: reporting.Nop{},
 	}
 }
 
@@ -47,42 +110,187 @@ func checkText(c *gin.Context) (*query, bool) {
 	return q, true
 }
 
+// generate 在预算允许时调用 AI, 并把消耗的 token 记入 role 的预算.
+func (h *APIHandler) generate(ctx context.Context, role, prompt string, texts ...string) (string, error) {
+	if err := h.Budget.Allow(role); err != nil {
+		return "", err
+	}
+	usage := &ai.Usage{}
+	ctx = ai.WithRole(ai.WithUsage(ctx, usage), role)
+	ctx, span := tracer.Start(ctx, "ai.generate")
+	defer span.End()
+	start := time.Now()
+	result, err := h.AIClient.Generate(ctx, h.renderPrompt(ctx, prompt), texts...)
+	h.Budget.Record(role, usage.Total())
+	h.observeAI(ctx, role, start, usage, result, err)
+	return result, err
+}
+
+// run 执行 translate 以外的 role, summarize 的长文本分块处理,
+// clean 只做本地的确定性清理, 不调用 AI; format 先清理再交给 AI.
+func (h *APIHandler) run(ctx context.Context, role, prompt, text string) (string, error) {
+	switch role {
+	case "clean":
+		return textclean.Clean(text), nil
+	case "format":
+		if formatted, ok := h.formatLocally(text); ok {
+			return formatted, nil
+		}
+		text = textclean.Clean(text)
+	case "summarize":
+		if h.Summarizer != nil {
+			return h.Summarizer.Summarize(ctx, roleClient{h: h, role: role}, text)
+		}
+	}
+	return h.generate(ctx, role, prompt, text)
+}
+
+// formatLocally 在 text 是可以本地格式化的代码时返回带语言标注的代码块, 不需要调用 AI.
+func (h *APIHandler) formatLocally(text string) (string, bool) {
+	lang, formatted, ok := codefmt.DetectAndFormat(text)
+	if !ok {
+		return "", false
+	}
+	log.Printf("Formatted %s code locally (%d bytes)", lang, len(text))
+	h.Metrics.LocalFormatCounter.WithLabelValues(lang).Inc()
+	return formatted, true
+}
+
+// lookupWord 在离线词典中查找单个单词, 查不到或出错时返回 nil, 由 AI 翻译.
+func (h *APIHandler) lookupWord(ctx context.Context, text string) *dict.Result {
+	if h.Dict == nil || !dict.IsWord(text) {
+		return nil
+	}
+	res, err := h.Dict.Lookup(ctx, text)
+	switch {
+	case err != nil:
+		log.Printf("Error looking up '%s' in dictionary: %v", text, err)
+		h.Metrics.DictionaryLookupCounter.WithLabelValues("error").Inc()
+	case res == nil:
+		h.Metrics.DictionaryLookupCounter.WithLabelValues("miss").Inc()
+	default:
+		h.Metrics.DictionaryLookupCounter.WithLabelValues("hit").Inc()
+	}
+	return res
+}
+
+// validRole 报告 role 是否存在: translate 和 clean 之外的 role 需要配置 prompt.
+func (h *APIHandler) validRole(role string) bool {
+	_, ok := h.Prompts[role]
+	return ok || role == "translate" || role == "clean"
+}
+
+// roleClient 是调用计入 role 预算的 ai.Client
+type roleClient struct {
+	h    *APIHandler
+	role string
+}
+
+func (c roleClient) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
+	return c.h.generate(ctx, c.role, prompt, texts...)
+}
+
+// Chat 使 roleClient 也能发送多轮和多部分的消息, 见 ai.Chat
+func (c roleClient) Chat(ctx context.Context, prompt string, messages []ai.Message) (string, error) {
+	return c.h.chat(ctx, c.role, prompt, messages)
+}
+
+func (c roleClient) Model() string {
+	return c.h.AIClient.Model()
+}
+
+// abortOnAIError 把 AI 调用的错误转换成响应, 预算耗尽时返回 429.
+func abortOnAIError(c *gin.Context, err error, message string) {
+	if errors.Is(err, budget.ErrExhausted) {
+		c.JSON(http.StatusTooManyRequests,
+			gin.H{"error": "AI budget exhausted, only cached results are available"})
+		return
+	}
+	switch {
+	case errors.Is(err, moderation.ErrBlocked):
+		// 与其他错误区分, 前端据 code 提示用户而不是重试
+		c.JSON(http.StatusForbidden, gin.H{"error": "Text was blocked by moderation", "code": "moderation_blocked"})
+	case errors.Is(err, guard.ErrViolation):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI output was rejected, please try again"})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "AI service timed out"})
+	case errors.Is(err, context.Canceled):
+		// 浏览器已经断开, 响应只出现在日志中
+		c.JSON(499, gin.H{"error": "Request cancelled"})
+	default:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": message})
+	}
+}
+
 func (h *APIHandler) Translate(c *gin.Context) {
 	q, ok := checkText(c)
 	if !ok {
 		return
 	}
-	cachedResult, err := h.Repo.FindTranslation(c.Request.Context(), q.Text, q.Selected)
+	if q.Model != "" && !h.allowedModel(q.Model) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid model"})
+		return
+	}
+	if q.Structured {
+		h.translateStructured(c, q)
+		return
+	}
+	if q.Selected == "" {
+		// 代码不需要翻译, 与 TranslateOrFormat prompt 一样只做格式化
+		if formatted, ok := h.formatLocally(q.Text); ok {
+			h.Metrics.TranslationCounter.WithLabelValues("translate").Inc()
+			respond(c, http.StatusOK, gin.H{"result": formatted})
+			return
+		}
+	}
+	terms, ok := h.glossaryTerms(c, q.Glossary, q.Text)
+	if !ok {
+		return
+	}
+	if q.Selected == "" && !q.AI && !q.Regenerate && len(terms) == 0 {
+		if res := h.lookupWord(c.Request.Context(), q.Text); res != nil {
+			respond(c, http.StatusOK, gin.H{"result": res.Markdown(), "dictionary": res})
+			return
+		}
+	}
+	cachedResult, err := h.findTranslation(c.Request.Context(), q.Text, q.Selected)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		log.Printf("Error checking cache for text='%s', selected='%s': %v", q.Text, q.Selected, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking cache"})
 		return
 	}
 
-	if cachedResult != nil {
+	// 缓存的结果不一定符合术语表, 不符合时带着术语重新生成
+	if cachedResult != nil && !q.Regenerate && len(glossary.Check(terms, cachedResult.Translation)) == 0 {
 		log.Printf("Cache hit for text='%s', context='%s'", q.Text, q.Selected)
 		h.Metrics.TranslationCacheHitCounter.WithLabelValues("translate").Inc()
-		c.JSON(http.StatusOK, gin.H{"result": cachedResult.Translation})
+		respond(c, http.StatusOK, gin.H{
+			"result":       cachedResult.Translation,
+			"id":           cachedResult.ID,
+			"candidate_id": cachedResult.CandidateID,
+		})
 		return
 	}
 
-	log.Printf("Cache miss for text='%s', selected='%s'. Querying AI.", q.Text, q.Selected)
-
-	var translation string
-	var aiErr error
-	var promptTypeLabel string
+	if q.Regenerate {
+		log.Printf("Regenerating text='%s', selected='%s' with model '%s'.", q.Text, q.Selected, q.Model)
+	} else {
+		log.Printf("Cache miss for text='%s', selected='%s'. Querying AI.", q.Text, q.Selected)
+	}
 
+	promptTypeLabel := "translate"
 	if q.Selected != "" {
 		promptTypeLabel = "translate_selected"
-		translation, aiErr = h.AIClient.Generate(
-			c.Request.Context(),
-			h.Prompts["TranslateOnSelected"],
-			q.Selected,
-			q.Text,
-		)
+	}
+	var newRecord *models.TranslationResponse
+	var aiErr error
+	if len(terms) > 0 {
+		newRecord, aiErr = h.generateTranslation(c.Request.Context(), "translate", q.Text, q.Selected, q.Model, terms)
 	} else {
-		promptTypeLabel = "translate"
-		translation, aiErr = h.AIClient.Generate(c.Request.Context(), h.Prompts["TranslateOrFormat"], q.Text)
+		newRecord, aiErr = h.generateTranslationInBackground(c.Request.Context(), q.Text, q.Selected, q.Model,
+			func(ctx context.Context, record *models.TranslationResponse) {
+				h.cacheTranslation(ctx, cachedResult, record)
+			})
 	}
 
 	h.Metrics.TranslationCounter.WithLabelValues(promptTypeLabel).Inc()
@@ -90,12 +298,11 @@ func (h *APIHandler) Translate(c *gin.Context) {
 	if aiErr != nil {
 		log.Printf("AI generation failed for text='%s', selected='%s': %v",
 			q.Text, q.Selected, aiErr)
-		c.JSON(http.StatusServiceUnavailable,
-			gin.H{"error": "AI service failed to generate translation"})
+		abortOnAIError(c, aiErr, "AI service failed to generate translation")
 		return
 	}
 
-	if translation == "" {
+	if newRecord.Translation == "" {
 		log.Printf(
 			"AI returned empty translation for text='%s',selected='%s'",
 			q.Text,
@@ -108,18 +315,239 @@ func (h *APIHandler) Translate(c *gin.Context) {
 		return
 	}
 
-	newRecord := &models.TranslationResponse{
-		Text:        q.Text,
-		Selected:    q.Selected,
-		Translation: translation,
+	if len(terms) > 0 {
+		// 按术语表生成的结果只适用于该术语表, 不写入所有人共用的缓存
+		violations := glossary.Check(terms, newRecord.Translation)
+		if len(violations) > 0 {
+			log.Printf("Translation of text='%s' violates %d glossary terms", q.Text, len(violations))
+			h.Metrics.GlossaryViolationCounter.Add(float64(len(violations)))
+		}
+		respond(c, http.StatusOK, gin.H{
+			"result":              newRecord.Translation,
+			"glossary_violations": violations,
+		})
+		return
 	}
-	if err := h.Repo.CreateTranslation(c.Request.Context(), newRecord); err != nil {
-		log.Printf("Error caching translation for text='%s', selected='%s': %v", q.Text, q.Selected, err)
+
+	h.cacheTranslation(c.Request.Context(), cachedResult, newRecord)
+	respond(c, http.StatusOK, gin.H{
+		"result":       newRecord.Translation,
+		"id":           newRecord.ID,
+		"candidate_id": newRecord.CandidateID,
+	})
+}
+
+// cacheTranslation 把新生成的 record 写入缓存. 已有缓存条目 cached 时,
+// 重新生成的结果作为新的候选版本保存, 由选择策略决定之后返回哪一个.
+func (h *APIHandler) cacheTranslation(ctx context.Context, cached, record *models.TranslationResponse) {
+	if err := h.saveTranslation(ctx, cached, record); err != nil {
+		h.Metrics.CacheWriteFailureCounter.WithLabelValues("translation").Inc()
+		log.Printf("Error caching translation for text='%s', selected='%s': %v", record.Text, record.Selected, err)
 	} else {
-		log.Printf("Successfully cached translation for text='%s', selected='%s'", q.Text, q.Selected)
+		log.Printf("Successfully cached translation for text='%s', selected='%s'", record.Text, record.Selected)
+	}
+}
+
+// translateStructured 返回 selected 在 text 中的词义, 模型输出校验失败时重试.
+func (h *APIHandler) translateStructured(c *gin.Context, q *query) {
+	prompt, ok := h.Prompts["WordSense"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Structured output is not configured"})
+		return
+	}
+	if q.Selected == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Structured output requires selected"})
+		return
+	}
+	ctx := c.Request.Context()
+	key := wordsense.Key(q.Text, q.Selected)
+	if h.Senses != nil && !q.Regenerate {
+		cached, err := h.Senses.FindWordSense(ctx, key)
+		if err != nil {
+			log.Printf("Error checking word sense cache for text='%s', selected='%s': %v", q.Text, q.Selected, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking cache"})
+			return
+		}
+		if cached != nil {
+			h.Metrics.TranslationCacheHitCounter.WithLabelValues("translate_structured").Inc()
+			respond(c, http.StatusOK, gin.H{"result": wordsense.Markdown(&cached.Sense), "sense": cached.Sense, "id": cached.ID})
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"result": translation})
+	model := q.Model
+	if model != "" {
+		ctx = ai.WithModel(ctx, model)
+	} else {
+		model = h.AIClient.Model()
+	}
+	h.Metrics.TranslationCounter.WithLabelValues("translate_structured").Inc()
+	sense, err := wordsense.Generate(ctx, roleClient{h: h, role: "translate"}, prompt, q.Selected, q.Text, func(error) {
+		h.Metrics.AIInvalidOutputCounter.WithLabelValues("translate_structured").Inc()
+	})
+	if errors.Is(err, ai.ErrInvalidOutput) {
+		log.Printf("AI kept returning invalid word sense for text='%s', selected='%s': %v", q.Text, q.Selected, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI service returned invalid structured output"})
+		return
+	}
+	if err != nil {
+		log.Printf("AI generation failed for text='%s', selected='%s': %v", q.Text, q.Selected, err)
+		abortOnAIError(c, err, "AI service failed to generate translation")
+		return
+	}
+
+	record := &models.WordSense{
+		Key:        key,
+		Text:       q.Text,
+		Selected:   q.Selected,
+		Sense:      *sense,
+		AIModel:    model,
+		PromptHash: promptHash(prompt),
+		Params:     ai.ParamsJSON(h.AIClient, "translate"),
+	}
+	if h.Senses != nil {
+		if err := h.Senses.SaveWordSense(ctx, record); err != nil {
+			h.Metrics.CacheWriteFailureCounter.WithLabelValues("sense").Inc()
+			log.Printf("Error caching word sense for text='%s', selected='%s': %v", q.Text, q.Selected, err)
+		}
+	}
+	respond(c, http.StatusOK, gin.H{"result": wordsense.Markdown(sense), "sense": sense, "id": record.ID})
+}
+
+// allowedModel 只允许默认模型和配置中列出的模型, 避免被用来调用昂贵的模型
+func (h *APIHandler) allowedModel(model string) bool {
+	return model == h.AIClient.Model() || slices.Contains(h.Models, model)
+}
+
+type feedbackRequest struct {
+	CandidateID uint   `json:"candidate_id" binding:"required"`
+	Rating      string `json:"rating" binding:"required,oneof=up down"`
+	Comment     string `json:"comment"`
+}
+
+// Feedback 记录读者对缓存结果的评价, 供管理员找出质量差的结果.
+func (h *APIHandler) Feedback(c *gin.Context) {
+	var req feedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedback: candidate_id and rating (up/down) are required"})
+		return
+	}
+	// 接口不需要登录, 按客户端地址去重, 避免同一客户端反复投票影响 best_rated 的选择
+	feedback := &models.Feedback{CandidateID: req.CandidateID, Rating: 1, Comment: req.Comment, Voter: voterKey(c.ClientIP())}
+	if req.Rating == "down" {
+		feedback.Rating = -1
+	}
+	err := h.Repo.AddFeedback(c.Request.Context(), feedback)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Translation not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving feedback for candidate %d: %v", req.CandidateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error saving feedback"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "ok"})
+}
+
+// generateTranslation 调用 AI 翻译 text, 返回的记录带有 prompt 和模型信息, 尚未写入缓存.
+// role 用于预算统计, model 为空时使用默认模型, terms 是必须使用的术语译法.
+func (h *APIHandler) generateTranslation(ctx context.Context, role, text, selected, model string, terms []models.GlossaryTerm) (*models.TranslationResponse, error) {
+	promptName, texts := "TranslateOrFormat", []string{text}
+	if selected != "" {
+		promptName, texts = "TranslateOnSelected", []string{selected, text}
+	}
+	if model != "" {
+		ctx = ai.WithModel(ctx, model)
+	} else {
+		model = h.AIClient.Model()
+	}
+	prompt := h.Prompts[promptName] + glossary.Prompt(terms)
+	translation, err := h.generate(ctx, role, prompt, texts...)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TranslationResponse{
+		Text:        text,
+		Selected:    selected,
+		Translation: translation,
+		Prompt:      promptName,
+		PromptHash:  promptHash(prompt),
+		AIModel:     model,
+		Params:      ai.ParamsJSON(h.AIClient, role),
+	}, nil
+}
+
+// Pretranslate 在缓存未命中时翻译并写入缓存, 供批量预翻译任务使用.
+func (h *APIHandler) Pretranslate(ctx context.Context, text, selected string) error {
+	cached, err := h.findTranslation(ctx, text, selected)
+	if err != nil {
+		return err
+	}
+	if cached != nil {
+		return nil
+	}
+	record, err := h.generateTranslation(ctx, "batch", text, selected, "", nil)
+	if err != nil {
+		return err
+	}
+	if record.Translation == "" {
+		return errors.New("AI returned empty translation")
+	}
+	return h.saveTranslation(ctx, nil, record)
+}
+
+// ErrInvalidRole is returned by Process for roles without a prompt.
+var ErrInvalidRole = errors.New("invalid role")
+
+// Process 处理异步任务, 与同步接口的逻辑相同: 翻译结果使用并写入缓存.
+func (h *APIHandler) Process(ctx context.Context, role, text, selected string) (string, error) {
+	if !h.validRole(role) {
+		return "", ErrInvalidRole
+	}
+	if role != "translate" {
+		h.Metrics.TranslationCounter.WithLabelValues(role).Inc()
+		result, err := h.run(ctx, role, h.Prompts[role], text)
+		if err == nil && result == "" {
+			err = errors.New("AI returned empty result")
+		}
+		return result, err
+	}
+
+	if selected == "" {
+		if formatted, ok := h.formatLocally(text); ok {
+			return formatted, nil
+		}
+	}
+	cached, err := h.findTranslation(ctx, text, selected)
+	if err != nil {
+		return "", err
+	}
+	if cached != nil {
+		h.Metrics.TranslationCacheHitCounter.WithLabelValues("translate").Inc()
+		return cached.Translation, nil
+	}
+	record, err := h.generateTranslation(ctx, "translate", text, selected, "", nil)
+	if err != nil {
+		return "", err
+	}
+	if record.Translation == "" {
+		return "", errors.New("AI returned empty translation")
+	}
+	h.cacheTranslation(ctx, nil, record)
+	return record.Translation, nil
+}
+
+// promptHash 返回 prompt 内容的短哈希
+// voterKey identifies a client without storing its address.
+func voterKey(addr string) string {
+	sum := sha256.Sum256([]byte("feedback:" + addr))
+	return hex.EncodeToString(sum[:16])
+}
+
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:8])
 }
 
 func (h *APIHandler) Handle(c *gin.Context) {
@@ -127,22 +555,34 @@ func (h *APIHandler) Handle(c *gin.Context) {
 	if !ok {
 		return
 	}
+	h.route(c, q)
+	if h.validRole(q.Role) {
+		model := h.AIClient.Model()
+		if q.Model != "" && h.allowedModel(q.Model) {
+			model = q.Model
+		}
+		setLabels(c, q.Role, model)
+	}
+	defer h.withDeadline(c, q.Role)()
 	if q.Role == "translate" {
 		h.Translate(c)
 		return
 	}
+	if q.Role == "analyze" && q.Structured {
+		h.analyzeStructured(c, q)
+		return
+	}
 	h.Metrics.TranslationCounter.WithLabelValues(q.Role).Inc()
 
-	var prompt string
-	if prompt, ok = h.Prompts[q.Role]; !ok {
+	if !h.validRole(q.Role) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
 		return
 	}
 
-	result, err := h.AIClient.Generate(c.Request.Context(), prompt, q.Text)
+	result, err := h.run(c.Request.Context(), q.Role, h.Prompts[q.Role], q.Text)
 	if err != nil {
 		log.Printf("AI generation failed for %s text='%s': %v", q.Role, q.Text, err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI service failed to process text"})
+		abortOnAIError(c, err, "AI service failed to process text")
 		return
 	}
 
@@ -153,5 +593,32 @@ func (h *APIHandler) Handle(c *gin.Context) {
 	}
 
 	fmt.Printf("The response length: %d\n", len(result))
-	c.JSON(http.StatusOK, gin.H{"result": result})
+	respond(c, http.StatusOK, gin.H{"result": result})
+}
+
+// analyzeStructured 返回句子的结构化语法分析, 模型输出校验失败时重试.
+func (h *APIHandler) analyzeStructured(c *gin.Context, q *query) {
+	prompt, ok := h.Prompts["analyze_structured"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Structured output is not configured"})
+		return
+	}
+	h.Metrics.TranslationCounter.WithLabelValues("analyze_structured").Inc()
+	analysis, err := grammar.Analyze(c.Request.Context(), roleClient{h: h, role: "analyze"}, prompt, q.Text, func(error) {
+		h.Metrics.AIInvalidOutputCounter.WithLabelValues("analyze_structured").Inc()
+	})
+	switch {
+	case errors.Is(err, grammar.ErrTooLong):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ai.ErrInvalidOutput):
+		log.Printf("AI kept returning invalid analysis for text='%s': %v", q.Text, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI service returned invalid structured output"})
+		return
+	case err != nil:
+		log.Printf("AI generation failed for analyze text='%s': %v", q.Text, err)
+		abortOnAIError(c, err, "AI service failed to process text")
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"result": analysis.Markdown(), "analysis": analysis})
 }
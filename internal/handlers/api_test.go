@@ -1,26 +1,47 @@
 package handlers_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/budget"
+	"github.com/zzhirong/contextdict/internal/conversation"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/dict"
 	"github.com/zzhirong/contextdict/internal/handlers"
+	"github.com/zzhirong/contextdict/internal/langdetect"
 	"github.com/zzhirong/contextdict/internal/metrics"
 	"github.com/zzhirong/contextdict/internal/models"
+	"github.com/zzhirong/contextdict/internal/moderation"
+	"github.com/zzhirong/contextdict/internal/ocr"
+	"github.com/zzhirong/contextdict/internal/reporting"
+	"github.com/zzhirong/contextdict/internal/tts"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // --- Mocks ---
@@ -30,8 +51,8 @@ type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) FindTranslation(ctx context.Context, keyword, contextStr string) (*models.TranslationResponse, error) {
-	args := m.Called(ctx, keyword, contextStr)
+func (m *MockRepository) FindTranslation(ctx context.Context, text, selected string) (*models.TranslationResponse, error) {
+	args := m.Called(ctx, text, selected)
 	// Need type assertion for the first return value
 	res, _ := args.Get(0).(*models.TranslationResponse)
 	return res, args.Error(1)
@@ -42,6 +63,60 @@ func (m *MockRepository) CreateTranslation(ctx context.Context, record *models.T
 	return args.Error(0)
 }
 
+func (m *MockRepository) SearchTranslations(ctx context.Context, filter database.TranslationFilter) ([]models.TranslationResponse, int64, error) {
+	args := m.Called(ctx, filter)
+	res, _ := args.Get(0).([]models.TranslationResponse)
+	return res, args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockRepository) GetTranslation(ctx context.Context, id uint) (*models.TranslationResponse, error) {
+	args := m.Called(ctx, id)
+	res, _ := args.Get(0).(*models.TranslationResponse)
+	return res, args.Error(1)
+}
+
+func (m *MockRepository) AddCandidate(ctx context.Context, record *models.TranslationResponse) error {
+	args := m.Called(ctx, record)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PinCandidate(ctx context.Context, candidateID uint, pinned bool) error {
+	args := m.Called(ctx, candidateID, pinned)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteCandidate(ctx context.Context, candidateID uint) error {
+	args := m.Called(ctx, candidateID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteTranslation(ctx context.Context, id uint) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PurgeTranslations(ctx context.Context, filter database.TranslationFilter) (int64, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) AddFeedback(ctx context.Context, feedback *models.Feedback) error {
+	args := m.Called(ctx, feedback)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListFeedback(ctx context.Context, translationID uint) ([]models.Feedback, error) {
+	args := m.Called(ctx, translationID)
+	res, _ := args.Get(0).([]models.Feedback)
+	return res, args.Error(1)
+}
+
+func (m *MockRepository) PoorlyRatedCandidates(ctx context.Context, limit int) ([]models.TranslationCandidate, error) {
+	args := m.Called(ctx, limit)
+	res, _ := args.Get(0).([]models.TranslationCandidate)
+	return res, args.Error(1)
+}
+
 func (m *MockRepository) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -60,20 +135,31 @@ func (m *MockAIClient) Generate(ctx context.Context, prompt string, texts ...str
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockAIClient) Model() string {
+	return "test-model"
+}
+
 // Helper to create a test Gin context and recorder
 func setupTestRouter(h *handlers.APIHandler) (*gin.Engine, *httptest.ResponseRecorder) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	router := gin.New() // Use New, not Default, for test isolation
 
-	// Register routes like in server.go but simplified for specific handler tests
-	router.GET("/api/translate", h.Translate)
-	router.GET("/api/format", h.Format)
-	router.GET("/api/summarize", h.Summarize)
+	// Register routes like in server.go
+	router.GET("/api", h.Handle)
+	router.POST("/api/upload", h.Upload)
 
 	return router, w
 }
 
+func apiURL(role, text, selected string) string {
+	u := fmt.Sprintf("/api?role=%s&text=%s", role, url.QueryEscape(text))
+	if selected != "" {
+		u += "&selected=" + url.QueryEscape(selected)
+	}
+	return u
+}
+
 // --- Test Cases ---
 
 // 测试辅助函数
@@ -88,25 +174,23 @@ type testSetup struct {
 func newTestSetup() *testSetup {
 	registry := prometheus.NewRegistry()
 	return &testSetup{
-		repo: new(MockRepository),
-		ai:   new(MockAIClient),
-		metrics: &metrics.Metrics{
-			TranslationCounter: promauto.With(registry).NewCounterVec(
-				prometheus.CounterOpts{Name: "test_reqs", Help: "test"},
-				[]string{"type"},
-			),
-			TranslationCacheHitCounter: promauto.With(registry).NewCounterVec(
-				prometheus.CounterOpts{Name: "test_cache_hits", Help: "test"},
-				[]string{"type"},
-			),
-		},
+		repo:     new(MockRepository),
+		ai:       new(MockAIClient),
+		metrics:  metrics.NewMetricsWith(registry),
 		registry: registry,
-		cfg:      &config.Config{},
+		cfg: &config.Config{
+			Prompts: map[string]string{
+				"TranslateOnSelected": "Translate selected",
+				"TranslateOrFormat":   "Translate or format",
+				"format":              "Format",
+				"summarize":           "Summarize",
+			},
+		},
 	}
 }
 
 func (ts *testSetup) newHandler() (*handlers.APIHandler, *gin.Engine, *httptest.ResponseRecorder) {
-	handler := handlers.NewAPIHandler(ts.repo, ts.ai, ts.metrics, &ts.cfg.Prompts)
+	handler := handlers.NewAPIHandler(ts.repo, ts.ai, ts.metrics, ts.cfg.Prompts)
 	router, w := setupTestRouter(handler)
 	return handler, router, w
 }
@@ -119,6 +203,8 @@ func (ts *testSetup) assertMetric(t *testing.T, name, label string, expected flo
 		metric = ts.metrics.TranslationCounter
 	case "cache_hits":
 		metric = ts.metrics.TranslationCacheHitCounter
+	case "budget_rejected":
+		metric = ts.metrics.AIBudgetRejectedCounter
 	default:
 		t.Fatalf("Unknown metric name: %s", name)
 	}
@@ -128,49 +214,54 @@ func (ts *testSetup) assertMetric(t *testing.T, name, label string, expected flo
 }
 
 // 测试用例
-func TestAPIHandler_MissingKeyword(t *testing.T) {
+func TestAPIHandler_MissingText(t *testing.T) {
 	ts := newTestSetup()
 	_, router, w := ts.newHandler()
 
-	// 测试 Format 接口
-	req, _ := http.NewRequest(http.MethodGet, "/api/format", nil)
+	// 缺少 text
+	req, _ := http.NewRequest(http.MethodGet, "/api?role=format", nil)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Body.String(), "Missing required parameter: keyword")
+	assert.Contains(t, w.Body.String(), "Missing required parameter: text")
 
-	// 测试 Summarize 接口
+	// 缺少 role
 	w = httptest.NewRecorder()
-	req, _ = http.NewRequest(http.MethodGet, "/api/summarize", nil)
+	req, _ = http.NewRequest(http.MethodGet, "/api?text=hello", nil)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Body.String(), "Missing required parameter: keyword")
+	assert.Contains(t, w.Body.String(), "Missing required parameter: text")
+}
 
-	// 测试 Translate 接口
-	w = httptest.NewRecorder()
-	req, _ = http.NewRequest(http.MethodGet, "/api/translate", nil)
+func TestAPIHandler_InvalidRole(t *testing.T) {
+	ts := newTestSetup()
+	_, router, w := ts.newHandler()
+
+	req, _ := http.NewRequest(http.MethodGet, apiURL("unknown", "hello", ""), nil)
 	router.ServeHTTP(w, req)
+
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Body.String(), "Missing required parameter: keyword")
+	assert.Contains(t, w.Body.String(), "Invalid role")
+	ts.ai.AssertNotCalled(t, "Generate")
 }
 
 func TestAPIHandler_Translate_CacheHit(t *testing.T) {
 	ts := newTestSetup()
-	keyword, context := "hello", "greeting"
+	text, selected := "hello", "greeting"
 	cachedResponse := &models.TranslationResponse{
-		Keyword:     keyword,
-		Context:     context,
+		Text:        text,
+		Selected:    selected,
+		CandidateID: 5,
 		Translation: "你好",
 	}
 
-	ts.repo.On("FindTranslation", mock.Anything, keyword, context).Return(cachedResponse, nil)
+	ts.repo.On("FindTranslation", mock.Anything, text, selected).Return(cachedResponse, nil)
 
 	_, router, w := ts.newHandler()
-	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/translate?keyword=%s&context=%s",
-		url.QueryEscape(keyword), url.QueryEscape(context)), nil)
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", text, selected), nil)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.JSONEq(t, `{"result":"你好"}`, w.Body.String())
+	assert.JSONEq(t, `{"result":"你好","id":0,"candidate_id":5}`, w.Body.String())
 
 	ts.repo.AssertExpectations(t)
 	ts.ai.AssertNotCalled(t, "Generate")
@@ -178,242 +269,1123 @@ func TestAPIHandler_Translate_CacheHit(t *testing.T) {
 }
 
 func TestAPIHandler_Translate_CacheMiss_AI_Success(t *testing.T) {
-	mockRepo := new(MockRepository)
-	mockAI := new(MockAIClient)
-	mockMetricsRegistry := prometheus.NewRegistry() // Use a specific registry for tests
-	mockMetrics := &metrics.Metrics{
-		TranslationCounter:         promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_reqs"}, []string{"type"}),
-		TranslationCacheHitCounter: promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_cache_hits"}, []string{"type"}),
-	}
-
-	cfg := &config.Config{ // Config needed for prompts
-		Prompts: config.PromptConfig{
-			TranslateOnContext: "Translate '{keyword}' context '{context}'",
-			TranslateOrFormat:  "Translate '{keyword}'", // For the no-context case
-		},
-	}
-
-	// Input
-	keyword := "world"
-	contextStr := "place"
+	ts := newTestSetup()
+	text, selected := "world", "place"
 	aiTranslation := "世界"
+	prompt := ts.cfg.Prompts["TranslateOnSelected"]
 
-	// Mock Interactions
 	// 1. Cache miss
-	mockRepo.On("FindTranslation", mock.Anything, keyword, contextStr).Return(nil, nil) // Return nil, nil for cache miss
-	// 2. AI call (using context prompt)
-	mockAI.On("Generate", mock.Anything, cfg.Prompts.TranslateOnContext, []string{keyword, contextStr}).Return(aiTranslation, nil)
+	ts.repo.On("FindTranslation", mock.Anything, text, selected).Return(nil, nil)
+	// 2. AI call (using selected prompt)
+	ts.ai.On("Generate", mock.Anything, prompt, []string{selected, text}).Return(aiTranslation, nil)
 	// 3. Cache creation
-	// Use mock.MatchedBy to check the record content without knowing the ID/timestamps
-	mockRepo.On("CreateTranslation", mock.Anything, mock.MatchedBy(func(resp *models.TranslationResponse) bool {
-		return resp.Keyword == keyword && resp.Context == contextStr && resp.Translation == aiTranslation
-	})).Return(nil)
+	isRecord := mock.MatchedBy(func(resp *models.TranslationResponse) bool {
+		return resp.Text == text && resp.Selected == selected && resp.Translation == aiTranslation &&
+			resp.Prompt == "TranslateOnSelected" && resp.AIModel == "test-model"
+	})
+	ts.repo.On("CreateTranslation", mock.Anything, isRecord).Return(nil)
 
-	handler := handlers.NewAPIHandler(mockRepo, mockAI, mockMetrics, &cfg.Prompts)
-	router, w := setupTestRouter(handler)
+	_, router, w := ts.newHandler()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", text, selected), nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"`+aiTranslation+`","id":0,"candidate_id":0}`, w.Body.String())
 
-	req, _ := http.NewRequest(http.MethodGet, "/api/translate?keyword="+keyword+"&context="+contextStr, nil)
+	ts.repo.AssertExpectations(t)
+	ts.ai.AssertExpectations(t)
+	ts.assertMetric(t, "requests", "translate_selected", 1)
+	ts.assertMetric(t, "cache_hits", "translate", 0)
+}
+
+func TestAPIHandler_Translate_Deadline(t *testing.T) {
+	ts := newTestSetup()
+	ts.repo.On("FindTranslation", mock.Anything, "slow", "").Return(nil, nil)
+	ts.ai.On("Generate", mock.Anything, mock.Anything, []string{"slow"}).
+		Return("", fmt.Errorf("AI request failed: %w", context.DeadlineExceeded))
+
+	handler, router, w := ts.newHandler()
+	handler.Timeouts = config.TimeoutConfig{DefaultSeconds: 30, Roles: map[string]int{"translate": 5}}
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", "slow", ""), nil)
 	router.ServeHTTP(w, req)
 
-	// Assertions
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.AICancelledCounter.WithLabelValues("translate", "deadline")))
+	ts.repo.AssertNotCalled(t, "CreateTranslation", mock.Anything, mock.Anything)
+}
+
+func TestAPIHandler_Upload_Deadline(t *testing.T) {
+	hasDeadline := func(ctx context.Context) bool { _, ok := ctx.Deadline(); return ok }
+	ts := newTestSetup()
+	ts.ai.On("Generate", mock.MatchedBy(hasDeadline), mock.Anything, []string{"slow"}).
+		Return("", fmt.Errorf("AI request failed: %w", context.DeadlineExceeded))
+	ts.ai.On("Generate", mock.MatchedBy(func(ctx context.Context) bool { return !hasDeadline(ctx) }), mock.Anything, []string{"fast"}).
+		Return("formatted", nil)
+
+	handler, router, w := ts.newHandler()
+	handler.Timeouts = config.TimeoutConfig{DefaultSeconds: 30}
+	router.ServeHTTP(w, uploadRequest(t, "doc.txt", "slow", map[string]string{"role": "format"}))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	// 负数表示不限制
+	handler.Timeouts = config.TimeoutConfig{DefaultSeconds: -1}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "doc.txt", "fast", map[string]string{"role": "format"}))
 	assert.Equal(t, http.StatusOK, w.Code)
-	expectedBody := `{"result":"` + aiTranslation + `"}`
-	assert.JSONEq(t, expectedBody, w.Body.String())
+}
+
+func TestAPIHandler_Translate_FinishInBackground(t *testing.T) {
+	ts := newTestSetup()
+	started, release := make(chan struct{}), make(chan struct{})
+	ts.repo.On("FindTranslation", mock.Anything, "late", "").Return(nil, nil)
+	ts.ai.On("Generate", mock.Anything, mock.Anything, []string{"late"}).Return("迟到", nil).Run(func(mock.Arguments) {
+		close(started)
+		<-release
+	})
+	ts.repo.On("CreateTranslation", mock.Anything, mock.MatchedBy(func(r *models.TranslationResponse) bool {
+		return r.Translation == "迟到"
+	})).Return(nil)
 
-	mockRepo.AssertCalled(t, "FindTranslation", mock.Anything, keyword, contextStr)
-	mockAI.AssertCalled(t, "Generate", mock.Anything, cfg.Prompts.TranslateOnContext, []string{keyword, contextStr})
-	mockRepo.AssertCalled(t, "CreateTranslation", mock.Anything, mock.MatchedBy(func(resp *models.TranslationResponse) bool {
-		return resp.Keyword == keyword && resp.Context == contextStr && resp.Translation == aiTranslation
-	}))
+	handler, router, w := ts.newHandler()
+	handler.Timeouts = config.TimeoutConfig{DefaultSeconds: 30, BackgroundSeconds: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, apiURL("translate", "late", ""), nil)
+	served := make(chan struct{})
+	go func() {
+		router.ServeHTTP(w, req)
+		close(served)
+	}()
+
+	// 浏览器取消后请求立即结束, 生成在后台完成并写入缓存
+	<-started
+	cancel()
+	<-served
+	assert.Equal(t, 499, w.Code)
+	ts.repo.AssertNotCalled(t, "CreateTranslation", mock.Anything, mock.Anything)
+	close(release)
+	handler.Wait()
 
-	// Check counter metric (requires Prometheus test helpers or direct value check if possible)
-	// pcReq := testutil.ToFloat64(mockMetrics.TranslationCounter.WithLabelValues("translate_context"))
-	// assert.Equal(t, float64(1), pcReq)
-	// pcHit := testutil.ToFloat64(mockMetrics.TranslationCacheHitCounter.WithLabelValues("translate"))
-	// assert.Equal(t, float64(0), pcHit) // Cache miss
+	ts.repo.AssertExpectations(t)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.AIBackgroundCounter.WithLabelValues("completed")))
 }
 
 func TestAPIHandler_Translate_CacheMiss_AI_Fail(t *testing.T) {
-	mockRepo := new(MockRepository)
-	mockAI := new(MockAIClient)
-	mockMetricsRegistry := prometheus.NewRegistry()
-	mockMetrics := &metrics.Metrics{
-		TranslationCounter:         promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_reqs"}, []string{"type"}),
-		TranslationCacheHitCounter: promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_cache_hits"}, []string{"type"}),
-	}
+	ts := newTestSetup()
+	text := "fail"
+	prompt := ts.cfg.Prompts["TranslateOrFormat"]
+
+	ts.repo.On("FindTranslation", mock.Anything, text, "").Return(nil, nil)
+	ts.ai.On("Generate", mock.Anything, prompt, []string{text}).Return("", errors.New("AI service unreachable"))
+
+	_, router, w := ts.newHandler()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", text, ""), nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "AI service failed")
+
+	ts.ai.AssertExpectations(t)
+	ts.repo.AssertNotCalled(t, "CreateTranslation", mock.Anything, mock.Anything) // Should not cache on failure
+	ts.assertMetric(t, "requests", "translate", 1)
+}
+
+func TestAPIHandler_Translate_Regenerate(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	handler.Models = []string{"better-model"}
+	cached := &models.TranslationResponse{Text: "closure", Translation: "关闭"}
+	cached.ID = 3
+
+	ts.repo.On("FindTranslation", mock.Anything, "closure", "").Return(cached, nil)
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["TranslateOrFormat"], []string{"closure"}).Return("闭包", nil)
+	ts.repo.On("AddCandidate", mock.Anything, mock.MatchedBy(func(r *models.TranslationResponse) bool {
+		return r.ID == 3 && r.Translation == "闭包" && r.AIModel == "better-model"
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.TranslationResponse).CandidateID = 9
+	}).Return(nil)
+
+	// 不在允许列表中的模型
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", "closure", "")+"&regenerate=true&model=gpt-4", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, apiURL("translate", "closure", "")+"&regenerate=true&model=better-model", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"闭包","id":3,"candidate_id":9}`, w.Body.String())
 
-	cfg := &config.Config{
-		Prompts: config.PromptConfig{TranslateOrFormat: "Translate '{keyword}'"},
+	ts.repo.AssertExpectations(t)
+	ts.repo.AssertNotCalled(t, "CreateTranslation", mock.Anything, mock.Anything)
+	ts.assertMetric(t, "cache_hits", "translate", 0)
+}
+
+func TestAPIHandler_Format_Success(t *testing.T) {
+	ts := newTestSetup()
+	text := "some code snippet"
+	aiFormatted := "`some code snippet`"
+
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["format"], []string{text}).Return(aiFormatted, nil)
+
+	_, router, w := ts.newHandler()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("format", text, ""), nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"`+aiFormatted+`"}`, w.Body.String())
+
+	ts.ai.AssertExpectations(t)
+	ts.repo.AssertNotCalled(t, "FindTranslation", mock.Anything, mock.Anything, mock.Anything)
+	ts.assertMetric(t, "requests", "format", 1)
+}
+
+func TestAPIHandler_Clean_NoAI(t *testing.T) {
+	ts := newTestSetup()
+	_, router, w := ts.newHandler()
+
+	req, _ := http.NewRequest(http.MethodGet, apiURL("clean", "a won-\nderful  ﬁle ,see", ""), nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"a wonderful file, see"}`, w.Body.String())
+	ts.ai.AssertNotCalled(t, "Generate")
+	ts.assertMetric(t, "requests", "clean", 1)
+}
+
+func TestAPIHandler_Translate_CodeFormattedLocally(t *testing.T) {
+	ts := newTestSetup()
+	_, router, w := ts.newHandler()
+
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", `{"a":1}`, ""), nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "```json\n{\n  \"a\": 1\n}\n```", resp["result"])
+	ts.ai.AssertNotCalled(t, "Generate")
+	ts.repo.AssertNotCalled(t, "FindTranslation", mock.Anything, mock.Anything, mock.Anything)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.LocalFormatCounter.WithLabelValues("json")))
+}
+
+// dictRepo 是只读的内存词典
+type dictRepo []models.DictEntry
+
+func (r dictRepo) AddDictEntries(ctx context.Context, entries []models.DictEntry) error { return nil }
+func (r dictRepo) DeleteDictSource(ctx context.Context, source string) (int64, error)   { return 0, nil }
+func (r dictRepo) FindDictEntries(ctx context.Context, words []string) ([]models.DictEntry, error) {
+	var found []models.DictEntry
+	for _, e := range r {
+		for _, w := range words {
+			if e.Word == w {
+				found = append(found, e)
+			}
+		}
 	}
-	keyword := "fail"
+	return found, nil
+}
 
-	// Mock Interactions
-	// 1. Cache miss
-	mockRepo.On("FindTranslation", mock.Anything, keyword, "").Return(nil, nil)
-	// 2. AI call fails
-	aiError := errors.New("AI service unreachable")
-	mockAI.On("Generate", mock.Anything, cfg.Prompts.TranslateOrFormat, []string{keyword}).Return("", aiError)
+func TestAPIHandler_Translate_DictionaryHit(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, w := ts.newHandler()
+	handler.Dict = dict.New(dictRepo{{Word: "serendipity", POS: "n", Translation: "机缘巧合", Source: dict.SourceECDICT}})
 
-	handler := handlers.NewAPIHandler(mockRepo, mockAI, mockMetrics, &cfg.Prompts)
-	router, w := setupTestRouter(handler)
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", "serendipity", ""), nil)
+	router.ServeHTTP(w, req)
 
-	req, _ := http.NewRequest(http.MethodGet, "/api/translate?keyword="+keyword, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Result     string       `json:"result"`
+		Dictionary *dict.Result `json:"dictionary"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Contains(t, resp.Result, "机缘巧合")
+	if assert.NotNil(t, resp.Dictionary) {
+		assert.Equal(t, "serendipity", resp.Dictionary.Word)
+	}
+	ts.ai.AssertNotCalled(t, "Generate")
+	ts.repo.AssertNotCalled(t, "FindTranslation", mock.Anything, mock.Anything, mock.Anything)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.DictionaryLookupCounter.WithLabelValues("hit")))
+}
+
+func TestAPIHandler_Translate_DictionaryAskAI(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, w := ts.newHandler()
+	handler.Dict = dict.New(dictRepo{{Word: "serendipity", Translation: "机缘巧合", Source: dict.SourceECDICT}})
+	cached := &models.TranslationResponse{Text: "serendipity", Translation: "意外发现珍宝的运气"}
+	ts.repo.On("FindTranslation", mock.Anything, "serendipity", "").Return(cached, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", "serendipity", "")+"&ai=true", nil)
 	router.ServeHTTP(w, req)
 
-	// Assertions
-	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
-	assert.Contains(t, w.Body.String(), "AI service failed") // Check for user-friendly error
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "意外发现珍宝的运气")
+	assert.Equal(t, 0.0, testutil.ToFloat64(ts.metrics.DictionaryLookupCounter.WithLabelValues("hit")))
+}
 
-	mockRepo.AssertCalled(t, "FindTranslation", mock.Anything, keyword, "")
-	mockAI.AssertCalled(t, "Generate", mock.Anything, cfg.Prompts.TranslateOrFormat, []string{keyword})
-	mockRepo.AssertNotCalled(t, "CreateTranslation", mock.Anything, mock.Anything) // Should not cache on failure
+// senseRepo 是内存中的词义缓存
+type senseRepo map[string]*models.WordSense
 
-	// Check request counter incremented even on failure
-	// pcReq := testutil.ToFloat64(mockMetrics.TranslationCounter.WithLabelValues("translate"))
-	// assert.Equal(t, float64(1), pcReq)
+func (r senseRepo) FindWordSense(ctx context.Context, key string) (*models.WordSense, error) {
+	return r[key], nil
 }
 
-func TestAPIHandler_Translate_BadRequest_Binding(t *testing.T) {
-	// No mocks needed as binding happens before handlers
-	handler := handlers.NewAPIHandler(nil, nil, nil, nil) // Pass nil dependencies
-	router, w := setupTestRouter(handler)
+func (r senseRepo) SaveWordSense(ctx context.Context, record *models.WordSense) error {
+	r[record.Key] = record
+	return nil
+}
+
+func TestAPIHandler_Translate_Structured(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["WordSense"] = "Word sense"
+	handler, router, _ := ts.newHandler()
+	senses := senseRepo{}
+	handler.Senses = senses
+	text, selected := "She runs a small bakery.", "runs"
+	valid := `{"lemma":"run","pos":"verb","sense":"经营, 管理","translation":"经营","example":"He runs the family business.","notes":""}`
+	ts.ai.On("Generate", mock.Anything, "Word sense", []string{selected, text}).Return("Here is the JSON you asked for", nil).Once()
+	ts.ai.On("Generate", mock.Anything, "Word sense", []string{selected, text}).Return(valid, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, apiURL("translate", text, selected)+"&structured=true", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Result string       `json:"result"`
+			Sense  models.Sense `json:"sense"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "run", resp.Sense.Lemma)
+		assert.Equal(t, "verb", resp.Sense.POS)
+		assert.Contains(t, resp.Result, "经营")
+	}
+	ts.ai.AssertNumberOfCalls(t, "Generate", 2)
+	assert.Len(t, senses, 1)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.AIInvalidOutputCounter.WithLabelValues("translate_structured")))
+	ts.assertMetric(t, "cache_hits", "translate_structured", 1)
+}
+
+func TestAPIHandler_Translate_Structured_RequiresSelected(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["WordSense"] = "Word sense"
+	_, router, w := ts.newHandler()
 
-	// Send request with invalid param type (e.g., keyword as array)
-	req, _ := http.NewRequest(http.MethodGet, "/api/translate?keyword[]=a&keyword[]=b", nil)
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", "runs", "")+"&structured=true", nil)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Body.String(), "Missing required parameter: keyword")
+	ts.ai.AssertNotCalled(t, "Generate")
 }
 
-func TestAPIHandler_Format_Success(t *testing.T) {
-	mockRepo := new(MockRepository) // Repo not used by Format
-	mockAI := new(MockAIClient)
-	mockMetricsRegistry := prometheus.NewRegistry()
-	mockMetrics := &metrics.Metrics{
-		TranslationCounter: promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_reqs"}, []string{"type"}),
-		// Other metrics not directly used by Format
-	}
+// glossaryRepo 是内存中的术语表, 只支持测试用到的方法
+type glossaryRepo struct {
+	database.GlossaryRepository
+	glossaries map[string]*models.Glossary
+}
 
-	cfg := &config.Config{
-		Prompts: config.PromptConfig{Format: "Format '{keyword}'"},
+func (r *glossaryRepo) CreateGlossary(ctx context.Context, g *models.Glossary) error {
+	g.ID = uint(len(r.glossaries) + 1)
+	r.glossaries[g.Slug] = g
+	return nil
+}
+
+func (r *glossaryRepo) GetGlossary(ctx context.Context, slug string) (*models.Glossary, error) {
+	return r.glossaries[slug], nil
+}
+
+func (r *glossaryRepo) SaveGlossaryTerms(ctx context.Context, glossaryID uint, terms []models.GlossaryTerm) error {
+	for _, g := range r.glossaries {
+		if g.ID == glossaryID {
+			g.Terms = append(g.Terms, terms...)
+		}
 	}
-	keyword := "some code snippet"
-	aiFormatted := "`some code snippet`"
+	return nil
+}
 
-	// Mock Interactions
-	mockAI.On("Generate", mock.Anything, cfg.Prompts.Format, []string{keyword}).Return(aiFormatted, nil)
+func TestAPIHandler_Glossary(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	handler.Glossaries = &glossaryRepo{glossaries: map[string]*models.Glossary{}}
+	router.POST("/api/glossaries", handler.CreateGlossary)
+	router.POST("/api/glossaries/:id/import", handler.ImportGlossary)
 
-	handler := handlers.NewAPIHandler(mockRepo, mockAI, mockMetrics, &cfg.Prompts)
-	router, w := setupTestRouter(handler)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/glossaries", bytes.NewBufferString(`{"name":"Go book"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
 
-	req, _ := http.NewRequest(http.MethodGet, "/api/format?keyword="+url.QueryEscape(keyword), nil)
+	// 没有 token 不能修改
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/glossaries/"+created.ID+"/import", bytes.NewBufferString("closure,闭包\n"))
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/glossaries/"+created.ID+"/import", bytes.NewBufferString("source,target\nclosure,闭包\ngoroutine,协程\n"))
+	req.Header.Set("X-Glossary-Token", created.Token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"saved":2}`, w.Body.String())
 
-	// Assertions
+	// 缓存的结果不符合术语表, 带着术语重新生成, 结果不写入缓存
+	text := "A closure captures variables."
+	cached := &models.TranslationResponse{Text: text, Translation: "闭合函数会捕获变量。"}
+	ts.repo.On("FindTranslation", mock.Anything, text, "").Return(cached, nil)
+	ts.ai.On("Generate", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, "- closure → 闭包") && !strings.Contains(prompt, "goroutine")
+	}), []string{text}).Return("闭包会捕获变量。", nil).Once()
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, apiURL("translate", text, "")+"&glossary="+created.ID, nil)
+	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
-	expectedBody := `{"result":"` + aiFormatted + `"}`
-	assert.JSONEq(t, expectedBody, w.Body.String())
+	assert.JSONEq(t, `{"result":"闭包会捕获变量。","glossary_violations":[]}`, w.Body.String())
+	ts.repo.AssertNotCalled(t, "CreateTranslation", mock.Anything, mock.Anything)
+	ts.repo.AssertNotCalled(t, "AddCandidate", mock.Anything, mock.Anything)
 
-	mockAI.AssertCalled(t, "Generate", mock.Anything, cfg.Prompts.Format, []string{keyword})
+	// 生成的结果仍然不符合时标记出来
+	ts.ai.On("Generate", mock.Anything, mock.Anything, []string{text}).Return("闭合会捕获变量。", nil).Once()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, apiURL("translate", text, "")+"&glossary="+created.ID, nil)
+	router.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"result":"闭合会捕获变量。","glossary_violations":[{"source":"closure","target":"闭包"}]}`, w.Body.String())
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.GlossaryViolationCounter))
+}
 
-	// Check counter metric
-	pcReq := testutil.ToFloat64(mockMetrics.TranslationCounter.WithLabelValues("format"))
-	assert.Equal(t, float64(1), pcReq)
+// conversationRepo 是内存中的对话
+type conversationRepo struct {
+	database.ConversationRepository
+	convs map[string]*models.Conversation
 }
 
-func TestAPIHandler_Format_AI_Fail(t *testing.T) {
-	mockRepo := new(MockRepository)
-	mockAI := new(MockAIClient)
-	mockMetricsRegistry := prometheus.NewRegistry()
-	mockMetrics := &metrics.Metrics{
-		TranslationCounter: promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_reqs"}, []string{"type"}),
+func (r *conversationRepo) CreateConversation(ctx context.Context, conv *models.Conversation) error {
+	conv.ID = uint(len(r.convs) + 1)
+	r.convs[conv.Token] = conv
+	return nil
+}
+
+func (r *conversationRepo) GetConversation(ctx context.Context, token string) (*models.Conversation, error) {
+	return r.convs[token], nil
+}
+
+func (r *conversationRepo) AddConversationMessages(ctx context.Context, id uint, messages []models.ConversationMessage) error {
+	return nil
+}
+
+func TestAPIHandler_Conversation(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["analyze"] = "Analyze"
+	ts.cfg.Prompts["followup"] = "Follow up"
+	handler, router, _ := ts.newHandler()
+	handler.Conversations = conversation.New(&conversationRepo{convs: map[string]*models.Conversation{}},
+		config.ConversationConfig{MaxHistoryTokens: 1000, MaxQuestionLen: 100, MaxMessages: 10})
+	router.POST("/api/conversations", handler.CreateConversation)
+	router.POST("/api/conversations/:id/messages", handler.AskConversation)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/conversations",
+		bytes.NewBufferString(`{"role":"analyze","text":"Having finished, he left.","result":"分词短语作状语"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		ID string `json:"id"`
 	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	// MockAIClient 不支持多轮对话, 历史合并为一条消息发送
+	ts.ai.On("Generate", mock.Anything, "Analyze\n\nFollow up", mock.MatchedBy(func(texts []string) bool {
+		return len(texts) == 1 && strings.Contains(texts[0], "分词短语作状语") && strings.HasSuffix(texts[0], "[user]\n为什么用 having?")
+	})).Return("表示动作先于主句完成", nil)
 
-	cfg := &config.Config{
-		Prompts: config.PromptConfig{Format: "Format '{keyword}'"},
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/conversations/"+created.ID+"/messages",
+		bytes.NewBufferString(`{"question":"为什么用 having?"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"表示动作先于主句完成"`)
+	ts.assertMetric(t, "requests", "followup", 1)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/conversations/unknown/messages",
+		bytes.NewBufferString(`{"question":"?"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAPIHandler_Conversation_TooLong(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["analyze"] = "Analyze"
+	handler, router, _ := ts.newHandler()
+	handler.Conversations = conversation.New(&conversationRepo{convs: map[string]*models.Conversation{}},
+		config.ConversationConfig{MaxHistoryTokens: 50, MaxQuestionLen: 100, MaxTextLen: 300, MaxMessages: 10})
+	router.POST("/api/conversations", handler.CreateConversation)
+
+	// 原文和回答每次提问都会发送, 超过限制时不能创建对话
+	w := serve(router, http.MethodPost, "/api/conversations",
+		`{"role":"analyze","text":"Hello.","result":"`+strings.Repeat("a", 301)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = serve(router, http.MethodPost, "/api/conversations",
+		`{"role":"analyze","text":"`+strings.Repeat("word ", 50)+`","result":"ok"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	ts.ai.AssertNotCalled(t, "Generate")
+}
+
+func TestAPIHandler_Conversation_Moderation(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["analyze"] = "Analyze"
+	handler, router, _ := ts.newHandler()
+	blocklist, err := moderation.NewBlocklist([]string{"casino"})
+	require.NoError(t, err)
+	handler.AIClient = moderation.NewWith(ts.ai, ts.metrics, false, blocklist)
+	handler.Conversations = conversation.New(&conversationRepo{convs: map[string]*models.Conversation{}},
+		config.ConversationConfig{MaxHistoryTokens: 1000, MaxQuestionLen: 100, MaxMessages: 10})
+	router.POST("/api/conversations", handler.CreateConversation)
+
+	// 客户端提供的 result 没有经过 AI 调用, 同样要检查
+	w := serve(router, http.MethodPost, "/api/conversations", `{"role":"analyze","text":"Hello.","result":"best casino bonus"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	ts.ai.AssertNotCalled(t, "Generate")
+}
+
+func TestAPIHandler_Analyze_Structured(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["analyze_structured"] = "Analyze structured"
+	_, router, w := ts.newHandler()
+	text := "He left."
+	output := `{"structure":"simple","clauses":[{"type":"main","function":"","tokens":{"start":0,"end":2},
+		"elements":[{"type":"subject","function":"","tokens":{"start":0,"end":0}}]}],"phrases":[],
+		"arcs":[{"head":1,"dependent":0,"relation":"nsubj"}],"notes":""}`
+	ts.ai.On("Generate", mock.Anything, "Analyze structured", []string{text, "0:He 1:left 2:."}).Return(output, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, apiURL("analyze", text, "")+"&structured=true", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Analysis struct {
+			Clauses []struct {
+				Elements []struct {
+					Text string `json:"text"`
+					Span struct {
+						Start int `json:"start"`
+						End   int `json:"end"`
+					} `json:"span"`
+				} `json:"elements"`
+			} `json:"clauses"`
+		} `json:"analysis"`
 	}
-	keyword := "bad format"
-	aiError := errors.New("AI format error")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	subject := resp.Analysis.Clauses[0].Elements[0]
+	assert.Equal(t, "He", subject.Text)
+	assert.Equal(t, 2, subject.Span.End)
+	ts.assertMetric(t, "requests", "analyze_structured", 1)
+}
 
-	// Mock Interactions
-	mockAI.On("Generate", mock.Anything, cfg.Prompts.Format, []string{keyword}).Return("", aiError)
+func TestAPIHandler_Summarize_AI_Fail(t *testing.T) {
+	ts := newTestSetup()
+	text := "bad summary"
 
-	handler := handlers.NewAPIHandler(mockRepo, mockAI, mockMetrics, &cfg.Prompts)
-	router, w := setupTestRouter(handler)
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["summarize"], []string{text}).Return("", errors.New("AI summarize error"))
 
-	req, _ := http.NewRequest(http.MethodGet, "/api/format?keyword="+url.QueryEscape(keyword), nil)
+	_, router, w := ts.newHandler()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("summarize", text, ""), nil)
 	router.ServeHTTP(w, req)
 
-	// Assertions
 	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
-	assert.Contains(t, w.Body.String(), "AI service failed to format text")
+	assert.Contains(t, w.Body.String(), "AI service failed to process text")
+	ts.ai.AssertExpectations(t)
+}
 
-	mockAI.AssertCalled(t, "Generate", mock.Anything, cfg.Prompts.Format, []string{keyword})
-	// Check counter metric incremented
-	// pcReq := testutil.ToFloat64(mockMetrics.TranslationCounter.WithLabelValues("format"))
-	// assert.Equal(t, float64(1), pcReq)
+func TestAPIHandler_BudgetExhausted_ServesCacheOnly(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	handler.Budget = budget.New(config.BudgetConfig{Enabled: true}, ts.metrics)
+	handler.Budget.Trip()
+
+	// 缓存命中不受预算影响
+	cached := &models.TranslationResponse{Text: "hello", Translation: "你好"}
+	ts.repo.On("FindTranslation", mock.Anything, "hello", "").Return(cached, nil)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", "hello", ""), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 未命中缓存时拒绝调用 AI
+	ts.repo.On("FindTranslation", mock.Anything, "world", "").Return(nil, nil)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, apiURL("translate", "world", ""), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "budget exhausted")
+
+	ts.ai.AssertNotCalled(t, "Generate")
+	ts.assertMetric(t, "budget_rejected", "translate", 1)
 }
 
-func TestAPIHandler_Summarize_Success(t *testing.T) {
-	mockRepo := new(MockRepository) // Repo not used
-	mockAI := new(MockAIClient)
-	mockMetricsRegistry := prometheus.NewRegistry()
-	mockMetrics := &metrics.Metrics{
-		TranslationCounter: promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_reqs"}, []string{"type"}),
+func TestAdminHandler_RegenerateTranslation(t *testing.T) {
+	ts := newTestSetup()
+	api, _, _ := ts.newHandler()
+	admin := handlers.NewAdminHandler(api, nil)
+	router := gin.New()
+	router.POST("/admin/translations/:id/regenerate", admin.RegenerateTranslation)
+
+	stale := &models.TranslationResponse{Text: "closure", Translation: "关闭", Prompt: "TranslateOrFormat"}
+	stale.ID = 7
+	ts.repo.On("GetTranslation", mock.Anything, uint(7)).Return(stale, nil)
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["TranslateOrFormat"], []string{"closure"}).Return("闭包", nil)
+	ts.repo.On("AddCandidate", mock.Anything, mock.MatchedBy(func(r *models.TranslationResponse) bool {
+		return r.ID == 7 && r.Translation == "闭包" && r.AIModel == "test-model" && r.PromptHash != ""
+	})).Return(nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/admin/translations/7/regenerate", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	ts.repo.AssertExpectations(t)
+	ts.repo.AssertNotCalled(t, "FindTranslation", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// newAdminRouter 按 server.go 注册管理接口, 不包含鉴权
+func (ts *testSetup) newAdminRouter() *gin.Engine {
+	api, _, _ := ts.newHandler()
+	admin := handlers.NewAdminHandler(api, nil)
+	router := gin.New()
+	router.GET("/admin/translations", admin.SearchTranslations)
+	router.POST("/admin/translations/purge", admin.PurgeTranslations)
+	router.PUT("/admin/translations/:id", admin.UpdateTranslation)
+	router.DELETE("/admin/translations/:id", admin.DeleteTranslation)
+	router.GET("/admin/translations/:id/feedback", admin.ListFeedback)
+	router.GET("/admin/feedback/poor", admin.PoorlyRated)
+	router.DELETE("/admin/candidates/:id", admin.DeleteCandidate)
+	return router
+}
+
+func serve(router *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
 	}
+	router.ServeHTTP(w, req)
+	return w
+}
 
-	cfg := &config.Config{
-		Prompts: config.PromptConfig{Summarize: "Summarize '{keyword}'"},
+func TestAdminHandler_SearchTranslations(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	after := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	entry := models.TranslationResponse{Text: "closure", Translation: "闭包", CandidateID: 3,
+		Candidates: []models.TranslationCandidate{{Translation: "闭包", Upvotes: 2}}}
+	entry.ID, entry.Candidates[0].ID = 7, 3
+	ts.repo.On("SearchTranslations", mock.Anything, database.TranslationFilter{
+		Pattern: "clo%", After: after, Limit: 20, Offset: 40,
+	}).Return([]models.TranslationResponse{entry}, int64(41), nil)
+
+	w := serve(router, http.MethodGet, "/admin/translations?pattern=clo%25&after=2024-05-01&limit=20&offset=40", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Total int64 `json:"total"`
+		Items []struct {
+			ID          uint   `json:"id"`
+			Translation string `json:"translation"`
+			Upvotes     int    `json:"upvotes"`
+		} `json:"items"`
 	}
-	keyword := "a long text to summarize"
-	aiSummary := "short summary"
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(41), resp.Total)
+	require.Len(t, resp.Items, 1)
+	assert.Equal(t, uint(7), resp.Items[0].ID)
+	assert.Equal(t, "闭包", resp.Items[0].Translation)
+	assert.Equal(t, 2, resp.Items[0].Upvotes)
+
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodGet, "/admin/translations?before=yesterday", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodGet, "/admin/translations?limit=ten", "").Code)
+	ts.repo.AssertExpectations(t)
+}
 
-	// Mock Interactions
-	mockAI.On("Generate", mock.Anything, cfg.Prompts.Summarize, []string{keyword}).Return(aiSummary, nil)
+func TestAdminHandler_PurgeTranslations(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	ts.repo.On("PurgeTranslations", mock.Anything, database.TranslationFilter{}).
+		Return(int64(0), database.ErrEmptyFilter)
+	ts.repo.On("PurgeTranslations", mock.Anything, database.TranslationFilter{Pattern: "%casino%"}).
+		Return(int64(3), nil)
+
+	// 没有任何条件时拒绝清空整个缓存
+	w := serve(router, http.MethodPost, "/admin/translations/purge", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), database.ErrEmptyFilter.Error())
 
-	handler := handlers.NewAPIHandler(mockRepo, mockAI, mockMetrics, &cfg.Prompts)
-	router, w := setupTestRouter(handler)
+	w = serve(router, http.MethodPost, "/admin/translations/purge", `{"pattern": "%casino%"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted": 3}`, w.Body.String())
 
-	req, _ := http.NewRequest(http.MethodGet, "/api/summarize?keyword="+url.QueryEscape(keyword), nil)
-	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPost, "/admin/translations/purge", `{"after": "soon"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPost, "/admin/translations/purge", `not json`).Code)
+	ts.repo.AssertExpectations(t)
+}
 
-	// Assertions
+func TestAdminHandler_UpdateTranslation(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	entry := &models.TranslationResponse{Text: "closure", Translation: "关闭", AIModel: "test-model"}
+	entry.ID = 7
+	fixed := &models.TranslationResponse{Text: "closure", Translation: "闭包", CandidateID: 9}
+	fixed.ID = 7
+	ts.repo.On("GetTranslation", mock.Anything, uint(7)).Return(entry, nil).Once()
+	ts.repo.On("AddCandidate", mock.Anything, mock.MatchedBy(func(r *models.TranslationResponse) bool {
+		return r.ID == 7 && r.Translation == "闭包" && r.Prompt == "manual" && r.AIModel == ""
+	})).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.TranslationResponse).CandidateID = 9
+	})
+	ts.repo.On("PinCandidate", mock.Anything, uint(9), true).Return(nil)
+	ts.repo.On("GetTranslation", mock.Anything, uint(7)).Return(fixed, nil).Once()
+
+	w := serve(router, http.MethodPut, "/admin/translations/7", `{"translation": "闭包"}`)
 	assert.Equal(t, http.StatusOK, w.Code)
-	expectedBody := `{"result":"` + aiSummary + `"}`
-	assert.JSONEq(t, expectedBody, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"translation":"闭包"`)
+	ts.repo.AssertExpectations(t)
 
-	mockAI.AssertCalled(t, "Generate", mock.Anything, cfg.Prompts.Summarize, []string{keyword})
-	// Check counter metric
-	// pcReq := testutil.ToFloat64(mockMetrics.TranslationCounter.WithLabelValues("summarize"))
-	// assert.Equal(t, float64(1), pcReq)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPut, "/admin/translations/7", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPut, "/admin/translations/x", `{"translation": "闭包"}`).Code)
+	ts.repo.On("GetTranslation", mock.Anything, uint(8)).Return(nil, nil)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodPut, "/admin/translations/8", `{"translation": "闭包"}`).Code)
 }
 
-func TestAPIHandler_Summarize_AI_Fail(t *testing.T) {
-	mockRepo := new(MockRepository)
-	mockAI := new(MockAIClient)
-	mockMetricsRegistry := prometheus.NewRegistry()
-	mockMetrics := &metrics.Metrics{
-		TranslationCounter: promauto.With(mockMetricsRegistry).NewCounterVec(prometheus.CounterOpts{Name: "test_reqs"}, []string{"type"}),
+func TestAdminHandler_DeleteTranslation(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	entry := &models.TranslationResponse{Text: "closure"}
+	entry.ID = 7
+	ts.repo.On("GetTranslation", mock.Anything, uint(7)).Return(entry, nil)
+	ts.repo.On("GetTranslation", mock.Anything, uint(8)).Return(nil, nil)
+	ts.repo.On("DeleteTranslation", mock.Anything, uint(7)).Return(nil)
+
+	assert.Equal(t, http.StatusNoContent, serve(router, http.MethodDelete, "/admin/translations/7", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodDelete, "/admin/translations/8", "").Code)
+	ts.repo.AssertNumberOfCalls(t, "DeleteTranslation", 1)
+}
+
+func TestAdminHandler_DeleteCandidate(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	ts.repo.On("DeleteCandidate", mock.Anything, uint(3)).Return(nil)
+	ts.repo.On("DeleteCandidate", mock.Anything, uint(4)).Return(database.ErrNotFound)
+
+	assert.Equal(t, http.StatusNoContent, serve(router, http.MethodDelete, "/admin/candidates/3", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodDelete, "/admin/candidates/4", "").Code)
+}
+
+func TestAPIHandler_Feedback(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	router.POST("/api/feedback", handler.Feedback)
+	// 按客户端去重, 保存的是地址的哈希而不是地址本身
+	var voters []string
+	feedback := func(candidateID uint, rating int, comment string) any {
+		return mock.MatchedBy(func(f *models.Feedback) bool {
+			if f.CandidateID != candidateID || f.Rating != rating || f.Comment != comment {
+				return false
+			}
+			voters = append(voters, f.Voter)
+			return true
+		})
+	}
+	ts.repo.On("AddFeedback", mock.Anything, feedback(3, -1, "wrong")).Return(nil)
+	ts.repo.On("AddFeedback", mock.Anything, feedback(4, 1, "")).Return(nil)
+	ts.repo.On("AddFeedback", mock.Anything, feedback(99, 1, "")).Return(database.ErrNotFound)
+
+	w := serve(router, http.MethodPost, "/api/feedback", `{"candidate_id": 3, "rating": "down", "comment": "wrong"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/api/feedback", `{"candidate_id": 4, "rating": "up"}`).Code)
+
+	// 不存在的候选结果
+	w = serve(router, http.MethodPost, "/api/feedback", `{"candidate_id": 99, "rating": "up"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// rating 只能是 up 或 down, candidate_id 必填
+	for _, body := range []string{
+		`{"candidate_id": 3, "rating": "5"}`,
+		`{"candidate_id": 3, "rating": ""}`,
+		`{"candidate_id": 3}`,
+		`{"rating": "up"}`,
+		`{"candidate_id": -1, "rating": "up"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPost, "/api/feedback", body).Code, body)
 	}
-	cfg := &config.Config{
-		Prompts: config.PromptConfig{Summarize: "Summarize '{keyword}'"},
+	ts.repo.AssertNumberOfCalls(t, "AddFeedback", 3)
+	require.NotEmpty(t, voters)
+	assert.NotEmpty(t, voters[0])
+	assert.NotContains(t, voters[0], "192.0.2.1")
+	for _, v := range voters {
+		assert.Equal(t, voters[0], v, "同一客户端的投票使用相同的 voter")
 	}
-	keyword := "bad summary"
-	aiError := errors.New("AI summarize error")
+}
 
-	// Mock Interactions
-	mockAI.On("Generate", mock.Anything, cfg.Prompts.Summarize, []string{keyword}).Return("", aiError)
+func TestAdminHandler_PoorlyRated(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	worst := models.TranslationCandidate{Translation: "关闭", Upvotes: 1, Downvotes: 5,
+		Entry: &models.TranslationResponse{Text: "closure"}}
+	worst.ID = 3
+	bad := models.TranslationCandidate{Translation: "银行", Downvotes: 1}
+	bad.ID = 4
+	ts.repo.On("PoorlyRatedCandidates", mock.Anything, 2).Return([]models.TranslationCandidate{worst, bad}, nil)
+	ts.repo.On("PoorlyRatedCandidates", mock.Anything, 0).Return(nil, nil)
+
+	// 保持仓库返回的顺序, 最差的在前
+	w := serve(router, http.MethodGet, "/admin/feedback/poor?limit=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Items []struct {
+			ID        uint   `json:"id"`
+			Text      string `json:"text"`
+			Downvotes int    `json:"downvotes"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Items, 2)
+	assert.Equal(t, uint(3), resp.Items[0].ID)
+	assert.Equal(t, "closure", resp.Items[0].Text)
+	assert.Equal(t, 5, resp.Items[0].Downvotes)
+	assert.Equal(t, uint(4), resp.Items[1].ID)
+	assert.Empty(t, resp.Items[1].Text)
+
+	// 无效的 limit 交给仓库使用默认值
+	w = serve(router, http.MethodGet, "/admin/feedback/poor?limit=all", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items": []}`, w.Body.String())
+}
 
-	handler := handlers.NewAPIHandler(mockRepo, mockAI, mockMetrics, &cfg.Prompts)
-	router, w := setupTestRouter(handler)
+func TestAdminHandler_ListFeedback(t *testing.T) {
+	ts := newTestSetup()
+	router := ts.newAdminRouter()
+	entry := &models.TranslationResponse{Text: "closure"}
+	entry.ID = 7
+	down := models.Feedback{TranslationID: 7, CandidateID: 3, Rating: -1, Comment: "wrong"}
+	down.ID = 11
+	ts.repo.On("GetTranslation", mock.Anything, uint(7)).Return(entry, nil)
+	ts.repo.On("GetTranslation", mock.Anything, uint(8)).Return(nil, nil)
+	ts.repo.On("ListFeedback", mock.Anything, uint(7)).Return([]models.Feedback{down}, nil)
+
+	w := serve(router, http.MethodGet, "/admin/translations/7/feedback", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items": [{"id": 11, "candidate_id": 3, "rating": -1, "comment": "wrong",
+		"created_at": "0001-01-01T00:00:00Z"}]}`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/admin/translations/8/feedback", "").Code)
+}
+
+func uploadRequest(t *testing.T, filename, content string, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	_, _ = fw.Write([]byte(content))
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	assert.NoError(t, mw.Close())
+	req, _ := http.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestAPIHandler_Upload(t *testing.T) {
+	ts := newTestSetup()
+	_, router, w := ts.newHandler()
+	page := "<html><head><title>Doc</title></head><body><p>wonderful  <b>text</b></p></body></html>"
+
+	router.ServeHTTP(w, uploadRequest(t, "doc.html", page, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"format":"html","title":"Doc","text":"wonderful text"}`, w.Body.String())
+
+	// 指定 role 时对提取的文本执行该 role
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["format"], []string{"wonderful text"}).Return("formatted", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "doc.txt", "won-\nderful  text", map[string]string{"role": "format"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"formatted"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "image.png", "\x89PNG\r\n\x1a\n0000", nil))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestAPIHandler_Upload_TooLarge(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, w := ts.newHandler()
+	handler.MaxUploadBytes = 1024
+	page := "<html><body><p>" + strings.Repeat("wonderful text ", 10000) + "</p></body></html>"
+
+	// role 字段也在受限的请求体中, 读取它之前就应当限制大小
+	router.ServeHTTP(w, uploadRequest(t, "doc.html", page, map[string]string{"role": "format"}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	ts.ai.AssertNotCalled(t, "Generate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// audioRepo 是内存中的音频缓存
+type audioRepo map[string]*models.Audio
+
+func (r audioRepo) FindAudio(ctx context.Context, key string) (*models.Audio, error) {
+	return r[key], nil
+}
+
+func (r audioRepo) SaveAudio(ctx context.Context, record *models.Audio) error {
+	r[record.Key] = record
+	return nil
+}
+
+func TestAPIHandler_Speech(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	repo := audioRepo{}
+	handler.TTS = tts.New(tts.Local{}, repo, config.TTSConfig{Provider: "local", Voice: "alloy", MaxTextLen: 100}, ts.metrics)
+	router.GET("/api/tts", handler.Speech)
+
+	speak := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/tts?"+query, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := speak("text=" + url.QueryEscape("serendipity"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "audio/wav", w.Header().Get("Content-Type"))
+	assert.Equal(t, "miss", w.Header().Get("X-Cache"))
+	assert.Len(t, repo, 1)
+
+	// 超出预算时仍然返回缓存的音频
+	handler.Budget = budget.New(config.BudgetConfig{Enabled: true}, ts.metrics)
+	handler.Budget.Trip()
+	cached := speak("text=serendipity&voice=alloy")
+	assert.Equal(t, http.StatusOK, cached.Code)
+	assert.Equal(t, "hit", cached.Header().Get("X-Cache"))
+	assert.Equal(t, w.Body.Bytes(), cached.Body.Bytes())
+	assert.Equal(t, http.StatusTooManyRequests, speak("text=luck").Code)
+
+	assert.Equal(t, http.StatusBadRequest, speak("text=luck&voice=nova").Code)
+	assert.Equal(t, http.StatusBadRequest, speak("").Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.TTSRequestCounter.WithLabelValues("hit")))
+}
+
+// visionClient 在 MockAIClient 的基础上支持多部分消息, 图片总是识别为 text
+type visionClient struct {
+	*MockAIClient
+	text  string
+	calls int
+}
+
+func (c *visionClient) Chat(ctx context.Context, prompt string, messages []ai.Message) (string, error) {
+	c.calls++
+	return c.text, nil
+}
+
+// imageTextRepo 是内存中的图片文本缓存
+type imageTextRepo map[string]*models.ImageText
+
+func (r imageTextRepo) FindImageText(ctx context.Context, hash string) (*models.ImageText, error) {
+	return r[hash], nil
+}
+
+func (r imageTextRepo) SaveImageText(ctx context.Context, record *models.ImageText) error {
+	r[record.Hash] = record
+	return nil
+}
+
+func TestAPIHandler_ReadImage(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	handler.OCR = ocr.New(imageTextRepo{}, "OCR", "", ts.metrics)
+	router.POST("/api/ocr", handler.ReadImage)
+	image := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	read := func(content string, fields map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := uploadRequest(t, "page.png", content, fields)
+		req.URL.Path = "/api/ocr"
+		router.ServeHTTP(w, req)
+		return w
+	}
 
-	req, _ := http.NewRequest(http.MethodGet, "/api/summarize?keyword="+url.QueryEscape(keyword), nil)
+	// 不支持图片输入的客户端
+	assert.Equal(t, http.StatusNotImplemented, read(image, nil).Code)
+
+	client := &visionClient{MockAIClient: ts.ai, text: "wonderful text"}
+	handler.AIClient = client
+	w := read(image, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"text":"wonderful text","cached":false}`, w.Body.String())
+
+	// 识别结果按图片缓存, 再对文本执行 role
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["format"], []string{"wonderful text"}).Return("formatted", nil)
+	w = read(image, map[string]string{"role": "format"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"text":"wonderful text","cached":true,"result":"formatted"}`, w.Body.String())
+	assert.Equal(t, 1, client.calls)
+	ts.assertMetric(t, "cache_hits", "ocr", 1)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, read("plain text", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, read(image, map[string]string{"role": "unknown"}).Code)
+
+	// 超过大小限制的图片不会发给模型
+	handler.MaxUploadBytes = 1024
+	w = read(image+strings.Repeat("\x00", 4096), map[string]string{"role": "format", "selected": "text"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, 1, client.calls)
+}
+
+func TestAPIHandler_LanguageRouting(t *testing.T) {
+	ts := newTestSetup()
+	ts.cfg.Prompts["explain"] = "Explain"
+	ts.cfg.Prompts["TranslateOrFormat"] = "Translate {source_language} into {target_language}"
+	handler, router, _ := ts.newHandler()
+	handler.Language = config.LanguageConfig{
+		Target:        "zh",
+		MinConfidence: 0.6,
+		Routes:        []config.RouteRule{{Role: "translate", Source: "target", To: "explain"}},
+	}
+
+	// 已经是目标语言的文本改为解释
+	zh := "这个句子已经是中文了，不需要再翻译。"
+	ts.ai.On("Generate", mock.Anything, "Explain", []string{zh}).Return("解释", nil).Once()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, apiURL("translate", zh, ""), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"解释","routed_from":"translate",
+		"language":{"lang":"zh","name":"Chinese","confidence":1}}`, w.Body.String())
+	ts.repo.AssertNotCalled(t, "FindTranslation", mock.Anything, mock.Anything, mock.Anything)
+
+	// 其他语言照常翻译, 检测结果用于渲染 prompt
+	en := "The quick brown fox jumps over the lazy dog while the children are watching."
+	ts.repo.On("FindTranslation", mock.Anything, en, "").Return(nil, nil).Once()
+	ts.repo.On("CreateTranslation", mock.Anything, mock.Anything).Return(nil).Once()
+	ts.ai.On("Generate", mock.Anything, "Translate English (en) into Chinese", []string{en}).Return("翻译", nil).Once()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, apiURL("translate", en, ""), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Result   string            `json:"result"`
+		Language langdetect.Result `json:"language"`
+		Routed   *string           `json:"routed_from"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "翻译", resp.Result)
+	assert.Equal(t, "en", resp.Language.Lang)
+	assert.Nil(t, resp.Routed)
+
+	// Target 为空时不检测也不路由
+	handler.Language.Target = ""
+	ts.repo.On("FindTranslation", mock.Anything, zh, "").Return(&models.TranslationResponse{Translation: "缓存"}, nil).Once()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, apiURL("translate", zh, ""), nil)
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "routed_from")
+	assert.NotContains(t, w.Body.String(), `"language"`)
+	ts.ai.AssertExpectations(t)
+}
 
-	// Assertions
-	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
-	assert.Contains(t, w.Body.String(), "AI service failed to summarize text")
+func TestAPIHandler_ModerationBlocked(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, w := ts.newHandler()
+	blocklist, err := moderation.NewBlocklist([]string{"casino"})
+	assert.NoError(t, err)
+	handler.AIClient = moderation.NewWith(ts.ai, ts.metrics, false, blocklist)
+
+	req, _ := http.NewRequest(http.MethodGet, apiURL("format", "best casino bonus", ""), nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"Text was blocked by moderation","code":"moderation_blocked"}`, w.Body.String())
+	ts.ai.AssertNotCalled(t, "Generate")
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.ModerationBlockedCounter.WithLabelValues("format", "blocklist")))
+}
+
+// fakeReporter 记录上报的错误
+type fakeReporter struct {
+	reporting.Nop
+	tags []map[string]string
+}
+
+func (r *fakeReporter) CaptureError(ctx context.Context, err error, tags map[string]string) {
+	r.tags = append(r.tags, tags)
+}
+
+func TestAPIHandler_AIMetrics(t *testing.T) {
+	ts := newTestSetup()
+	handler, router, _ := ts.newHandler()
+	reporter := &fakeReporter{}
+	handler.Reporter = reporter
+	rateLimited := &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "slow down"}
+	ts.ai.On("Generate", mock.Anything, "Format", []string{"limited"}).Return("", rateLimited)
+	ts.ai.On("Generate", mock.Anything, "Format", []string{"empty"}).Return("", nil)
+
+	for _, text := range []string{"limited", "empty"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, apiURL("format", text, ""), nil)
+		router.ServeHTTP(w, req)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+	}
 
-	mockAI.AssertCalled(t, "Generate", mock.Anything, cfg.Prompts.Summarize, []string{keyword})
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.AIErrorCounter.WithLabelValues("format", "test-model", "rate_limited")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.AIEmptyResponseCounter.WithLabelValues("format", "test-model")))
+	assert.Equal(t, 2, testutil.CollectAndCount(ts.metrics.AIRequestDuration))
+	assert.Equal(t, []map[string]string{{"role": "format", "model": "test-model", "error_class": "rate_limited"}}, reporter.tags)
+}
+
+func TestAPIHandler_Translate_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = tp.Shutdown(context.Background())
+	})
+
+	ts := newTestSetup()
+	text := "hello"
+	ts.repo.On("FindTranslation", mock.Anything, text, "").Return(nil, nil)
+	ts.ai.On("Generate", mock.Anything, ts.cfg.Prompts["TranslateOrFormat"], []string{text}).Return("你好", nil)
+	ts.repo.On("CreateTranslation", mock.Anything, mock.Anything).Return(errors.New("disk full"))
+
+	_, router, w := ts.newHandler()
+	ctx, root := tp.Tracer("test").Start(context.Background(), "request")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, apiURL("translate", text, ""), nil)
+	router.ServeHTTP(w, req)
+	root.End()
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+		if s.Name() != "request" {
+			assert.Equal(t, root.SpanContext().TraceID(), s.SpanContext().TraceID(), s.Name())
+		}
+	}
+	attrs := func(name string) map[attribute.Key]attribute.Value {
+		require.Contains(t, spans, name)
+		m := map[attribute.Key]attribute.Value{}
+		for _, kv := range spans[name].Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+	assert.False(t, attrs("cache.lookup")["cache.hit"].AsBool())
+	assert.Equal(t, "test-model", attrs("ai.generate")["gen_ai.request.model"].AsString())
+	assert.Equal(t, "translate", attrs("ai.generate")["app.role"].AsString())
+	assert.Contains(t, attrs("ai.generate"), attribute.Key("gen_ai.usage.input_tokens"))
+	assert.Equal(t, "translation", attrs("cache.write")["cache.type"].AsString())
+	assert.Equal(t, codes.Error, spans["cache.write"].Status().Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(ts.metrics.CacheWriteFailureCounter.WithLabelValues("translation")))
 }
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/batch"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+type batchJobView struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Total     int       `json:"total"`
+	Done      int       `json:"done"`
+	Failed    int       `json:"failed"`
+	Progress  float64   `json:"progress"` // 0 ~ 1
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newBatchJobView(j *models.BatchJob) batchJobView {
+	v := batchJobView{
+		ID:        j.ID,
+		Name:      j.Name,
+		Status:    j.Status,
+		Error:     j.Error,
+		Total:     j.Total,
+		Done:      j.Done,
+		Failed:    j.Failed,
+		Progress:  1,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+	if j.Total > 0 {
+		v.Progress = float64(j.Done+j.Failed) / float64(j.Total)
+	}
+	return v
+}
+
+// SubmitBatch 提交一个文档, 在后台预翻译其中的句子和术语.
+func (h *AdminHandler) SubmitBatch(c *gin.Context) {
+	var body struct {
+		Name  string `json:"name"`
+		Text  string `json:"text" binding:"required"`
+		Terms bool   `json:"terms"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: text"})
+		return
+	}
+	h.submitBatch(c, body.Name, body.Text, body.Terms)
+}
+
+// UploadBatch 从上传的 PDF, EPUB 或 HTML 文件中提取文本并提交批量预翻译任务.
+func (h *AdminHandler) UploadBatch(c *gin.Context) {
+	doc, ok := readUpload(c, h.API.MaxUploadBytes)
+	if !ok {
+		return
+	}
+	name := c.PostForm("name")
+	if name == "" {
+		name = doc.Title
+	}
+	h.submitBatch(c, name, doc.Text, c.PostForm("terms") == "true")
+}
+
+func (h *AdminHandler) submitBatch(c *gin.Context, name, text string, terms bool) {
+	job, err := h.Batch.Submit(c.Request.Context(), name, text, terms)
+	if errors.Is(err, batch.ErrTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error submitting batch job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error creating batch job"})
+		return
+	}
+	c.JSON(http.StatusAccepted, newBatchJobView(job))
+}
+
+func (h *AdminHandler) ListBatches(c *gin.Context) {
+	jobs, err := h.Jobs.ListBatchJobs(c.Request.Context(), 0)
+	if err != nil {
+		log.Printf("Error listing batch jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error listing batch jobs"})
+		return
+	}
+	items := make([]batchJobView, len(jobs))
+	for i := range jobs {
+		items[i] = newBatchJobView(&jobs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// loadBatch 读取路径参数 id 对应的任务, 失败时已写入响应.
+func (h *AdminHandler) loadBatch(c *gin.Context) (*models.BatchJob, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return nil, false
+	}
+	job, err := h.Jobs.GetBatchJob(c.Request.Context(), uint(id))
+	if err != nil {
+		log.Printf("Error loading batch job %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading batch job"})
+		return nil, false
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Batch job not found"})
+		return nil, false
+	}
+	return job, true
+}
+
+// BatchStatus 返回任务的进度.
+func (h *AdminHandler) BatchStatus(c *gin.Context) {
+	job, ok := h.loadBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newBatchJobView(job))
+}
+
+// ResumeBatch 恢复因预算耗尽等原因暂停的任务.
+func (h *AdminHandler) ResumeBatch(c *gin.Context) {
+	job, ok := h.loadBatch(c)
+	if !ok {
+		return
+	}
+	if job.Status != models.StatusPaused {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paused batch jobs can be resumed"})
+		return
+	}
+	if err := h.Batch.Resume(c.Request.Context(), job.ID); err != nil {
+		log.Printf("Error resuming batch job %d: %v", job.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error resuming batch job"})
+		return
+	}
+	job.Status = models.StatusPending
+	c.JSON(http.StatusAccepted, newBatchJobView(job))
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/conversation"
+	"github.com/zzhirong/contextdict/internal/models"
+	"github.com/zzhirong/contextdict/internal/moderation"
+)
+
+type conversationView struct {
+	ID        string                       `json:"id"`
+	Role      string                       `json:"role"`
+	Messages  []models.ConversationMessage `json:"messages"`
+	CreatedAt time.Time                    `json:"created_at"`
+}
+
+func newConversationView(conv *models.Conversation) conversationView {
+	return conversationView{ID: conv.Token, Role: conv.Role, Messages: conv.Messages, CreatedAt: conv.CreatedAt}
+}
+
+// CreateConversation 开始一个可以追问的对话. result 是前端已经显示的回答,
+// 为空时先按 role 处理 text.
+func (h *APIHandler) CreateConversation(c *gin.Context) {
+	var body struct {
+		Role     string `json:"role" binding:"required"`
+		Text     string `json:"text" binding:"required"`
+		Selected string `json:"selected"`
+		Result   string `json:"result"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields: role, text"})
+		return
+	}
+	if !h.validRole(body.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	ctx := c.Request.Context()
+	answer := body.Result
+	if m, ok := h.AIClient.(*moderation.Client); ok && answer != "" {
+		// 没有经过 AI 调用的文本也要检查, 之后的追问会把它们发给模型
+		if err := m.Check(ai.WithRole(ctx, body.Role), body.Text, body.Selected, answer); err != nil {
+			abortOnAIError(c, err, "Text was rejected")
+			return
+		}
+	}
+	if answer == "" {
+		var err error
+		if answer, err = h.Process(ctx, body.Role, body.Text, body.Selected); err != nil {
+			log.Printf("AI generation failed for %s text='%s': %v", body.Role, body.Text, err)
+			abortOnAIError(c, err, "AI service failed to process text")
+			return
+		}
+	}
+	conv, err := h.Conversations.Create(ctx, body.Role, body.Text, body.Selected, answer)
+	if errors.Is(err, conversation.ErrTextTooLong) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating conversation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error creating conversation"})
+		return
+	}
+	c.JSON(http.StatusCreated, newConversationView(conv))
+}
+
+// GetConversation 返回对话的所有消息.
+func (h *APIHandler) GetConversation(c *gin.Context) {
+	conv, ok := h.loadConversation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newConversationView(conv))
+}
+
+// DeleteConversation 删除对话和所有消息.
+func (h *APIHandler) DeleteConversation(c *gin.Context) {
+	conv, ok := h.loadConversation(c)
+	if !ok {
+		return
+	}
+	if err := h.Conversations.Delete(c.Request.Context(), conv); err != nil {
+		log.Printf("Error deleting conversation %s: %v", conv.Token, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting conversation"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "ok"})
+}
+
+// AskConversation 结合原文和对话历史回答追问.
+func (h *APIHandler) AskConversation(c *gin.Context) {
+	var body struct {
+		Question string `json:"question" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: question"})
+		return
+	}
+	conv, ok := h.loadConversation(c)
+	if !ok {
+		return
+	}
+	h.Metrics.TranslationCounter.WithLabelValues("followup").Inc()
+	setLabels(c, conv.Role, h.AIClient.Model())
+	defer h.withDeadline(c, conv.Role)()
+	prompt := h.followupPrompt(conv)
+	answer, err := h.Conversations.Ask(c.Request.Context(), conv, body.Question,
+		func(ctx context.Context, messages []ai.Message) (string, error) {
+			return h.chat(ctx, conv.Role, prompt, messages)
+		})
+	switch {
+	case errors.Is(err, conversation.ErrTooLong):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, conversation.ErrTooManyMessages):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Follow-up failed for conversation %s: %v", conv.Token, err)
+		abortOnAIError(c, err, "AI service failed to answer the question")
+		return
+	}
+	c.JSON(http.StatusOK, answer)
+}
+
+func (h *APIHandler) loadConversation(c *gin.Context) (*models.Conversation, bool) {
+	conv, err := h.Conversations.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Error loading conversation %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading conversation"})
+		return nil, false
+	}
+	if conv == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+	return conv, true
+}
+
+// followupPrompt 是对话最初使用的 prompt 加上追问的说明
+func (h *APIHandler) followupPrompt(conv *models.Conversation) string {
+	prompt := h.Prompts[conv.Role]
+	switch {
+	case conv.Role == "translate" && conv.Selected != "":
+		prompt = h.Prompts["TranslateOnSelected"]
+	case conv.Role == "translate":
+		prompt = h.Prompts["TranslateOrFormat"]
+	}
+	if followup := h.Prompts["followup"]; followup != "" {
+		prompt += "\n\n" + followup
+	}
+	return prompt
+}
+
+// chat 与 generate 相同, 但发送多轮对话的历史.
+func (h *APIHandler) chat(ctx context.Context, role, prompt string, messages []ai.Message) (string, error) {
+	if err := h.Budget.Allow(role); err != nil {
+		return "", err
+	}
+	usage := &ai.Usage{}
+	ctx = ai.WithRole(ai.WithUsage(ctx, usage), role)
+	ctx, span := tracer.Start(ctx, "ai.chat")
+	defer span.End()
+	start := time.Now()
+	result, err := ai.Chat(ctx, h.AIClient, h.renderPrompt(ctx, prompt), messages)
+	h.Budget.Record(role, usage.Total())
+	h.observeAI(ctx, role, start, usage, result, err)
+	return result, err
+}
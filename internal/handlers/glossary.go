@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/glossary"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// glossaryTokenHeader 携带创建术语表时返回的 token, 修改术语表时需要
+const glossaryTokenHeader = "X-Glossary-Token"
+
+// maxGlossaryCSVBytes 限制导入的 CSV 文件和术语请求体的大小
+const maxGlossaryCSVBytes = 2 << 20
+
+type glossaryView struct {
+	ID    string                `json:"id"`
+	Name  string                `json:"name"`
+	Owner string                `json:"owner"`
+	Token string                `json:"token,omitempty"` // 只在创建时返回
+	Terms []models.GlossaryTerm `json:"terms"`
+}
+
+func newGlossaryView(g *models.Glossary) glossaryView {
+	terms := g.Terms
+	if terms == nil {
+		terms = []models.GlossaryTerm{}
+	}
+	return glossaryView{ID: g.Slug, Name: g.Name, Owner: g.Owner, Terms: terms}
+}
+
+type glossaryRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Owner string `json:"owner"`
+}
+
+type termRequest struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Note   string `json:"note"`
+}
+
+// CreateGlossary 创建术语表, 返回的 token 用于之后修改术语表.
+func (h *APIHandler) CreateGlossary(c *gin.Context) {
+	var req glossaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: name"})
+		return
+	}
+	slug, token, err := glossary.NewCredentials()
+	if err != nil {
+		log.Printf("Error generating glossary token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating glossary"})
+		return
+	}
+	g := &models.Glossary{Slug: slug, TokenHash: glossary.HashToken(token), Name: req.Name, Owner: req.Owner}
+	if err := h.Glossaries.CreateGlossary(c.Request.Context(), g); err != nil {
+		log.Printf("Error creating glossary: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error creating glossary"})
+		return
+	}
+	view := newGlossaryView(g)
+	view.Token = token
+	c.JSON(http.StatusCreated, view)
+}
+
+// GetGlossary 返回术语表和所有术语.
+func (h *APIHandler) GetGlossary(c *gin.Context) {
+	g, ok := h.loadGlossary(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newGlossaryView(g))
+}
+
+// UpdateGlossary 修改术语表的名称和所有者.
+func (h *APIHandler) UpdateGlossary(c *gin.Context) {
+	g, ok := h.loadGlossary(c, true)
+	if !ok {
+		return
+	}
+	var req glossaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: name"})
+		return
+	}
+	g.Name, g.Owner = req.Name, req.Owner
+	if err := h.Glossaries.UpdateGlossary(c.Request.Context(), g); err != nil {
+		log.Printf("Error updating glossary %s: %v", g.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating glossary"})
+		return
+	}
+	c.JSON(http.StatusOK, newGlossaryView(g))
+}
+
+// DeleteGlossary 删除术语表和所有术语.
+func (h *APIHandler) DeleteGlossary(c *gin.Context) {
+	g, ok := h.loadGlossary(c, true)
+	if !ok {
+		return
+	}
+	if err := h.Glossaries.DeleteGlossary(c.Request.Context(), g.ID); err != nil {
+		log.Printf("Error deleting glossary %s: %v", g.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting glossary"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "ok"})
+}
+
+// SaveGlossaryTerms 添加术语, 已有的术语被替换. 请求体为单个术语或术语数组.
+func (h *APIHandler) SaveGlossaryTerms(c *gin.Context) {
+	g, ok := h.loadGlossary(c, true)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxGlossaryCSVBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading request body"})
+		return
+	}
+	var reqs []termRequest
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		reqs = make([]termRequest, 1)
+		err = json.Unmarshal(body, &reqs[0])
+	}
+	if err == nil {
+		for _, req := range reqs {
+			if strings.TrimSpace(req.Source) == "" || strings.TrimSpace(req.Target) == "" {
+				err = errors.New("missing source or target")
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term: source and target are required"})
+		return
+	}
+	terms := make([]models.GlossaryTerm, len(reqs))
+	for i, req := range reqs {
+		terms[i] = models.GlossaryTerm{
+			Source: strings.TrimSpace(req.Source),
+			Target: strings.TrimSpace(req.Target),
+			Note:   strings.TrimSpace(req.Note),
+		}
+	}
+	h.saveTerms(c, g, terms)
+}
+
+// ImportGlossary 从 CSV (source,target[,note]) 导入术语, 文件可以作为请求体或 file 字段上传.
+func (h *APIHandler) ImportGlossary(c *gin.Context) {
+	g, ok := h.loadGlossary(c, true)
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxGlossaryCSVBytes)
+	var r io.Reader = c.Request.Body
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading uploaded file"})
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+	terms, err := glossary.ReadCSV(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Uploaded file is too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+		return
+	}
+	h.saveTerms(c, g, terms)
+}
+
+func (h *APIHandler) saveTerms(c *gin.Context, g *models.Glossary, terms []models.GlossaryTerm) {
+	if err := h.Glossaries.SaveGlossaryTerms(c.Request.Context(), g.ID, terms); err != nil {
+		log.Printf("Error saving terms of glossary %s: %v", g.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error saving terms"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"saved": len(terms)})
+}
+
+// DeleteGlossaryTerm 删除一个术语.
+func (h *APIHandler) DeleteGlossaryTerm(c *gin.Context) {
+	g, ok := h.loadGlossary(c, true)
+	if !ok {
+		return
+	}
+	termID, err := strconv.ParseUint(c.Param("term_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term id"})
+		return
+	}
+	err = h.Glossaries.DeleteGlossaryTerm(c.Request.Context(), g.ID, uint(termID))
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Term not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting term %d of glossary %s: %v", termID, g.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting term"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "ok"})
+}
+
+// loadGlossary 读取 :id 对应的术语表, write 为 true 时检查请求携带的 token.
+func (h *APIHandler) loadGlossary(c *gin.Context, write bool) (*models.Glossary, bool) {
+	g, err := h.Glossaries.GetGlossary(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Error loading glossary %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading glossary"})
+		return nil, false
+	}
+	if g == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Glossary not found"})
+		return nil, false
+	}
+	if write {
+		hash := glossary.HashToken(c.GetHeader(glossaryTokenHeader))
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(g.TokenHash)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid glossary token"})
+			return nil, false
+		}
+	}
+	return g, true
+}
+
+// glossaryTerms 返回请求指定的术语表中出现在 text 里的术语, 没有指定术语表时返回 nil.
+func (h *APIHandler) glossaryTerms(c *gin.Context, slug, text string) ([]models.GlossaryTerm, bool) {
+	if slug == "" {
+		return nil, true
+	}
+	if h.Glossaries == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Glossaries are not enabled"})
+		return nil, false
+	}
+	g, err := h.Glossaries.GetGlossary(c.Request.Context(), slug)
+	if err != nil {
+		log.Printf("Error loading glossary %s: %v", slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading glossary"})
+		return nil, false
+	}
+	if g == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Glossary not found"})
+		return nil, false
+	}
+	return glossary.Match(g.Terms, text), true
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/jobs"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+type jobView struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status"`
+	Result    string    `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newJobView(j *models.Job) jobView {
+	return jobView{
+		ID:        j.Token,
+		Role:      j.Role,
+		Status:    j.Status,
+		Result:    j.Result,
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+}
+
+// SubmitJob 提交一个异步任务, 用于处理时间可能超过请求超时的长文本.
+func (h *APIHandler) SubmitJob(c *gin.Context) {
+	var body struct {
+		Role     string `json:"role" binding:"required"`
+		Text     string `json:"text" binding:"required"`
+		Selected string `json:"selected"`
+		Webhook  string `json:"webhook"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields: role, text"})
+		return
+	}
+	if !h.validRole(body.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	h.submitJob(c, body.Role, body.Text, body.Selected, body.Webhook)
+}
+
+func (h *APIHandler) submitJob(c *gin.Context, role, text, selected, webhook string) {
+	job, err := h.Jobs.Submit(c.Request.Context(), role, text, selected, webhook)
+	switch {
+	case errors.Is(err, jobs.ErrTooLong):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, jobs.ErrWebhookDisabled), errors.Is(err, jobs.ErrInvalidWebhook),
+		errors.Is(err, jobs.ErrWebhookAddress):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error submitting job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error submitting job"})
+		return
+	}
+	c.JSON(http.StatusAccepted, newJobView(job))
+}
+
+// GetJob 返回任务的状态, 完成后包含结果.
+func (h *APIHandler) GetJob(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newJobView(job))
+}
+
+func (h *APIHandler) loadJob(c *gin.Context) (*models.Job, bool) {
+	job, err := h.Jobs.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Error loading job %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading job"})
+		return nil, false
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return nil, false
+	}
+	return job, true
+}
+
+// JobEvents 以 Server-Sent Events 推送任务状态的变化, 任务结束后关闭连接.
+func (h *APIHandler) JobEvents(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// 服务器的 WriteTimeout 对长连接太短, 每次写入前延长
+	rc := http.NewResponseController(c.Writer)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		if job.Status != last {
+			_ = rc.SetWriteDeadline(time.Now().Add(time.Minute))
+			c.SSEvent("status", newJobView(job))
+			c.Writer.Flush()
+			last = job.Status
+		}
+		if job.Finished() {
+			return
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		next, err := h.Jobs.Get(c.Request.Context(), job.Token)
+		if err != nil || next == nil {
+			return
+		}
+		job = next
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/codefmt"
+	"github.com/zzhirong/contextdict/internal/langdetect"
+)
+
+// 保存在 gin.Context 中, 由 respond 加入响应
+const (
+	languageKey   = "language"
+	routedFromKey = "routed_from"
+)
+
+// codeLanguage 是代码的 "语言", 路由规则中用 "code" 匹配
+var codeLanguage = langdetect.Result{Lang: "code", Name: "Code", Confidence: 1}
+
+// detectLanguage 检测 text 的语言, 代码不按自然语言检测.
+func detectLanguage(text string) langdetect.Result {
+	if codefmt.Detect(text) != "" {
+		return codeLanguage
+	}
+	return langdetect.Detect(text)
+}
+
+type languageCtxKey struct{}
+
+// route 检测输入的语言, 按配置的规则改变 q.Role. 检测结果用于渲染 prompt
+// 并在响应中返回. Language.Target 为空时不检测.
+func (h *APIHandler) route(c *gin.Context, q *query) {
+	if h.Language.Target == "" {
+		return
+	}
+	lang := detectLanguage(q.Text)
+	c.Set(languageKey, lang)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), languageCtxKey{}, lang))
+	if lang.Confidence < h.Language.MinConfidence {
+		return
+	}
+	for _, r := range h.Language.Routes {
+		source := r.Source
+		if source == "target" {
+			source = h.Language.Target
+		}
+		if r.Role != q.Role || source != lang.Lang || !h.validRole(r.To) {
+			continue
+		}
+		log.Printf("Routing %s to %s for text in %s", q.Role, r.To, lang.Name)
+		c.Set(routedFromKey, q.Role)
+		q.Role = r.To
+		return
+	}
+}
+
+// renderPrompt 替换 prompt 中的 {source_language} 和 {target_language}.
+func (h *APIHandler) renderPrompt(ctx context.Context, prompt string) string {
+	if !strings.Contains(prompt, "_language}") {
+		return prompt
+	}
+	source, ok := ctx.Value(languageCtxKey{}).(langdetect.Result)
+	if !ok {
+		source = langdetect.Result{Lang: langdetect.Unknown, Name: langdetect.Names[langdetect.Unknown]}
+	}
+	target := h.Language.Target
+	if name, ok := langdetect.Names[target]; ok {
+		target = name
+	}
+	return strings.NewReplacer(
+		"{source_language}", source.Name+" ("+source.Lang+")",
+		"{target_language}", target,
+	).Replace(prompt)
+}
+
+// respond 返回 body, 并加上检测到的语言和路由前的 role.
+func respond(c *gin.Context, code int, body gin.H) {
+	if lang, ok := c.Get(languageKey); ok {
+		body[languageKey] = lang
+	}
+	if role, ok := c.Get(routedFromKey); ok {
+		body[routedFromKey] = role
+	}
+	c.JSON(code, body)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/guard"
+	"github.com/zzhirong/contextdict/internal/metrics"
+	"github.com/zzhirong/contextdict/internal/moderation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setLabels 设置请求指标的 role 和 model, 只能传入校验过的值. 它们也作为属性
+// 加到请求的 span 上.
+func setLabels(c *gin.Context, role, model string) {
+	metrics.LabelsFrom(c.Request.Context()).Set(role, model)
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(
+		attribute.String("app.role", role), attribute.String("app.model", model))
+}
+
+// observeAI 记录一次 AI 调用的耗时, 错误类别和空结果, 并把 model 和 token
+// 数加到 ctx 中的 span 上.
+func (h *APIHandler) observeAI(ctx context.Context, role string, start time.Time, usage *ai.Usage, result string, err error) {
+	h.observeCancel(ctx, role, err)
+	model := ai.ModelFromContext(ctx, h.AIClient.Model())
+	promptTokens, completionTokens := usage.Tokens()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("app.role", role),
+		attribute.String("gen_ai.request.model", model),
+		attribute.Int("gen_ai.usage.input_tokens", promptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", completionTokens),
+	)
+	status := "ok"
+	switch {
+	case err != nil:
+		status = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		class := errorClass(err)
+		h.Metrics.AIErrorCounter.WithLabelValues(role, model, class).Inc()
+		// 取消和被拒绝的输入是用户造成的, 不上报
+		if class != "cancelled" && class != "moderation" {
+			h.Reporter.CaptureError(ctx, err, map[string]string{"role": role, "model": model, "error_class": class})
+		}
+	case strings.TrimSpace(result) == "":
+		h.Metrics.AIEmptyResponseCounter.WithLabelValues(role, model).Inc()
+	}
+	h.Metrics.AIRequestDuration.WithLabelValues(role, model, status).Observe(time.Since(start).Seconds())
+}
+
+// errorClass 把 AI 调用的错误归类, 用作指标的标签
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, moderation.ErrBlocked):
+		return "moderation"
+	case errors.Is(err, guard.ErrViolation):
+		return "guard"
+	case errors.Is(err, ai.ErrImagesUnsupported):
+		return "unsupported"
+	}
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "auth"
+	case status >= 500:
+		return "upstream"
+	case status >= 400:
+		return "bad_request"
+	}
+	return "other"
+}
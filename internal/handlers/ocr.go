@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/ocr"
+)
+
+// ReadImage 识别上传图片中的文本, 例如扫描版 PDF 的截图. 表单指定 role 时
+// 对识别出的文本执行该 role. 识别结果按图片的哈希缓存.
+func (h *APIHandler) ReadImage(c *gin.Context) {
+	if !parseUpload(c, h.MaxUploadBytes) {
+		return
+	}
+	role, selected := c.PostForm("role"), c.PostForm("selected")
+	if role != "" && !h.validRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	data, filename, ok := readFile(c, h.MaxUploadBytes)
+	if !ok {
+		return
+	}
+
+	setLabels(c, "ocr", h.AIClient.Model())
+	defer h.withDeadline(c, "ocr")()
+	ctx := c.Request.Context()
+	h.Metrics.TranslationCounter.WithLabelValues("ocr").Inc()
+	record, cached, err := h.OCR.Read(ctx, roleClient{h: h, role: "ocr"}, data)
+	switch {
+	case errors.Is(err, ocr.ErrUnsupported):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ocr.ErrNoText):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ai.ErrImagesUnsupported):
+		log.Printf("OCR is enabled but the AI client cannot send images: %v", err)
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Image input is not supported by the AI service"})
+		return
+	case err != nil:
+		log.Printf("OCR failed for '%s': %v", filename, err)
+		abortOnAIError(c, err, "AI service failed to read the image")
+		return
+	}
+	if cached {
+		h.Metrics.TranslationCacheHitCounter.WithLabelValues("ocr").Inc()
+	}
+	if role == "" {
+		c.JSON(http.StatusOK, gin.H{"text": record.Text, "cached": cached})
+		return
+	}
+
+	result, err := h.Process(ctx, role, record.Text, selected)
+	if err != nil {
+		log.Printf("AI generation failed for %s of image '%s': %v", role, filename, err)
+		abortOnAIError(c, err, "AI service failed to process text")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"text": record.Text, "cached": cached, "result": result})
+}
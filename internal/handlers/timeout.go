@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// withDeadline 给请求的 context 加上 role 的截止时间, 之后的 AI 调用都使用它.
+// 返回的函数在请求结束时调用.
+func (h *APIHandler) withDeadline(c *gin.Context, role string) context.CancelFunc {
+	seconds := h.Timeouts.DefaultSeconds
+	if s, ok := h.Timeouts.Roles[role]; ok {
+		seconds = s
+	}
+	if seconds <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(seconds)*time.Second)
+	c.Request = c.Request.WithContext(ctx)
+	return cancel
+}
+
+// observeCancel 记录因为请求取消或超时而结束的 AI 调用. 请求已取消但调用仍然
+// 成功说明上游没有收到取消, 单独记录.
+func (h *APIHandler) observeCancel(ctx context.Context, role string, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		h.Metrics.AICancelledCounter.WithLabelValues(role, "deadline").Inc()
+	case errors.Is(err, context.Canceled):
+		h.Metrics.AICancelledCounter.WithLabelValues(role, "client").Inc()
+	case err == nil && ctx.Err() != nil:
+		h.Metrics.AICancelledCounter.WithLabelValues(role, "ignored").Inc()
+	}
+}
+
+// generateTranslationInBackground 与 generateTranslation 相同, 但浏览器取消请求后
+// 生成最多继续 BackgroundSeconds 秒, 完成后调用 save 写入缓存, 下次请求即可命中.
+// 超时不会在后台继续.
+func (h *APIHandler) generateTranslationInBackground(ctx context.Context, text, selected, model string,
+	save func(ctx context.Context, record *models.TranslationResponse)) (*models.TranslationResponse, error) {
+	if h.Timeouts.BackgroundSeconds <= 0 {
+		return h.generateTranslation(ctx, "translate", text, selected, model, nil)
+	}
+
+	var bg context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		bg, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	} else {
+		bg, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	type result struct {
+		record *models.TranslationResponse
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		record, err := h.generateTranslation(bg, "translate", text, selected, model, nil)
+		done <- result{record, err}
+	}()
+
+	select {
+	case res := <-done:
+		cancel()
+		return res.record, res.err
+	case <-ctx.Done():
+	}
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		cancel()
+		return nil, ctx.Err()
+	}
+
+	log.Printf("Request for text='%s', selected='%s' cancelled, finishing in background", text, selected)
+	timer := time.AfterFunc(time.Duration(h.Timeouts.BackgroundSeconds)*time.Second, cancel)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		res := <-done
+		timer.Stop()
+		cancel()
+		if res.err != nil || res.record.Translation == "" {
+			log.Printf("Background translation of text='%s' failed: %v", text, res.err)
+			h.Metrics.AIBackgroundCounter.WithLabelValues("failed").Inc()
+			return
+		}
+		h.Metrics.AIBackgroundCounter.WithLabelValues("completed").Inc()
+		save(context.WithoutCancel(ctx), res.record)
+	}()
+	return nil, ctx.Err()
+}
+
+// Wait 等待在后台完成的生成写入缓存.
+func (h *APIHandler) Wait() {
+	h.background.Wait()
+}
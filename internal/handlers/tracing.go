@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/zzhirong/contextdict/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/zzhirong/contextdict/internal/handlers")
+
+// endSpan 记录 err 并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// findTranslation 查找缓存的翻译, 在 cache.lookup span 中进行
+func (h *APIHandler) findTranslation(ctx context.Context, text, selected string) (*models.TranslationResponse, error) {
+	ctx, span := tracer.Start(ctx, "cache.lookup", trace.WithAttributes(attribute.String("cache.type", "translation")))
+	record, err := h.Repo.FindTranslation(ctx, text, selected)
+	span.SetAttributes(attribute.Bool("cache.hit", record != nil))
+	endSpan(span, err)
+	return record, err
+}
+
+// saveTranslation 把 record 写入缓存, 在 cache.write span 中进行. 已有缓存条目
+// cached 时作为新的候选版本保存.
+func (h *APIHandler) saveTranslation(ctx context.Context, cached, record *models.TranslationResponse) (err error) {
+	ctx, span := tracer.Start(ctx, "cache.write", trace.WithAttributes(
+		attribute.String("cache.type", "translation"), attribute.Bool("cache.candidate", cached != nil)))
+	defer func() { endSpan(span, err) }()
+	if cached != nil {
+		record.ID = cached.ID
+		return h.Repo.AddCandidate(ctx, record)
+	}
+	return h.Repo.CreateTranslation(ctx, record)
+}
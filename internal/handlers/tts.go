@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/summarize"
+	"github.com/zzhirong/contextdict/internal/tts"
+)
+
+// Speech 返回 text 的朗读音频, 相同的文本和声音从缓存返回.
+// GET 请求便于前端直接作为 <audio> 的 src.
+func (h *APIHandler) Speech(c *gin.Context) {
+	text, voice := c.Query("text"), c.Query("voice")
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter: text"})
+		return
+	}
+	setLabels(c, "tts", "")
+	// 预算只在缓存未命中时检查, 超出预算时仍然返回缓存的音频
+	allow := func() error { return h.Budget.Allow("tts") }
+	audio, cached, err := h.TTS.Speak(c.Request.Context(), text, voice, allow)
+	switch {
+	case errors.Is(err, tts.ErrEmpty), errors.Is(err, tts.ErrTooLong), errors.Is(err, tts.ErrInvalidVoice):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "voices": h.TTS.Voices()})
+		return
+	case err != nil:
+		h.Metrics.TTSRequestCounter.WithLabelValues("error").Inc()
+		log.Printf("TTS failed for text='%s': %v", text, err)
+		abortOnAIError(c, err, "TTS service failed to read text")
+		return
+	}
+	if cached {
+		h.Metrics.TTSRequestCounter.WithLabelValues("hit").Inc()
+		c.Header("X-Cache", "hit")
+	} else {
+		h.Metrics.TTSRequestCounter.WithLabelValues("miss").Inc()
+		// 语音按字符计费, 用估算的 token 数计入预算
+		h.Budget.Record("tts", summarize.EstimateTokens(audio.Text))
+		c.Header("X-Cache", "miss")
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, audio.ContentType, audio.Data)
+}
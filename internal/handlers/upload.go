@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/internal/extract"
+)
+
+// parseUpload 限制请求体的大小并解析 multipart 表单, 失败时已写入响应.
+// 必须在读取任何表单字段之前调用, 否则 gin 会不受限制地解析整个请求体.
+func parseUpload(c *gin.Context, maxBytes int64) bool {
+	if c.Request.MultipartForm != nil {
+		return true // 已经解析过
+	}
+	if maxBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	}
+	if _, err := c.MultipartForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Uploaded file is too large"})
+			return false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form"})
+		return false
+	}
+	return true
+}
+
+// readFile 读取表单字段 file, 失败时已写入响应.
+func readFile(c *gin.Context, maxBytes int64) ([]byte, string, bool) {
+	if !parseUpload(c, maxBytes) {
+		return nil, "", false
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required file: file"})
+		return nil, "", false
+	}
+	f, err := fh.Open()
+	if err != nil {
+		log.Printf("Error opening uploaded file '%s': %v", fh.Filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading uploaded file"})
+		return nil, "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		log.Printf("Error reading uploaded file '%s': %v", fh.Filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading uploaded file"})
+		return nil, "", false
+	}
+	return data, fh.Filename, true
+}
+
+// readUpload 读取表单字段 file 并提取文本, 失败时已写入响应.
+func readUpload(c *gin.Context, maxBytes int64) (*extract.Document, bool) {
+	data, filename, ok := readFile(c, maxBytes)
+	if !ok {
+		return nil, false
+	}
+
+	doc, err := extract.Extract(filename, data)
+	switch {
+	case errors.Is(err, extract.ErrUnsupported):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported file format, expected PDF, EPUB or HTML"})
+		return nil, false
+	case errors.Is(err, extract.ErrNoText):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return nil, false
+	case err != nil:
+		log.Printf("Error extracting text from '%s': %v", filename, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Could not extract text from the file"})
+		return nil, false
+	}
+	log.Printf("Extracted %d bytes of text from %s '%s'", len(doc.Text), doc.Format, filename)
+	return doc, true
+}
+
+// Upload 从上传的文件中提取文本. 表单指定 role 时对提取的文本执行该 role,
+// 有任务队列时作为异步任务提交.
+func (h *APIHandler) Upload(c *gin.Context) {
+	if !parseUpload(c, h.MaxUploadBytes) {
+		return
+	}
+	role := c.PostForm("role")
+	if role != "" && !h.validRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	doc, ok := readUpload(c, h.MaxUploadBytes)
+	if !ok {
+		return
+	}
+	if role == "" {
+		c.JSON(http.StatusOK, gin.H{"format": doc.Format, "title": doc.Title, "text": doc.Text})
+		return
+	}
+
+	if h.Jobs != nil {
+		h.submitJob(c, role, doc.Text, "", c.PostForm("webhook"))
+		return
+	}
+	setLabels(c, role, h.AIClient.Model())
+	defer h.withDeadline(c, role)()
+	result, err := h.Process(c.Request.Context(), role, doc.Text, "")
+	if err != nil {
+		log.Printf("AI generation failed for uploaded %s '%s': %v", role, doc.Title, err)
+		abortOnAIError(c, err, "AI service failed to process text")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
@@ -0,0 +1,255 @@
+// Package jobs runs long requests asynchronously. Jobs are stored in the
+// database, so every instance can pick them up and a restart does not lose
+// them; clients poll or subscribe for the result, or get a webhook call.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+var (
+	ErrTooLong         = errors.New("text is too long")
+	ErrWebhookDisabled = errors.New("webhooks are disabled")
+	ErrInvalidWebhook  = errors.New("webhook must be an absolute http(s) URL")
+	ErrWebhookAddress  = errors.New("webhook must resolve to a public address")
+)
+
+// Processor runs a role on text; it is the same work the synchronous API
+// does within a request.
+type Processor interface {
+	Process(ctx context.Context, role, text, selected string) (string, error)
+}
+
+// Queue is a database-backed job queue with a fixed pool of workers.
+type Queue struct {
+	repo      database.JobRepository
+	processor Processor
+	cfg       config.JobsConfig
+	client    *http.Client
+	// allowAddr 判断 webhook 是否可以连接该地址, 默认只允许公网地址
+	allowAddr func(netip.Addr) bool
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewQueue(repo database.JobRepository, processor Processor, cfg config.JobsConfig) *Queue {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PollSeconds <= 0 {
+		cfg.PollSeconds = 5
+	}
+	if cfg.LeaseMinutes <= 0 {
+		cfg.LeaseMinutes = 10
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	q := &Queue{
+		repo:      repo,
+		processor: processor,
+		cfg:       cfg,
+		allowAddr: publicAddr,
+		wake:      make(chan struct{}, cfg.Concurrency),
+	}
+	q.client = q.newWebhookClient()
+	return q
+}
+
+// Submit stores a pending job and wakes a worker.
+func (q *Queue) Submit(ctx context.Context, role, text, selected, webhook string) (*models.Job, error) {
+	if q.cfg.MaxTextLen > 0 && len(text) > q.cfg.MaxTextLen {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrTooLong, q.cfg.MaxTextLen)
+	}
+	if webhook != "" {
+		if !q.cfg.Webhooks {
+			return nil, ErrWebhookDisabled
+		}
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, ErrInvalidWebhook
+		}
+		if err := q.checkWebhookHost(ctx, u.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	job := &models.Job{
+		Token:    token,
+		Role:     role,
+		Text:     text,
+		Selected: selected,
+		Webhook:  webhook,
+		Status:   models.StatusPending,
+	}
+	if err := q.repo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	log.Printf("Job %s queued for role '%s' (%d bytes)", token, role, len(text))
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns the job with token, or nil if it does not exist.
+func (q *Queue) Get(ctx context.Context, token string) (*models.Job, error) {
+	return q.repo.GetJob(ctx, token)
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Start runs the workers and the cleanup of old jobs until ctx is cancelled.
+func (q *Queue) Start(ctx context.Context) {
+	for range q.cfg.Concurrency {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+	if q.cfg.RetentionDays > 0 {
+		q.wg.Add(1)
+		go q.cleanup(ctx)
+	}
+}
+
+// Wait blocks until the workers stopped after the context was cancelled.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+	// 其他实例提交的任务不会唤醒这里的 worker, 需要定期检查
+	ticker := time.NewTicker(time.Duration(q.cfg.PollSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil && q.runNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext processes one job and reports whether there was one.
+func (q *Queue) runNext(ctx context.Context) bool {
+	lease := time.Duration(q.cfg.LeaseMinutes) * time.Minute
+	job, err := q.repo.ClaimJob(ctx, lease)
+	if err != nil {
+		log.Printf("Error claiming job: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	if job.Attempts > q.cfg.MaxAttempts {
+		// 任务多次领取都没有完成, 通常是处理它的实例崩溃了
+		job.Status, job.Error = models.StatusFailed, "job was abandoned too many times"
+	} else {
+		runCtx, cancel := context.WithTimeout(ctx, lease)
+		result, err := q.processor.Process(runCtx, job.Role, job.Text, job.Selected)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			// 服务关闭, 放回队列由下次启动或其他实例处理. 正常关闭不算放弃任务,
+			// 不计入领取次数, 否则跨越多次部署的长任务会被标记为失败
+			job.Status, job.LeaseUntil = models.StatusPending, nil
+			job.Attempts--
+			if err := q.repo.SaveJob(context.WithoutCancel(ctx), job); err != nil {
+				log.Printf("Error requeueing job %s: %v", job.Token, err)
+			}
+			return false
+		case err != nil:
+			log.Printf("Job %s failed: %v", job.Token, err)
+			job.Status, job.Error = models.StatusFailed, err.Error()
+		default:
+			job.Status, job.Result = models.StatusDone, result
+		}
+	}
+
+	if err := q.repo.SaveJob(ctx, job); err != nil {
+		log.Printf("Error saving job %s: %v", job.Token, err)
+		return true
+	}
+	log.Printf("Job %s %s", job.Token, job.Status)
+	if job.Webhook != "" {
+		q.callWebhook(ctx, job)
+	}
+	return true
+}
+
+// WebhookPayload is posted as JSON to the webhook of a finished job.
+type WebhookPayload struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (q *Queue) callWebhook(ctx context.Context, job *models.Job) {
+	body, _ := json.Marshal(WebhookPayload{ID: job.Token, Status: job.Status, Result: job.Result, Error: job.Error})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.Webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error creating webhook request for job %s: %v", job.Token, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := q.client.Do(req)
+	if err != nil {
+		log.Printf("Error calling webhook for job %s: %v", job.Token, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Webhook for job %s returned %s", job.Token, resp.Status)
+	}
+}
+
+func (q *Queue) cleanup(ctx context.Context) {
+	defer q.wg.Done()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		before := time.Now().AddDate(0, 0, -q.cfg.RetentionDays)
+		if n, err := q.repo.PurgeJobs(ctx, before); err != nil {
+			log.Printf("Error purging old jobs: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d finished jobs", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
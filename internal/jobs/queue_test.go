@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// memoryRepo is an in-memory JobRepository.
+type memoryRepo struct {
+	mu   sync.Mutex
+	jobs []*models.Job
+}
+
+func (r *memoryRepo) CreateJob(_ context.Context, job *models.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID = uint(len(r.jobs) + 1)
+	copied := *job
+	r.jobs = append(r.jobs, &copied)
+	return nil
+}
+
+func (r *memoryRepo) GetJob(_ context.Context, token string) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, j := range r.jobs {
+		if j.Token == token {
+			copied := *j
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepo) ClaimJob(_ context.Context, lease time.Duration) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, j := range r.jobs {
+		if j.Status == models.StatusPending || (j.Status == models.StatusRunning && (j.LeaseUntil == nil || j.LeaseUntil.Before(time.Now()))) {
+			until := time.Now().Add(lease)
+			j.Status, j.LeaseUntil = models.StatusRunning, &until
+			j.Attempts++
+			copied := *j
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepo) SaveJob(_ context.Context, job *models.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *job
+	r.jobs[job.ID-1] = &copied
+	return nil
+}
+
+func (r *memoryRepo) PurgeJobs(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+type processorFunc func(ctx context.Context, role, text, selected string) (string, error)
+
+func (f processorFunc) Process(ctx context.Context, role, text, selected string) (string, error) {
+	return f(ctx, role, text, selected)
+}
+
+func waitFinished(t *testing.T, q *Queue, token string) *models.Job {
+	t.Helper()
+	var job *models.Job
+	require.Eventually(t, func() bool {
+		job, _ = q.Get(context.Background(), token)
+		return job != nil && job.Finished()
+	}, 2*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestQueue_ProcessesJobsAndCallsWebhook(t *testing.T) {
+	payloads := make(chan WebhookPayload, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p WebhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		payloads <- p
+	}))
+	defer hook.Close()
+
+	processor := processorFunc(func(_ context.Context, role, text, _ string) (string, error) {
+		if text == "bad" {
+			return "", errors.New("AI failed")
+		}
+		return role + ":" + text, nil
+	})
+	q := NewQueue(&memoryRepo{}, processor, config.JobsConfig{Concurrency: 2, MaxAttempts: 3, Webhooks: true})
+	q.allowAddr = func(netip.Addr) bool { return true } // 测试服务器在 127.0.0.1
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Start(ctx)
+	defer func() { cancel(); q.Wait() }()
+
+	ok, err := q.Submit(ctx, "summarize", "long text", "", hook.URL)
+	require.NoError(t, err)
+	bad, err := q.Submit(ctx, "summarize", "bad", "", "")
+	require.NoError(t, err)
+
+	job := waitFinished(t, q, ok.Token)
+	assert.Equal(t, models.StatusDone, job.Status)
+	assert.Equal(t, "summarize:long text", job.Result)
+	select {
+	case p := <-payloads:
+		assert.Equal(t, WebhookPayload{ID: ok.Token, Status: models.StatusDone, Result: "summarize:long text"}, p)
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	job = waitFinished(t, q, bad.Token)
+	assert.Equal(t, models.StatusFailed, job.Status)
+	assert.Equal(t, "AI failed", job.Error)
+}
+
+func TestQueue_RequeueOnShutdown(t *testing.T) {
+	started := make(chan struct{})
+	processor := processorFunc(func(ctx context.Context, _, _, _ string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	repo := &memoryRepo{}
+	q := NewQueue(repo, processor, config.JobsConfig{MaxAttempts: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Start(ctx)
+
+	job, err := q.Submit(ctx, "summarize", "long text", "", "")
+	require.NoError(t, err)
+	<-started
+	cancel()
+	q.Wait()
+
+	// 正常关闭放回队列的任务不计入领取次数
+	job, _ = q.Get(context.Background(), job.Token)
+	assert.Equal(t, models.StatusPending, job.Status)
+	assert.Equal(t, 0, job.Attempts)
+	assert.Nil(t, job.LeaseUntil)
+}
+
+func TestQueue_SubmitValidation(t *testing.T) {
+	q := NewQueue(&memoryRepo{}, nil, config.JobsConfig{MaxTextLen: 5})
+
+	_, err := q.Submit(context.Background(), "format", "too long", "", "")
+	assert.ErrorIs(t, err, ErrTooLong)
+	_, err = q.Submit(context.Background(), "format", "ok", "", "https://example.com/hook")
+	assert.ErrorIs(t, err, ErrWebhookDisabled)
+
+	q.cfg.Webhooks = true
+	_, err = q.Submit(context.Background(), "format", "ok", "", "file:///etc/passwd")
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	for _, hook := range []string{
+		"http://127.0.0.1/hook", "http://localhost:8080/hook", "http://10.0.0.1/hook", "http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data", "http://0.0.0.0/hook", "http://[::ffff:192.168.1.1]/hook",
+	} {
+		_, err = q.Submit(context.Background(), "format", "ok", "", hook)
+		assert.ErrorIs(t, err, ErrWebhookAddress, hook)
+	}
+	job, err := q.Submit(context.Background(), "format", "ok", "", "https://93.184.215.14/hook")
+	require.NoError(t, err)
+	assert.Len(t, job.Token, 32)
+	assert.Equal(t, models.StatusPending, job.Status)
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.215.14": true, "2606:2800:21f:cb07:6820:80da:af6b:8b2c": true,
+		"127.0.0.1": false, "10.1.2.3": false, "172.16.0.1": false, "192.168.0.1": false,
+		"169.254.169.254": false, "100.64.0.1": false, "0.0.0.0": false, "255.255.255.255": false,
+		"::1": false, "::": false, "fe80::1": false, "fd00:ec2::254": false, "::ffff:127.0.0.1": false,
+	} {
+		assert.Equal(t, public, publicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestQueue_WebhookCheckedAtDial(t *testing.T) {
+	var called atomic.Bool
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer hook.Close()
+
+	// 提交时检查过的主机之后可能解析到内网地址, 连接时再次检查
+	q := NewQueue(&memoryRepo{}, nil, config.JobsConfig{Webhooks: true})
+	q.callWebhook(context.Background(), &models.Job{Token: "t", Status: models.StatusDone, Webhook: hook.URL})
+	assert.False(t, called.Load())
+}
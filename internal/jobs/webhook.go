@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// 不属于公网的地址段, 补充 netip 没有覆盖的部分
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "本网络"
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF 协议分配
+	netip.MustParsePrefix("198.18.0.0/15"), // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),   // 保留, 包括广播地址
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, 可以映射到内网 IPv4
+	netip.MustParsePrefix("2002::/16"),     // 6to4, 同上
+}
+
+// publicAddr reports whether addr is a public unicast address. Loopback,
+// private, link-local (including the cloud metadata address 169.254.169.254),
+// unspecified, multicast and reserved addresses are not.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookHost resolves host and rejects it if any of its addresses is
+// not allowed, so a webhook cannot reach the internal network.
+func (q *Queue) checkWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebhookAddress, err)
+	}
+	for _, addr := range addrs {
+		if !q.allowAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrWebhookAddress, host, addr)
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns a client that checks every address it connects
+// to, including after redirects and DNS changes since the job was submitted.
+// Proxies are not used, because the check would only see the proxy.
+func (q *Queue) newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !q.allowAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
@@ -0,0 +1,173 @@
+// Package langdetect guesses the language of a text locally, without a
+// network call. Languages with their own script are recognized by the
+// script; Latin-script languages are told apart by comparing character
+// trigrams with profiles built from the sample texts in profiles/.
+package langdetect
+
+import (
+	"embed"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Unknown is the language of text that is too short or has no letters.
+const Unknown = "und"
+
+// Names are the English names of the detected languages.
+var Names = map[string]string{
+	"en": "English", "de": "German", "fr": "French", "es": "Spanish", "it": "Italian",
+	"pt": "Portuguese", "nl": "Dutch", "zh": "Chinese", "ja": "Japanese", "ko": "Korean",
+	"ru": "Russian", "el": "Greek", "ar": "Arabic", "he": "Hebrew", "th": "Thai", "hi": "Hindi",
+	Unknown: "Unknown",
+}
+
+// scripts 是有自己文字的语言, 西里尔字母按俄语处理
+var scripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana}, {"ja", unicode.Katakana}, {"ko", unicode.Hangul}, {"zh", unicode.Han},
+	{"ru", unicode.Cyrillic}, {"el", unicode.Greek}, {"ar", unicode.Arabic}, {"he", unicode.Hebrew},
+	{"th", unicode.Thai}, {"hi", unicode.Devanagari},
+}
+
+// minLetters 是可以判断拉丁字母语言的最少字母数, 少于 fullLetters 个字母时
+// 结果不太可靠, 按比例降低置信度
+const (
+	minLetters  = 3
+	fullLetters = 30
+)
+
+//go:embed profiles/*.txt
+var profileFS embed.FS
+
+// profiles 是每种拉丁字母语言的 trigram 频率, 已归一化
+var profiles = loadProfiles()
+
+func loadProfiles() map[string]map[string]float64 {
+	entries, err := profileFS.ReadDir("profiles")
+	if err != nil {
+		panic(err)
+	}
+	res := make(map[string]map[string]float64, len(entries))
+	for _, e := range entries {
+		data, err := profileFS.ReadFile("profiles/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		res[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = trigrams(string(data))
+	}
+	return res
+}
+
+// Result is the detected language. Confidence is between 0 and 1.
+type Result struct {
+	Lang       string  `json:"lang"`
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+func result(lang string, confidence float64) Result {
+	return Result{Lang: lang, Name: Names[lang], Confidence: math.Round(confidence*100) / 100}
+}
+
+// Detect returns the language of text. The script with the most letters
+// wins; a CJK character counts as much as a short word of Latin letters,
+// so Chinese with a few English terms is still Chinese.
+func Detect(text string) Result {
+	weights := map[string]float64{}
+	latin, total := 0, 0.0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			total++
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				w := 1.0
+				if s.lang == "zh" || s.lang == "ja" || s.lang == "ko" {
+					w = 3
+				}
+				weights[s.lang] += w
+				total += w
+				break
+			}
+		}
+	}
+	best, bestWeight := "", 0.0
+	for lang, w := range weights {
+		if w > bestWeight || w == bestWeight && lang < best {
+			best, bestWeight = lang, w
+		}
+	}
+	// 日文中的汉字也算作日文
+	if best == "zh" && weights["ja"] > 0 {
+		best, bestWeight = "ja", bestWeight+weights["ja"]
+	}
+	if best != "" && bestWeight >= float64(latin) {
+		return result(best, bestWeight/total)
+	}
+	if latin < minLetters {
+		return result(Unknown, 0)
+	}
+	lang, confidence := detectLatin(text)
+	confidence *= math.Min(1, float64(latin)/fullLetters)
+	return result(lang, confidence*float64(latin)/total)
+}
+
+// detectLatin compares the trigrams of text with the profiles by cosine
+// similarity. The confidence grows with the margin to the second best.
+func detectLatin(text string) (string, float64) {
+	grams := trigrams(text)
+	type score struct {
+		lang  string
+		value float64
+	}
+	var scores []score
+	for lang, p := range profiles {
+		sum := 0.0
+		for g, f := range grams {
+			sum += f * p[g]
+		}
+		scores = append(scores, score{lang, sum})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].value != scores[j].value {
+			return scores[i].value > scores[j].value
+		}
+		return scores[i].lang < scores[j].lang
+	})
+	if scores[0].value == 0 {
+		return Unknown, 0
+	}
+	margin := (scores[0].value - scores[1].value) / scores[0].value
+	return scores[0].lang, math.Min(1, 0.5+margin*2)
+}
+
+// trigrams returns the normalized frequencies of letter trigrams; words
+// are padded with spaces so that prefixes and suffixes count.
+func trigrams(text string) map[string]float64 {
+	counts := map[string]float64{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+	norm := 0.0
+	for _, c := range counts {
+		norm += c * c
+	}
+	norm = math.Sqrt(norm)
+	for g := range counts {
+		counts[g] /= norm
+	}
+	return counts
+}
@@ -0,0 +1,42 @@
+package langdetect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		lang string
+	}{
+		{"Having finished his homework, he went out to play with his friends.", "en"},
+		{"Die Katze schläft auf dem Sofa, weil es draußen regnet.", "de"},
+		{"Je ne sais pas pourquoi il est parti si tôt ce matin.", "fr"},
+		{"No sé por qué se fue tan temprano esta mañana.", "es"},
+		{"Non so perché è partito così presto stamattina.", "it"},
+		{"Não sei por que ele saiu tão cedo esta manhã.", "pt"},
+		{"Ik weet niet waarom hij vanochtend zo vroeg is vertrokken.", "nl"},
+		{"这个函数返回一个 error, 调用者需要检查它。", "zh"},
+		{"この関数はエラーを返します。", "ja"},
+		{"이 함수는 오류를 반환합니다.", "ko"},
+		{"Эта функция возвращает ошибку.", "ru"},
+		{"42 + 7", Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			res := Detect(tt.text)
+			assert.Equal(t, tt.lang, res.Lang, tt.text)
+			assert.Equal(t, Names[tt.lang], res.Name)
+		})
+	}
+}
+
+func TestDetect_Confidence(t *testing.T) {
+	assert.Equal(t, 1.0, Detect("这是中文").Confidence)
+	long := Detect("The quick brown fox jumps over the lazy dog and runs into the forest.")
+	short := Detect("fox")
+	assert.Greater(t, long.Confidence, short.Confidence)
+	assert.GreaterOrEqual(t, long.Confidence, 0.6)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+)
+
+// none 是未设置的 role 或 model 的标签值
+const none = "none"
+
+type labelsKey struct{}
+
+// Labels are the role and model of a request. Handlers set them after the
+// query was validated, so that arbitrary query parameters never become
+// label values; request, AI and database latencies are labelled with them.
+type Labels struct {
+	mu    sync.Mutex
+	role  string
+	model string
+}
+
+// WithLabels returns a context carrying l.
+func WithLabels(ctx context.Context, l *Labels) context.Context {
+	return context.WithValue(ctx, labelsKey{}, l)
+}
+
+// LabelsFrom returns the labels of ctx, or nil.
+func LabelsFrom(ctx context.Context) *Labels {
+	l, _ := ctx.Value(labelsKey{}).(*Labels)
+	return l
+}
+
+// Set sets the role and model. It does nothing on a nil Labels.
+func (l *Labels) Set(role, model string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.role, l.model = role, model
+}
+
+// Values returns the role and model, "none" for those not set.
+func (l *Labels) Values() (role, model string) {
+	role, model = none, none
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.role != "" {
+		role = l.role
+	}
+	if l.model != "" {
+		model = l.model
+	}
+	return
+}
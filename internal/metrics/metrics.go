@@ -12,31 +12,201 @@ import (
 
 // Metrics holds the Prometheus counters.
 type Metrics struct {
-	TranslationCounter      *prometheus.CounterVec
+	TranslationCounter         *prometheus.CounterVec
 	TranslationCacheHitCounter *prometheus.CounterVec
-    // Add other metrics here if needed
+	AIBudgetTokens             *prometheus.GaugeVec
+	AIBudgetExhausted          *prometheus.GaugeVec
+	AIBudgetRejectedCounter    *prometheus.CounterVec
+	LocalFormatCounter         *prometheus.CounterVec
+	DictionaryLookupCounter    *prometheus.CounterVec
+	AIInvalidOutputCounter     *prometheus.CounterVec
+	GlossaryViolationCounter   prometheus.Counter
+	TTSRequestCounter          *prometheus.CounterVec
+	AICancelledCounter         *prometheus.CounterVec
+	AIBackgroundCounter        *prometheus.CounterVec
+	AIGuardViolationCounter    *prometheus.CounterVec
+	ModerationBlockedCounter   *prometheus.CounterVec
+	RequestDuration            *prometheus.HistogramVec
+	AIRequestDuration          *prometheus.HistogramVec
+	DBQueryDuration            *prometheus.HistogramVec
+	AIErrorCounter             *prometheus.CounterVec
+	AIEmptyResponseCounter     *prometheus.CounterVec
+	CacheWriteFailureCounter   *prometheus.CounterVec
+	RateLimitRejectedCounter   prometheus.Counter
+	URLLengthRejectedCounter   prometheus.Counter
+	// Add other metrics here if needed
 }
 
 // NewMetrics initializes and registers Prometheus metrics.
 func NewMetrics() *Metrics {
-	m := &Metrics{
-		TranslationCounter: promauto.NewCounterVec(
+	m := NewMetricsWith(prometheus.DefaultRegisterer)
+	log.Println("Prometheus metrics registered.")
+	return m
+}
+
+// NewMetricsWith registers the metrics on reg, tests use their own registry.
+func NewMetricsWith(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+	return &Metrics{
+		TranslationCounter: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "app_translation_requests_total", // Added prefix for clarity
 				Help: "Total number of translation requests by type",
 			},
 			[]string{"type"}, // e.g., "translate", "translate_context", "format", "summarize"
 		),
-		TranslationCacheHitCounter: promauto.NewCounterVec(
+		TranslationCacheHitCounter: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "app_translation_cache_hits_total",
 				Help: "Total number of translation cache hits by type",
 			},
 			[]string{"type"}, // "translate" (only translate uses cache currently)
 		),
+		AIBudgetTokens: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "app_ai_budget_used_tokens",
+				Help: "Tokens spent in the current budget window",
+			},
+			[]string{"scope", "window"}, // scope: "global" or a role; window: "hour", "day"
+		),
+		AIBudgetExhausted: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "app_ai_budget_exhausted",
+				Help: "1 if the budget of the scope is exhausted and only cached results are served",
+			},
+			[]string{"scope"},
+		),
+		AIBudgetRejectedCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_budget_rejected_total",
+				Help: "Total number of AI calls rejected because the budget was exhausted",
+			},
+			[]string{"type"},
+		),
+		LocalFormatCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_local_format_total",
+				Help: "Total number of code snippets formatted locally without an AI call",
+			},
+			[]string{"language"},
+		),
+		DictionaryLookupCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_dictionary_lookups_total",
+				Help: "Total number of offline dictionary lookups by result",
+			},
+			[]string{"result"}, // "hit", "miss", "error"
+		),
+		AIInvalidOutputCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_invalid_output_total",
+				Help: "Total number of AI outputs rejected by validation, by role",
+			},
+			[]string{"role"},
+		),
+		GlossaryViolationCounter: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "app_glossary_violations_total",
+				Help: "Total number of glossary terms not translated as required",
+			},
+		),
+		TTSRequestCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_tts_requests_total",
+				Help: "Total number of text-to-speech requests by result",
+			},
+			[]string{"result"}, // "hit", "miss", "error"
+		),
+		AICancelledCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_cancelled_total",
+				Help: "Total number of AI calls ended by a cancelled request or an expired deadline",
+			},
+			// reason: "client" (浏览器取消后上游调用也被中止), "deadline" (超时),
+			// "ignored" (请求已取消但上游调用仍然完成)
+			[]string{"role", "reason"},
+		),
+		AIBackgroundCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_background_total",
+				Help: "Total number of cancelled generations continued in the background, by result",
+			},
+			[]string{"result"}, // "completed", "failed"
+		),
+		AIGuardViolationCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_guard_violations_total",
+				Help: "Total number of AI outputs violating a guard rule, by role and kind",
+			},
+			[]string{"role", "kind"}, // kind: "echo", "prompt_leak", "filter"
+		),
+		ModerationBlockedCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_moderation_blocked_total",
+				Help: "Total number of requests blocked by moderation before calling the AI, by role and checker",
+			},
+			[]string{"role", "checker"}, // checker: "blocklist", "heuristic", "api"
+		),
+		RequestDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "app_request_duration_seconds",
+				Help:    "End-to-end latency of HTTP requests, by route, role, model and status code",
+				Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+			},
+			[]string{"route", "role", "model", "code"},
+		),
+		AIRequestDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "app_ai_request_duration_seconds",
+				Help:    "Latency of upstream AI calls, by role, model and result",
+				Buckets: []float64{.25, .5, 1, 2.5, 5, 10, 20, 30, 45, 60, 90},
+			},
+			[]string{"role", "model", "result"}, // result: "ok", "error"
+		),
+		DBQueryDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "app_db_query_duration_seconds",
+				Help:    "Latency of database queries, by operation and the role and model of the request",
+				Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+			},
+			[]string{"operation", "role", "model"}, // operation: "create", "query", "update", "delete", "row", "raw"
+		),
+		AIErrorCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_errors_total",
+				Help: "Total number of failed AI calls, by role, model and error class",
+			},
+			// class: "timeout", "cancelled", "rate_limited", "auth", "bad_request", "upstream",
+			// "network", "moderation", "guard", "unsupported", "other"
+			[]string{"role", "model", "class"},
+		),
+		AIEmptyResponseCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_ai_empty_responses_total",
+				Help: "Total number of AI calls that succeeded with an empty result, by role and model",
+			},
+			[]string{"role", "model"},
+		),
+		CacheWriteFailureCounter: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "app_cache_write_failures_total",
+				Help: "Total number of results that could not be written to the cache, by type",
+			},
+			[]string{"type"}, // "translation", "sense", "audio", "image_text"
+		),
+		RateLimitRejectedCounter: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "app_rate_limit_rejected_total",
+				Help: "Total number of requests rejected by the IP rate limiter",
+			},
+		),
+		URLLengthRejectedCounter: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "app_url_length_rejected_total",
+				Help: "Total number of requests rejected because the URL exceeds MaxURLLen",
+			},
+		),
 	}
-	log.Println("Prometheus metrics registered.")
-	return m
 }
 
 // StartServer starts the Prometheus metrics HTTP server.
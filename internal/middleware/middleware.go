@@ -1,19 +1,28 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/didip/tollbooth/v8"
 	"github.com/didip/tollbooth/v8/limiter"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zzhirong/contextdict/internal/metrics"
 )
 
-func LimitHandler(lmt *limiter.Limiter) gin.HandlerFunc {
+// LimitHandler 拒绝超过 lmt 的请求, rejected 为 nil 时不计数
+func LimitHandler(lmt *limiter.Limiter, rejected prometheus.Counter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		httpError := tollbooth.LimitByRequest(lmt, c.Writer, c.Request)
 		if httpError != nil {
+			if rejected != nil {
+				rejected.Inc()
+			}
 			c.Data(httpError.StatusCode, lmt.GetMessageContentType(), []byte(httpError.Message))
 			c.Abort()
 		} else {
@@ -23,9 +32,12 @@ func LimitHandler(lmt *limiter.Limiter) gin.HandlerFunc {
 }
 
 // 为防止滥用，限制 URL 长度
-func LimitURLLen(maxURLLen int) gin.HandlerFunc {
+func LimitURLLen(maxURLLen int, rejected prometheus.Counter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if len(c.Request.URL.String()) > maxURLLen {
+			if rejected != nil {
+				rejected.Inc()
+			}
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": fmt.Sprintf("Input length exceeds limit (%d characters)",
 					maxURLLen),
@@ -39,7 +51,7 @@ func LimitURLLen(maxURLLen int) gin.HandlerFunc {
 }
 
 // 根据 ip 限速，单位是
-func IPRateLimiter(rate float64, expireDays int, RealIPHeaderName string) gin.HandlerFunc {
+func IPRateLimiter(rate float64, expireDays int, RealIPHeaderName string, rejected prometheus.Counter) gin.HandlerFunc {
 	ttl := time.Duration(expireDays) * 24 * time.Hour
 	lmt := tollbooth.NewLimiter(
 		rate,
@@ -52,5 +64,36 @@ func IPRateLimiter(rate float64, expireDays int, RealIPHeaderName string) gin.Ha
 		Name:           RealIPHeaderName,
 		IndexFromRight: 0, // 从右往左数, 所以优先 CF-Connecting-IP
 	}))
-	return LimitHandler(lmt)
+	return LimitHandler(lmt, rejected)
+}
+
+// Metrics 记录请求的延迟, 按路由, role, model 和状态码分类. role 和 model
+// 由 handler 通过 metrics.LabelsFrom 设置, 之后的 AI 和数据库调用也使用它们.
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		labels := &metrics.Labels{}
+		c.Request = c.Request.WithContext(metrics.WithLabels(c.Request.Context(), labels))
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		role, model := labels.Values()
+		m.RequestDuration.WithLabelValues(route, role, model, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// AdminAuth 要求请求携带 "Authorization: Bearer <token>"
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
 }
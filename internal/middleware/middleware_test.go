@@ -8,12 +8,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zzhirong/contextdict/internal/metrics"
 )
 
 func TestIPRateLimit(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.Use(IPRateLimiter(10, 1, "CF-Connecting-IP"))
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"})
+	router.Use(IPRateLimiter(10, 1, "CF-Connecting-IP", rejected))
 	router.GET("/test", func(c *gin.Context) {
 		c.String(200, "ok")
 	})
@@ -37,6 +41,9 @@ func TestIPRateLimit(t *testing.T) {
 	if w.Code != http.StatusTooManyRequests {
 		t.Errorf("应该触发频率限制，got %v", w.Code)
 	}
+	if testutil.ToFloat64(rejected) == 0 {
+		t.Error("被限制的请求应该计数")
+	}
 
 	// 等待重置
 	time.Sleep(time.Second)
@@ -50,7 +57,8 @@ func TestIPRateLimit(t *testing.T) {
 func TestLimitURLLen(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.Use(LimitURLLen(100))
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"})
+	router.Use(LimitURLLen(100, rejected))
 	router.GET("/test", func(c *gin.Context) {
 		c.String(200, "ok")
 	})
@@ -69,4 +77,47 @@ func TestLimitURLLen(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("应该触发长度限制，got %v", w.Code)
 	}
+	if got := testutil.ToFloat64(rejected); got != 1 {
+		t.Errorf("被拒绝的请求应该计数一次，got %v", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := prometheus.NewRegistry()
+	m := metrics.NewMetricsWith(registry)
+	router := gin.New()
+	router.Use(Metrics(m))
+	router.GET("/api", func(c *gin.Context) {
+		metrics.LabelsFrom(c.Request.Context()).Set("translate", "test-model")
+		c.String(200, "ok")
+	})
+
+	for _, path := range []string{"/api?role=translate", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	expected := map[string]bool{
+		"/api translate test-model 200": true,
+		"unmatched none none 404":       true,
+	}
+	families, _ := registry.Gather()
+	for _, f := range families {
+		if f.GetName() != "app_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			values := map[string]string{}
+			for _, l := range metric.GetLabel() {
+				values[l.GetName()] = l.GetValue()
+			}
+			key := values["route"] + " " + values["role"] + " " + values["model"] + " " + values["code"]
+			if !expected[key] || metric.GetHistogram().GetSampleCount() != 1 {
+				t.Errorf("unexpected request duration %s", key)
+			}
+			delete(expected, key)
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("missing request durations %v", expected)
+	}
 }
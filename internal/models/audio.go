@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// Audio caches the speech generated for Text with Voice. Key is a hash of
+// the provider, model, voice and text, like WordSense it is used because
+// the text can be too long to be indexed.
+type Audio struct {
+	gorm.Model
+	Key         string `gorm:"size:64;uniqueIndex"`
+	Text        string
+	Voice       string `gorm:"size:32"`
+	Provider    string `gorm:"size:32"`
+	AIModel     string `gorm:"size:64"`
+	ContentType string `gorm:"size:64"`
+	Data        []byte `gorm:"type:mediumblob"`
+}
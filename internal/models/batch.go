@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 批量任务和任务项的状态
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusPaused  = "paused" // 预算耗尽等原因暂停, 可以手动恢复
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// BatchJob pre-translates a whole document so that readers hit the cache.
+type BatchJob struct {
+	gorm.Model
+	Name   string
+	Status string `gorm:"size:16;index"`
+	Error  string
+	Total  int
+	Done   int
+	Failed int
+	// Owner 是运行任务的实例, LeaseUntil 之前其他实例不会领取这个任务
+	Owner      string `gorm:"size:64"`
+	LeaseUntil *time.Time
+}
+
+// BatchItem is one sentence, or one term in its sentence, of a BatchJob.
+type BatchItem struct {
+	gorm.Model
+	JobID    uint   `gorm:"index:idx_job_status,priority:1"`
+	Status   string `gorm:"size:16;index:idx_job_status,priority:2"`
+	Text     string
+	Selected string
+	Error    string
+}
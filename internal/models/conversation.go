@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Conversation keeps the follow-up questions on a result. The first two
+// messages are the original text and the answer; Token is the id given to
+// the client, random like the token of a Job.
+type Conversation struct {
+	gorm.Model
+	Token    string `gorm:"size:32;uniqueIndex"`
+	Role     string `gorm:"size:32"`
+	Selected string
+	Messages []ConversationMessage `gorm:"foreignKey:ConversationID"`
+}
+
+// ConversationMessage is one message of a Conversation; Role is "user" or
+// "assistant".
+type ConversationMessage struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uint      `gorm:"index" json:"-"`
+	Role           string    `gorm:"size:16" json:"role"`
+	Content        string    `json:"content"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// DictEntry is one part of speech of a word in the offline dictionary.
+// Entries are imported from dictionary dumps and never changed by the
+// application, so they have no timestamps.
+type DictEntry struct {
+	ID   uint   `gorm:"primarykey"`
+	Word string `gorm:"size:128;index"`
+	// Lemma 是屈折变化形式的原形, 如 running 的 run; 原形本身为空
+	Lemma    string `gorm:"size:128"`
+	Phonetic string `gorm:"size:128"`
+	POS      string `gorm:"size:64"`
+	// Definition 和 Translation 是英文和中文释义, 每行一条
+	Definition  string `gorm:"type:text"`
+	Translation string `gorm:"type:text"`
+	Source      string `gorm:"size:32;index"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// Feedback is a reader's rating of a cached translation.
+type Feedback struct {
+	gorm.Model
+	TranslationID uint `gorm:"index"`
+	CandidateID   uint `gorm:"index"`
+	Rating        int  // +1 或 -1
+	Comment       string
+	Voter         string `gorm:"size:64;index"` // 客户端地址的哈希, 同一客户端对同一候选结果只算一票
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Glossary is a list of terms owned by a user or team whose translations
+// must be used consistently. Slug is the public id used to select the
+// glossary; changes require the token returned when it was created, of
+// which only the hash is stored.
+type Glossary struct {
+	gorm.Model
+	Slug      string         `gorm:"size:32;uniqueIndex"`
+	TokenHash string         `gorm:"size:64"`
+	Name      string         `gorm:"size:128"`
+	Owner     string         `gorm:"size:128"`
+	Terms     []GlossaryTerm `gorm:"foreignKey:GlossaryID"`
+}
+
+// GlossaryTerm is the required translation of Source. Target may list
+// several accepted translations separated by "|".
+type GlossaryTerm struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	GlossaryID uint      `gorm:"uniqueIndex:idx_glossary_source,priority:1" json:"-"`
+	Source     string    `gorm:"size:255;uniqueIndex:idx_glossary_source,priority:2" json:"source"`
+	Target     string    `gorm:"size:255" json:"target"`
+	Note       string    `gorm:"size:512" json:"note,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job is an asynchronous request, queued in the database and processed by
+// a worker pool. Token is the id given to the client; it is random so that
+// jobs of other users cannot be guessed.
+type Job struct {
+	gorm.Model
+	Token    string `gorm:"size:32;uniqueIndex"`
+	Role     string `gorm:"size:32"`
+	Text     string
+	Selected string
+	Webhook  string
+	Status   string `gorm:"size:16;index:idx_job_claim,priority:1"`
+	// LeaseUntil 之前任务由某个 worker 持有, 过期后可以被其他实例重新领取.
+	// 等待中的任务为 NULL, MySQL 的严格模式不接受零值日期
+	LeaseUntil *time.Time `gorm:"index:idx_job_claim,priority:2"`
+	Attempts   int
+	Result     string
+	Error      string
+}
+
+// Finished reports whether the job reached a final state.
+func (j *Job) Finished() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed
+}
@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// ImageText caches the text recognized in an image, keyed by the hash of
+// the image data.
+type ImageText struct {
+	gorm.Model
+	Hash       string `gorm:"size:64;uniqueIndex"`
+	MIMEType   string `gorm:"size:32"`
+	Text       string
+	AIModel    string `gorm:"size:64"`
+	PromptHash string `gorm:"size:16"`
+}
@@ -3,9 +3,92 @@ package models
 import "gorm.io/gorm"
 
 // TranslationResponse represents the data stored in the database cache.
+// 每个缓存条目可以有多个候选结果, 由选择策略决定返回哪一个.
 type TranslationResponse struct {
 	gorm.Model
-	Text        string `gorm:"index:idx_keyword,priority:1"`
-	Selected    string `gorm:"index:idx_keyword,priority:2"`
-	Translation string
+	Text       string                 `gorm:"index:idx_keyword,priority:1"`
+	Selected   string                 `gorm:"index:idx_keyword,priority:2"`
+	Candidates []TranslationCandidate `gorm:"foreignKey:TranslationID"`
+
+	// 以下字段来自被选中的候选结果, 不单独存储
+	CandidateID uint   `gorm:"-"`
+	Translation string `gorm:"-"`
+	Prompt      string `gorm:"-"`
+	PromptHash  string `gorm:"-"`
+	AIModel     string `gorm:"-"`
+	Params      string `gorm:"-"`
+}
+
+// Select fills the result fields from c.
+func (r *TranslationResponse) Select(c *TranslationCandidate) {
+	r.CandidateID = c.ID
+	r.Translation = c.Translation
+	r.Prompt = c.Prompt
+	r.PromptHash = c.PromptHash
+	r.AIModel = c.AIModel
+	r.Params = c.Params
+}
+
+// Candidate returns the result fields of r as a new candidate.
+func (r *TranslationResponse) Candidate() TranslationCandidate {
+	return TranslationCandidate{
+		TranslationID: r.ID,
+		Translation:   r.Translation,
+		Prompt:        r.Prompt,
+		PromptHash:    r.PromptHash,
+		AIModel:       r.AIModel,
+		Params:        r.Params,
+	}
+}
+
+// TranslationCandidate is one generated (or manually edited) result of a
+// cache entry, together with its provenance and rating.
+type TranslationCandidate struct {
+	gorm.Model
+	TranslationID uint `gorm:"index"`
+	Translation   string
+	Prompt        string `gorm:"size:64"` // 生成结果所用 prompt 的名称, 如 "TranslateOrFormat"
+	PromptHash    string `gorm:"size:16"` // prompt 内容的哈希, 用于识别 prompt 修改前生成的结果
+	AIModel       string `gorm:"column:model;size:128"`
+	Params        string `gorm:"size:512"` // 生成时的模型参数, JSON 格式, 见 config.ModelParams
+	Upvotes       int
+	Downvotes     int
+	Pinned        bool // 管理员固定的结果总是优先返回
+
+	Entry *TranslationResponse `gorm:"foreignKey:TranslationID"`
+}
+
+// Score is the net rating of the candidate.
+func (c *TranslationCandidate) Score() int {
+	return c.Upvotes - c.Downvotes
+}
+
+// 候选结果的选择策略
+const (
+	PolicyLatest    = "latest"
+	PolicyBestRated = "best_rated"
+)
+
+// SelectCandidate picks the candidate to serve according to policy.
+// A pinned candidate always wins; unknown policies fall back to latest.
+func SelectCandidate(candidates []TranslationCandidate, policy string) *TranslationCandidate {
+	var best *TranslationCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		switch {
+		case best == nil:
+			best = c
+		case c.Pinned != best.Pinned:
+			if c.Pinned {
+				best = c
+			}
+		case policy == PolicyBestRated && c.Score() != best.Score():
+			if c.Score() > best.Score() {
+				best = c
+			}
+		case c.ID > best.ID:
+			best = c
+		}
+	}
+	return best
 }
@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func candidate(id uint, up, down int, pinned bool) TranslationCandidate {
+	c := TranslationCandidate{Upvotes: up, Downvotes: down, Pinned: pinned}
+	c.ID = id
+	return c
+}
+
+func TestSelectCandidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []TranslationCandidate
+		policy     string
+		want       uint
+	}{
+		{"empty", nil, PolicyLatest, 0},
+		{"latest", []TranslationCandidate{candidate(1, 5, 0, false), candidate(2, 0, 3, false)}, PolicyLatest, 2},
+		{"best rated", []TranslationCandidate{candidate(1, 5, 0, false), candidate(2, 0, 3, false)}, PolicyBestRated, 1},
+		{"best rated tie prefers latest", []TranslationCandidate{candidate(1, 1, 0, false), candidate(2, 1, 0, false)}, PolicyBestRated, 2},
+		{"pinned wins", []TranslationCandidate{candidate(1, 0, 9, true), candidate(2, 9, 0, false)}, PolicyBestRated, 1},
+		{"unknown policy is latest", []TranslationCandidate{candidate(2, 0, 0, false), candidate(1, 0, 0, false)}, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SelectCandidate(tt.candidates, tt.policy)
+			var id uint
+			if got != nil {
+				id = got.ID
+			}
+			if id != tt.want {
+				t.Errorf("SelectCandidate() = %d, want %d", id, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "gorm.io/gorm"
+
+// Sense is the meaning of a word or phrase in a given context, in the
+// structured form returned by the model.
+type Sense struct {
+	Lemma       string `json:"lemma" gorm:"size:128"`
+	POS         string `json:"pos" gorm:"size:32"`
+	Sense       string `json:"sense" gorm:"type:text"`       // 上下文中的词义
+	Translation string `json:"translation" gorm:"type:text"` // 中文翻译
+	Example     string `json:"example" gorm:"type:text"`
+	Notes       string `json:"notes" gorm:"type:text"`
+}
+
+// WordSense caches the structured sense of Selected within Text. Key is a
+// hash of both, since the context can be too long to be indexed.
+type WordSense struct {
+	gorm.Model
+	Key        string `gorm:"size:64;uniqueIndex"`
+	Text       string
+	Selected   string
+	Sense      `gorm:"embedded"`
+	AIModel    string `gorm:"size:64"`
+	PromptHash string `gorm:"size:16"`
+	Params     string `gorm:"size:512"`
+}
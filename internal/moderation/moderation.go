@@ -0,0 +1,130 @@
+// Package moderation checks user input before it is sent to the model, so
+// that the public instance cannot be used as a free general-purpose LLM
+// proxy. A Client wraps an ai.Client and runs a list of Checkers, for
+// example a keyword blocklist, heuristics for chat-style instructions and
+// a moderation API, before every call.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/metrics"
+)
+
+// ErrBlocked is returned instead of calling the model when a checker
+// rejects the input.
+var ErrBlocked = errors.New("input blocked by moderation")
+
+// Checker decides whether text may be sent to the model for role. It
+// returns a short reason when the text is blocked and "" otherwise.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, role, text string) (string, error)
+}
+
+// Client runs the checkers before calling the wrapped client.
+type Client struct {
+	client     ai.Client
+	checkers   []Checker
+	failClosed bool
+	metrics    *metrics.Metrics
+}
+
+// New wraps client with the checkers enabled in cfg. apiKey is used for the
+// moderation API when cfg.API.APIKey is empty.
+func New(client ai.Client, cfg config.ModerationConfig, apiKey string, m *metrics.Metrics) (*Client, error) {
+	blocklist, err := NewBlocklist(cfg.Blocklist)
+	if err != nil {
+		return nil, err
+	}
+	checkers := []Checker{blocklist, NewHeuristics(cfg.HeuristicRoles, cfg.HeuristicThreshold)}
+	if cfg.API.Enabled {
+		if cfg.API.APIKey != "" {
+			apiKey = cfg.API.APIKey
+		}
+		checkers = append(checkers, NewOpenAI(cfg.API, apiKey))
+	}
+	return NewWith(client, m, cfg.API.FailClosed, checkers...), nil
+}
+
+// NewWith wraps client with the given checkers. Errors of a checker are
+// logged and the input is allowed, unless failClosed is set.
+func NewWith(client ai.Client, m *metrics.Metrics, failClosed bool, checkers ...Checker) *Client {
+	return &Client{client: client, checkers: checkers, failClosed: failClosed, metrics: m}
+}
+
+func (c *Client) Model() string {
+	return c.client.Model()
+}
+
+// Params passes through the parameters of the wrapped client, see ai.ParamsJSON.
+func (c *Client) Params(role string) config.ModelParams {
+	if pc, ok := c.client.(ai.ParamsClient); ok {
+		return pc.Params(role)
+	}
+	return config.ModelParams{}
+}
+
+func (c *Client) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
+	if err := c.Check(ctx, texts...); err != nil {
+		return "", err
+	}
+	return c.client.Generate(ctx, prompt, texts...)
+}
+
+// Chat checks the text of every user message. The history is stored by
+// the server, but its first message may have been supplied by the client
+// without a model call, so earlier messages cannot be trusted.
+func (c *Client) Chat(ctx context.Context, prompt string, messages []ai.Message) (string, error) {
+	var texts []string
+	for _, m := range messages {
+		if m.Role != ai.RoleUser {
+			continue
+		}
+		texts = append(texts, m.Content)
+		for _, p := range m.Parts {
+			if p.Image == nil {
+				texts = append(texts, p.Text)
+			}
+		}
+	}
+	if err := c.Check(ctx, texts...); err != nil {
+		return "", err
+	}
+	return ai.Chat(ctx, c.client, prompt, messages)
+}
+
+// Check runs the checkers on texts for the role in ctx and returns an error
+// wrapping ErrBlocked if one of them rejects a text.
+func (c *Client) Check(ctx context.Context, texts ...string) error {
+	role := ai.RoleFromContext(ctx)
+	for _, checker := range c.checkers {
+		for _, text := range texts {
+			if text == "" {
+				continue
+			}
+			reason, err := checker.Check(ctx, role, text)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Printf("Moderation checker %s failed: %v", checker.Name(), err)
+				if !c.failClosed {
+					break
+				}
+				reason = "checker unavailable"
+			}
+			if reason != "" {
+				c.metrics.ModerationBlockedCounter.WithLabelValues(role, checker.Name()).Inc()
+				log.Printf("Moderation checker %s blocked input for role %s: %s", checker.Name(), role, reason)
+				return fmt.Errorf("%w: %s", ErrBlocked, reason)
+			}
+		}
+	}
+	return nil
+}
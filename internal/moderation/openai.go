@@ -0,0 +1,57 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/zzhirong/contextdict/config"
+)
+
+// OpenAI uses an OpenAI compatible /moderations endpoint.
+type OpenAI struct {
+	client *openai.Client
+	model  string
+}
+
+func NewOpenAI(cfg config.ModerationAPIConfig, apiKey string) *OpenAI {
+	oaiConfig := openai.DefaultConfig(apiKey)
+	if cfg.BaseURL != "" {
+		oaiConfig.BaseURL = cfg.BaseURL
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(oaiConfig), model: cfg.Model}
+}
+
+func (p *OpenAI) Name() string { return "api" }
+
+func (p *OpenAI) Check(ctx context.Context, role, text string) (string, error) {
+	resp, err := p.client.Moderations(ctx, openai.ModerationRequest{Input: text, Model: p.model})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Results) == 0 {
+		return "", errors.New("moderation API returned no results")
+	}
+	result := resp.Results[0]
+	if !result.Flagged {
+		return "", nil
+	}
+	// 列出被标记的类别
+	var categories map[string]bool
+	b, _ := json.Marshal(result.Categories)
+	_ = json.Unmarshal(b, &categories)
+	var flagged []string
+	for name, ok := range categories {
+		if ok {
+			flagged = append(flagged, name)
+		}
+	}
+	if len(flagged) == 0 {
+		return "flagged", nil
+	}
+	sort.Strings(flagged)
+	return "flagged as " + strings.Join(flagged, ", "), nil
+}
@@ -0,0 +1,91 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Blocklist rejects text matching one of the patterns.
+type Blocklist struct {
+	patterns []*regexp.Regexp
+}
+
+// NewBlocklist compiles the patterns, which are case insensitive.
+func NewBlocklist(patterns []string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation blocklist pattern %q: %w", p, err)
+		}
+		b.patterns = append(b.patterns, re)
+	}
+	return b, nil
+}
+
+func (b *Blocklist) Name() string { return "blocklist" }
+
+func (b *Blocklist) Check(ctx context.Context, role, text string) (string, error) {
+	for _, re := range b.patterns {
+		if re.MatchString(text) {
+			return "matches " + re.String()[len("(?i)"):], nil
+		}
+	}
+	return "", nil
+}
+
+// rule 是一条启发式规则, 命中时加上 weight
+type rule struct {
+	name   string
+	weight int
+	re     *regexp.Regexp
+}
+
+// rules 识别写给模型的聊天式指令, request 规则匹配句首的祈使句. 单条规则容易误判 (原文本身可能是
+// 对话), 所以按权重之和判断.
+var rules = []rule{
+	{"override", 2, regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\b.{0,30}\b(previous|above|prior|all|your)\b.{0,20}\b(instructions?|prompts?|rules?)\b`)},
+	{"override", 2, regexp.MustCompile(`(忽略|无视|忘记).{0,10}(之前|以上|上面|所有|你的).{0,10}(指令|提示|规则|设定)`)},
+	{"request", 1, regexp.MustCompile(`(?i)(^|[.!?]\s)\s*(please\s+)?(write|generate|create|compose|draft|implement|solve|give me|tell me|show me|can you|could you|help me)\b`)},
+	{"request", 1, regexp.MustCompile(`(^|[。！？]\s*)\s*(请你?|麻烦你?)?(帮我|给我|替我|你能|你可以|能否|写一|生成|创作|编写|实现)`)},
+	{"persona", 1, regexp.MustCompile(`(?i)\b(you are now|act as|pretend to be|role-?play as|from now on,? you)\b`)},
+	{"persona", 1, regexp.MustCompile(`(你现在是|扮演|假装你是|从现在开始你)`)},
+	{"assistant", 1, regexp.MustCompile(`(?i)\b(chatgpt|gpt-?[0-9]|system prompt|jailbreak|developer mode)\b|系统提示词|越狱`)},
+	{"polite", 1, regexp.MustCompile(`(?i)^\s*(hi|hello|hey)\b|\b(please|pls)\b.{0,40}\bfor me\b|^\s*(你好|您好)`)},
+}
+
+// Heuristics rejects text for roles that expect text to process, such as
+// translate, when it looks like instructions written to a chat bot.
+type Heuristics struct {
+	roles     []string
+	threshold int
+}
+
+// NewHeuristics checks text of roles; text is blocked when the weights of
+// the matching rules add up to threshold.
+func NewHeuristics(roles []string, threshold int) *Heuristics {
+	return &Heuristics{roles: roles, threshold: max(threshold, 1)}
+}
+
+func (h *Heuristics) Name() string { return "heuristic" }
+
+func (h *Heuristics) Check(ctx context.Context, role, text string) (string, error) {
+	if !slices.Contains(h.roles, role) {
+		return "", nil
+	}
+	score := 0
+	var matched []string
+	for _, r := range rules {
+		if r.re.MatchString(text) && !slices.Contains(matched, r.name) {
+			score += r.weight
+			matched = append(matched, r.name)
+		}
+	}
+	if score < h.threshold {
+		return "", nil
+	}
+	return "looks like chat instructions (" + strings.Join(matched, ", ") + ")", nil
+}
@@ -0,0 +1,98 @@
+// Package ocr extracts the text of images, such as screenshots of scanned
+// pages, with a vision-capable model. The text is cached by the hash of
+// the image, so the same page is only sent to the model once.
+package ocr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/metrics"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// NoText is what the prompt asks the model to answer for images without text.
+const NoText = "NO_TEXT"
+
+var (
+	ErrUnsupported = errors.New("unsupported image format, expected PNG, JPEG, WebP or GIF")
+	ErrNoText      = errors.New("no text found in the image")
+)
+
+// MIMETypes are the accepted image formats.
+var MIMETypes = []string{"image/png", "image/jpeg", "image/webp", "image/gif"}
+
+type Reader struct {
+	repo   database.ImageTextRepository
+	prompt string
+	// model 为空时使用客户端默认的模型
+	model   string
+	metrics *metrics.Metrics
+}
+
+func New(repo database.ImageTextRepository, prompt, model string, m *metrics.Metrics) *Reader {
+	return &Reader{repo: repo, prompt: prompt, model: model, metrics: m}
+}
+
+// Read returns the text of the image data, from the cache if the same image
+// was read before. cached reports whether it was. client must support
+// multi-part messages, see ai.Chat.
+func (r *Reader) Read(ctx context.Context, client ai.Client, data []byte) (record *models.ImageText, cached bool, err error) {
+	mimeType := http.DetectContentType(data)
+	if !slices.Contains(MIMETypes, mimeType) {
+		return nil, false, ErrUnsupported
+	}
+	hash := Hash(data)
+	if record, err = r.repo.FindImageText(ctx, hash); err != nil {
+		return nil, false, err
+	}
+	if record != nil {
+		return record, true, nil
+	}
+
+	model := r.model
+	if model != "" {
+		ctx = ai.WithModel(ctx, model)
+	} else {
+		model = client.Model()
+	}
+	output, err := ai.Chat(ctx, client, r.prompt, []ai.Message{{
+		Role:  ai.RoleUser,
+		Parts: []ai.Part{{Image: &ai.Image{MIMEType: mimeType, Data: data}}},
+	}})
+	if err != nil {
+		return nil, false, err
+	}
+	text := strings.TrimSpace(output)
+	if text == "" || text == NoText {
+		return nil, false, ErrNoText
+	}
+	sum := sha256.Sum256([]byte(r.prompt))
+	record = &models.ImageText{
+		Hash:       hash,
+		MIMEType:   mimeType,
+		Text:       text,
+		AIModel:    model,
+		PromptHash: hex.EncodeToString(sum[:8]),
+	}
+	// 缓存失败不影响本次返回
+	if err := r.repo.SaveImageText(ctx, record); err != nil {
+		r.metrics.CacheWriteFailureCounter.WithLabelValues("image_text").Inc()
+		log.Printf("Error caching text of image %s: %v", hash, err)
+	}
+	return record, false, nil
+}
+
+// Hash returns the cache key of the image data.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/metrics"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// memoryRepo 是内存中的 ImageTextRepository
+type memoryRepo map[string]*models.ImageText
+
+func (r memoryRepo) FindImageText(ctx context.Context, hash string) (*models.ImageText, error) {
+	return r[hash], nil
+}
+
+func (r memoryRepo) SaveImageText(ctx context.Context, record *models.ImageText) error {
+	r[record.Hash] = record
+	return nil
+}
+
+// visionClient 返回固定的文本并记录收到的消息
+type visionClient struct {
+	output   string
+	messages []ai.Message
+	calls    int
+}
+
+func (c *visionClient) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (c *visionClient) Chat(ctx context.Context, prompt string, messages []ai.Message) (string, error) {
+	c.calls++
+	c.messages = messages
+	return c.output, nil
+}
+
+func (c *visionClient) Model() string { return "vision" }
+
+// textClient 不支持多部分消息
+type textClient struct{}
+
+func (textClient) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
+	return "text", nil
+}
+
+func (textClient) Model() string { return "text" }
+
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestRead_Cache(t *testing.T) {
+	r := New(memoryRepo{}, "Extract the text", "", metrics.NewMetricsWith(prometheus.NewRegistry()))
+	client := &visionClient{output: "  The quick brown fox.\n"}
+	ctx := context.Background()
+
+	record, cached, err := r.Read(ctx, client, png)
+	require.NoError(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, "The quick brown fox.", record.Text)
+	assert.Equal(t, "image/png", record.MIMEType)
+	assert.Equal(t, "vision", record.AIModel)
+	require.Len(t, client.messages, 1)
+	require.Len(t, client.messages[0].Parts, 1)
+	assert.Equal(t, png, client.messages[0].Parts[0].Image.Data)
+
+	record, cached, err = r.Read(ctx, client, png)
+	require.NoError(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, "The quick brown fox.", record.Text)
+	assert.Equal(t, 1, client.calls)
+}
+
+func TestRead_Errors(t *testing.T) {
+	r := New(memoryRepo{}, "Extract the text", "", metrics.NewMetricsWith(prometheus.NewRegistry()))
+	ctx := context.Background()
+
+	_, _, err := r.Read(ctx, &visionClient{output: "text"}, []byte("%PDF-1.4"))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	_, _, err = r.Read(ctx, &visionClient{output: NoText}, png)
+	assert.True(t, errors.Is(err, ErrNoText))
+	_, _, err = r.Read(ctx, textClient{}, png)
+	assert.True(t, errors.Is(err, ai.ErrImagesUnsupported))
+}
@@ -0,0 +1,43 @@
+// Package reporting sends errors to an error tracking service. The default
+// Reporter does nothing, so local development needs no account; Sentry is
+// used when a DSN is configured.
+package reporting
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/config"
+)
+
+// Reporter reports errors and panics.
+type Reporter interface {
+	// CaptureError reports err with tags, for example the role and model of
+	// a failed AI call.
+	CaptureError(ctx context.Context, err error, tags map[string]string)
+	// Middleware reports panics of the request and makes the request
+	// available to CaptureError.
+	Middleware() gin.HandlerFunc
+	// Flush waits until the buffered events are sent, at most timeout.
+	Flush(timeout time.Duration)
+}
+
+// Nop is a Reporter that does nothing.
+type Nop struct{}
+
+func (Nop) CaptureError(ctx context.Context, err error, tags map[string]string) {}
+
+func (Nop) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) { c.Next() }
+}
+
+func (Nop) Flush(timeout time.Duration) {}
+
+// New returns a Sentry reporter when dsn is set, and Nop otherwise.
+func New(dsn string, cfg config.ErrorReportingConfig) (Reporter, error) {
+	if dsn == "" {
+		return Nop{}, nil
+	}
+	return NewSentry(dsn, cfg)
+}
@@ -0,0 +1,61 @@
+package reporting
+
+import (
+	"net/url"
+	"testing"
+
+	sentry "github.com/getsentry/sentry-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/config"
+)
+
+func TestNew_NopWithoutDSN(t *testing.T) {
+	r, err := New("", config.ErrorReportingConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, Nop{}, r)
+}
+
+func newEvent() *sentry.Event {
+	return &sentry.Event{
+		User: sentry.User{IPAddress: "203.0.113.7"},
+		Request: &sentry.Request{
+			URL:         "https://example.com/api",
+			QueryString: "role=translate&text=my+secret+diary&selected=diary&model=m1",
+			Data:        `{"question": "why?"}`,
+			Cookies:     "session=1",
+			Headers:     map[string]string{"Cf-Connecting-Ip": "203.0.113.7", "X-Forwarded-For": "203.0.113.7", "Accept": "*/*"},
+			Env:         map[string]string{"REMOTE_ADDR": "203.0.113.7", "REMOTE_PORT": "1234"},
+		},
+	}
+}
+
+func TestScrub(t *testing.T) {
+	event := Scrub(newEvent(), true)
+
+	assert.True(t, event.User.IsEmpty())
+	query, err := url.ParseQuery(event.Request.QueryString)
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"role": {"translate"}, "model": {"m1"}, "text": {Filtered}, "selected": {Filtered},
+	}, query)
+	assert.Equal(t, Filtered, event.Request.Data)
+	assert.Empty(t, event.Request.Cookies)
+	assert.Equal(t, map[string]string{"Cf-Connecting-Ip": Filtered, "X-Forwarded-For": Filtered, "Accept": "*/*"},
+		event.Request.Headers)
+	assert.Empty(t, event.Request.Env)
+}
+
+func TestScrub_KeepText(t *testing.T) {
+	event := Scrub(newEvent(), false)
+
+	// 用户文本保留, IP 仍然去掉
+	assert.True(t, event.User.IsEmpty())
+	assert.Equal(t, "role=translate&text=my+secret+diary&selected=diary&model=m1", event.Request.QueryString)
+	assert.Equal(t, `{"question": "why?"}`, event.Request.Data)
+	assert.Empty(t, event.Request.Cookies)
+	assert.Equal(t, map[string]string{"Cf-Connecting-Ip": Filtered, "X-Forwarded-For": Filtered, "Accept": "*/*"},
+		event.Request.Headers)
+	assert.Empty(t, event.Request.Env)
+}
@@ -0,0 +1,104 @@
+package reporting
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	sentry "github.com/getsentry/sentry-go"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+	"github.com/zzhirong/contextdict/config"
+)
+
+// Filtered replaces scrubbed values.
+const Filtered = "[Filtered]"
+
+// safeParams 是不含用户文本的查询参数, 上报时保留便于排查
+var safeParams = []string{"role", "model", "structured", "regenerate", "ai", "glossary", "voice"}
+
+// 可能暴露用户身份的请求头
+var ipHeaders = []string{"Cf-Connecting-Ip", "X-Forwarded-For", "X-Real-Ip", "True-Client-Ip", "Forwarded", "Cookie", "Authorization"}
+
+// Sentry reports to Sentry.
+type Sentry struct{}
+
+// NewSentry initializes the Sentry SDK. IPs, cookies and the user are
+// never sent; unless cfg.ScrubPII is false the user text in the query and
+// body is removed too.
+func NewSentry(dsn string, cfg config.ErrorReportingConfig) (*Sentry, error) {
+	scrubText := cfg.ScrubPII == nil || *cfg.ScrubPII
+	options := sentry.ClientOptions{
+		Dsn:            dsn,
+		Environment:    cfg.Environment,
+		SampleRate:     cfg.SampleRate,
+		SendDefaultPII: false,
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			return Scrub(event, scrubText)
+		},
+	}
+	if err := sentry.Init(options); err != nil {
+		return nil, err
+	}
+	log.Printf("Sentry error reporting enabled (ScrubPII: %v)", scrubText)
+	return &Sentry{}, nil
+}
+
+func (s *Sentry) CaptureError(ctx context.Context, err error, tags map[string]string) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(tags)
+		hub.CaptureException(err)
+	})
+}
+
+func (s *Sentry) Middleware() gin.HandlerFunc {
+	return sentrygin.New(sentrygin.Options{Repanic: true})
+}
+
+func (s *Sentry) Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
+
+// Scrub removes the IPs from event: identifying headers, cookies, the
+// remote address and the user. With text it also removes the user text:
+// query parameters other than safeParams and the request body.
+func Scrub(event *sentry.Event, text bool) *sentry.Event {
+	event.User = sentry.User{}
+	if r := event.Request; r != nil {
+		r.Cookies = ""
+		for name := range r.Headers {
+			if slices.ContainsFunc(ipHeaders, func(h string) bool { return strings.EqualFold(h, name) }) {
+				r.Headers[name] = Filtered
+			}
+		}
+		delete(r.Env, "REMOTE_ADDR")
+		delete(r.Env, "REMOTE_PORT")
+		if text {
+			r.QueryString = scrubQuery(r.QueryString)
+			if r.Data != "" {
+				r.Data = Filtered
+			}
+		}
+	}
+	return event
+}
+
+func scrubQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return Filtered
+	}
+	for name := range values {
+		if !slices.Contains(safeParams, name) {
+			values[name] = []string{Filtered}
+		}
+	}
+	return values.Encode()
+}
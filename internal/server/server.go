@@ -7,26 +7,14 @@ import (
 	"net/http"
 	"time"
 
-	"context"
-
-	sentry "github.com/getsentry/sentry-go"
-	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
 	"github.com/zzhirong/contextdict/config"
 	"github.com/zzhirong/contextdict/internal/handlers"
 	mw "github.com/zzhirong/contextdict/internal/middleware"
+	"github.com/zzhirong/contextdict/internal/reporting"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/propagation"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
-var tracer = otel.Tracer("gin-server")
-
 // GinServer holds the Gin engine and configuration.
 type GinServer struct {
 	router *gin.Engine
@@ -37,46 +25,32 @@ func New(
 	addr string,
 	maxURLLen int,
 	apiHandler *handlers.APIHandler,
+	adminHandler *handlers.AdminHandler,
+	adminToken string,
 	rlcfg *config.RateLimitConfig,
 	contentFS fs.FS, // Pass embedded FS
-	sentryDsn string,
+	reporter reporting.Reporter,
 ) *GinServer {
 
-	tp, err := initTracer()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}()
-
 	router := gin.New()
 
-	if err := sentry.Init(sentry.ClientOptions{
-		Dsn: sentryDsn,
-		// Adds request headers and IP for users,
-		// visit: https://docs.sentry.io/platforms/go/data-management/data-collected/ for more info
-		SendDefaultPII: true,
-	}); err != nil {
-		log.Printf("Sentry initialization failed: %v\n", err)
-	}
-
-	router.Use(otelgin.Middleware("my-server"))
-	router.Use(traceRole)
+	// 使用 main 中 tracing.Init 设置的全局 TracerProvider, 未启用时不记录.
+	// 校验后的 role 和 model 由 handler 作为属性加到这个 span 上.
+	router.Use(otelgin.Middleware("contextdict"))
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
-	router.Use(sentrygin.New(sentrygin.Options{}))
+	router.Use(reporter.Middleware())
+	router.Use(mw.Metrics(apiHandler.Metrics))
 
 	if rlcfg.Enabled {
 		log.Printf("IP Rate Limiting enabled (Rate: %.2f/s, ExpireDays: %d)", rlcfg.Rate, rlcfg.ExpireDays)
-		router.Use(mw.IPRateLimiter(rlcfg.Rate, rlcfg.ExpireDays, rlcfg.RealIPHeader))
+		router.Use(mw.IPRateLimiter(rlcfg.Rate, rlcfg.ExpireDays, rlcfg.RealIPHeader,
+			apiHandler.Metrics.RateLimitRejectedCounter))
 	} else {
 		log.Println("IP Rate Limiting disabled.")
 	}
 
-	router.Use(mw.LimitURLLen(maxURLLen))
+	router.Use(mw.LimitURLLen(maxURLLen, apiHandler.Metrics.URLLengthRejectedCounter))
 
 	router.GET("/", func(c *gin.Context) {
 		// 注意：不能是 c.FileFromFS("/index.html", http.FS(contentFS)), 不然会被重定向到 `/`
@@ -90,6 +64,62 @@ func New(
 	router.StaticFS("/assets", http.FS(assetsFS))
 
 	router.GET("/api", apiHandler.Handle)
+	router.POST("/api/feedback", apiHandler.Feedback)
+	router.POST("/api/upload", apiHandler.Upload)
+	if apiHandler.Conversations != nil {
+		router.POST("/api/conversations", apiHandler.CreateConversation)
+		router.GET("/api/conversations/:id", apiHandler.GetConversation)
+		router.DELETE("/api/conversations/:id", apiHandler.DeleteConversation)
+		router.POST("/api/conversations/:id/messages", apiHandler.AskConversation)
+	}
+	if apiHandler.Glossaries != nil {
+		router.POST("/api/glossaries", apiHandler.CreateGlossary)
+		router.GET("/api/glossaries/:id", apiHandler.GetGlossary)
+		router.PUT("/api/glossaries/:id", apiHandler.UpdateGlossary)
+		router.DELETE("/api/glossaries/:id", apiHandler.DeleteGlossary)
+		router.POST("/api/glossaries/:id/terms", apiHandler.SaveGlossaryTerms)
+		router.POST("/api/glossaries/:id/import", apiHandler.ImportGlossary)
+		router.DELETE("/api/glossaries/:id/terms/:term_id", apiHandler.DeleteGlossaryTerm)
+	}
+	if apiHandler.OCR != nil {
+		router.POST("/api/ocr", apiHandler.ReadImage)
+	}
+	if apiHandler.TTS != nil {
+		router.GET("/api/tts", apiHandler.Speech)
+	}
+	if apiHandler.Jobs != nil {
+		router.POST("/api/jobs", apiHandler.SubmitJob)
+		router.GET("/api/jobs/:id", apiHandler.GetJob)
+		router.GET("/api/jobs/:id/events", apiHandler.JobEvents)
+	}
+
+	if adminToken != "" {
+		router.GET("/admin", adminHandler.Page)
+		admin := router.Group("/admin", mw.AdminAuth(adminToken))
+		admin.GET("/budget", adminHandler.BudgetStatus)
+		admin.POST("/budget/trip", adminHandler.TripBudget)
+		admin.POST("/budget/reset", adminHandler.ResetBudget)
+		admin.GET("/translations", adminHandler.SearchTranslations)
+		admin.POST("/translations/purge", adminHandler.PurgeTranslations)
+		admin.GET("/translations/:id", adminHandler.GetTranslation)
+		admin.PUT("/translations/:id", adminHandler.UpdateTranslation)
+		admin.DELETE("/translations/:id", adminHandler.DeleteTranslation)
+		admin.POST("/translations/:id/regenerate", adminHandler.RegenerateTranslation)
+		admin.GET("/translations/:id/feedback", adminHandler.ListFeedback)
+		admin.GET("/feedback/poor", adminHandler.PoorlyRated)
+		admin.POST("/candidates/:id/pin", adminHandler.PinCandidate)
+		admin.DELETE("/candidates/:id/pin", adminHandler.PinCandidate)
+		admin.DELETE("/candidates/:id", adminHandler.DeleteCandidate)
+		if adminHandler.Batch != nil {
+			admin.POST("/batch", adminHandler.SubmitBatch)
+			admin.POST("/batch/upload", adminHandler.UploadBatch)
+			admin.GET("/batch", adminHandler.ListBatches)
+			admin.GET("/batch/:id", adminHandler.BatchStatus)
+			admin.POST("/batch/:id/resume", adminHandler.ResumeBatch)
+		}
+	} else {
+		log.Println("Admin API disabled (no Admin.Token configured).")
+	}
 
 	return &GinServer{
 		router: router,
@@ -97,17 +127,6 @@ func New(
 	}
 }
 
-func traceRole(c *gin.Context) {
-	_, span := tracer.Start(c.Request.Context(),
-		"getUser",
-		oteltrace.WithAttributes(
-			attribute.String("id", c.Query("role")),
-		),
-	)
-	defer span.End()
-	c.Next()
-}
-
 // Start runs the Gin HTTP server.
 func (s *GinServer) Start() *http.Server {
 	srv := &http.Server{
@@ -126,18 +145,3 @@ func (s *GinServer) Start() *http.Server {
 	}()
 	return srv
 }
-
-func initTracer() (*sdktrace.TracerProvider, error) {
-	// exporter, err := stdout.New(stdout.WithPrettyPrint())
-	exporter, err := otlptrace.New(context.TODO(), otlptracehttp.NewClient())
-	if err != nil {
-		return nil, err
-	}
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exporter),
-	)
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	return tp, nil
-}
@@ -0,0 +1,132 @@
+package summarize
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/batch"
+)
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+	// heading 匹配 Markdown 标题和 "1.2 Title" 形式的编号标题
+	heading = regexp.MustCompile(`^(#{1,6}\s+\S|\d+(\.\d+)*\.?\s+\p{Lu}[^.!?。]{0,80}$)`)
+)
+
+// Split splits text into chunks of at most maxTokens estimated tokens.
+// Paragraphs are kept together where possible and a heading starts a new
+// chunk once the current one is half full, so chunks follow the document
+// structure. Paragraphs that are too long are split by sentences.
+func Split(text string, maxTokens int) []string {
+	var chunks []string
+	var cur strings.Builder
+	curTokens := 0
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		cur.Reset()
+		curTokens = 0
+	}
+	add := func(block string, tokens int) {
+		if curTokens > 0 && curTokens+tokens > maxTokens {
+			flush()
+		}
+		if curTokens > 0 {
+			cur.WriteString("\n\n")
+		}
+		cur.WriteString(block)
+		curTokens += tokens
+	}
+
+	for _, block := range blocks(text) {
+		tokens := EstimateTokens(block)
+		if heading.MatchString(block) && curTokens > maxTokens/2 {
+			flush()
+		}
+		if tokens <= maxTokens {
+			add(block, tokens)
+			continue
+		}
+		for _, piece := range splitLong(block, maxTokens) {
+			add(piece, EstimateTokens(piece))
+		}
+	}
+	flush()
+	return chunks
+}
+
+// blocks returns the paragraphs of text; a heading line is its own block
+// even when it is not followed by a blank line.
+func blocks(text string) []string {
+	var result []string
+	for _, para := range paragraphBreak.Split(text, -1) {
+		var body []string
+		for _, line := range strings.Split(para, "\n") {
+			line = strings.TrimRight(line, " \t\r")
+			if heading.MatchString(strings.TrimSpace(line)) {
+				if len(body) > 0 {
+					result = append(result, strings.Join(body, "\n"))
+					body = nil
+				}
+				result = append(result, strings.TrimSpace(line))
+				continue
+			}
+			body = append(body, line)
+		}
+		if s := strings.TrimSpace(strings.Join(body, "\n")); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// splitLong splits an oversized paragraph into pieces by sentences, and
+// sentences that are still too long by characters.
+func splitLong(block string, maxTokens int) []string {
+	var pieces []string
+	var cur strings.Builder
+	curTokens := 0
+	for _, s := range batch.SplitSentences(block) {
+		tokens := EstimateTokens(s)
+		if tokens > maxTokens {
+			if cur.Len() > 0 {
+				pieces = append(pieces, cur.String())
+				cur.Reset()
+				curTokens = 0
+			}
+			pieces = append(pieces, splitRunes(s, maxTokens)...)
+			continue
+		}
+		if curTokens > 0 && curTokens+tokens > maxTokens {
+			pieces = append(pieces, cur.String())
+			cur.Reset()
+			curTokens = 0
+		}
+		if cur.Len() > 0 {
+			cur.WriteString(" ")
+		}
+		cur.WriteString(s)
+		curTokens += tokens
+	}
+	if cur.Len() > 0 {
+		pieces = append(pieces, cur.String())
+	}
+	return pieces
+}
+
+func splitRunes(s string, maxTokens int) []string {
+	var pieces []string
+	runes := []rune(s)
+	start := 0
+	for start < len(runes) {
+		// 从估算上限开始缩小, 直到这一段不超过 maxTokens
+		end := min(len(runes), start+maxTokens*4)
+		for end > start+1 && EstimateTokens(string(runes[start:end])) > maxTokens {
+			end -= max(1, (end-start)/8)
+		}
+		pieces = append(pieces, string(runes[start:end]))
+		start = end
+	}
+	return pieces
+}
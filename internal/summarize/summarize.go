@@ -0,0 +1,104 @@
+// Package summarize summarizes documents that do not fit into the model
+// context: the text is split into chunks that are summarized in parallel
+// (map), then the partial summaries are merged (reduce).
+package summarize
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/ai"
+)
+
+// maxLevels 限制 reduce 的层数, 每一层部分摘要都会变短, 一般一两层就够了
+const maxLevels = 3
+
+type Summarizer struct {
+	cfg         config.SummarizeConfig
+	prompt      string
+	mergePrompt string
+}
+
+// New returns a Summarizer using prompt for chunks and mergePrompt to merge
+// the partial summaries; prompt is used for both if mergePrompt is empty.
+func New(cfg config.SummarizeConfig, prompt, mergePrompt string) *Summarizer {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if mergePrompt == "" {
+		mergePrompt = prompt
+	}
+	return &Summarizer{cfg: cfg, prompt: prompt, mergePrompt: mergePrompt}
+}
+
+// ChunkTokens returns the chunk size for model. A quarter of the context
+// is used for the text, leaving room for the prompt and the output.
+func (s *Summarizer) ChunkTokens(model string) int {
+	n := ContextWindow(model, s.cfg.ContextTokens, s.cfg.DefaultContextTokens) / 4
+	if s.cfg.MaxChunkTokens > 0 && n > s.cfg.MaxChunkTokens {
+		n = s.cfg.MaxChunkTokens
+	}
+	return max(n, 256)
+}
+
+// Summarize summarizes text with client. Text that fits into one chunk is
+// sent as is, like any other role.
+func (s *Summarizer) Summarize(ctx context.Context, client ai.Client, text string) (string, error) {
+	limit := s.ChunkTokens(client.Model())
+	chunks := Split(text, limit)
+	if len(chunks) <= 1 {
+		return client.Generate(ctx, s.prompt, text)
+	}
+	for level := 1; ; level++ {
+		log.Printf("Summarizing %d chunks of up to %d tokens (level %d)", len(chunks), limit, level)
+		partials, err := s.summarizeChunks(ctx, client, chunks)
+		if err != nil {
+			return "", err
+		}
+		joined := strings.Join(partials, "\n\n")
+		if EstimateTokens(joined) <= limit || level >= maxLevels {
+			return client.Generate(ctx, s.mergePrompt, joined)
+		}
+		chunks = Split(joined, limit)
+	}
+}
+
+// summarizeChunks summarizes chunks with at most cfg.Concurrency calls in
+// flight and returns the summaries in the order of the chunks.
+func (s *Summarizer) summarizeChunks(ctx context.Context, client ai.Client, chunks []string) ([]string, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	partials := make([]string, len(chunks))
+	sem := make(chan struct{}, s.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			summary, err := client.Generate(ctx, s.prompt, chunk)
+			if err != nil {
+				cancel(fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err))
+				return
+			}
+			partials[i] = summary
+		}()
+	}
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+	return partials, nil
+}
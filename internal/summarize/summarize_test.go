@@ -0,0 +1,92 @@
+package summarize
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zzhirong/contextdict/config"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 3, EstimateTokens("hello world!"))
+	assert.Equal(t, 4, EstimateTokens("你好世界"))
+	assert.Equal(t, 3, EstimateTokens("Go 语言"))
+}
+
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, 64000, ContextWindow("deepseek-chat", nil, 1000))
+	assert.Equal(t, 2000, ContextWindow("deepseek-chat", map[string]int{"deepseek-chat": 2000}, 1000))
+	assert.Equal(t, 1000, ContextWindow("unknown", nil, 1000))
+}
+
+func TestSplit(t *testing.T) {
+	para := strings.Repeat("word ", 40) // ~50 tokens
+	doc := "# Intro\n" + para + "\n\n" + para + "\n\n## Details\n\n" + para + "\n\n" + para
+
+	chunks := Split(doc, 120)
+	require.Len(t, chunks, 2)
+	assert.True(t, strings.HasPrefix(chunks[0], "# Intro"))
+	assert.True(t, strings.HasPrefix(chunks[1], "## Details"))
+	for _, c := range chunks {
+		assert.LessOrEqual(t, EstimateTokens(c), 120)
+	}
+
+	assert.Equal(t, []string{"short text"}, Split("short text", 120))
+}
+
+func TestSplit_LongParagraph(t *testing.T) {
+	sentence := strings.Repeat("x", 100) + ". " // ~26 tokens
+	doc := strings.Repeat("A"+sentence, 10) + strings.Repeat("y", 1000)
+
+	chunks := Split(doc, 60)
+	for _, c := range chunks {
+		assert.LessOrEqual(t, EstimateTokens(c), 60)
+	}
+	assert.Equal(t, strings.ReplaceAll(doc, " ", ""), strings.ReplaceAll(strings.Join(chunks, ""), " ", ""))
+}
+
+type fakeClient struct {
+	calls atomic.Int32
+	fail  bool
+}
+
+func (c *fakeClient) Generate(_ context.Context, prompt string, texts ...string) (string, error) {
+	c.calls.Add(1)
+	if c.fail {
+		return "", errors.New("AI error")
+	}
+	if prompt == "merge" {
+		return "merged(" + texts[0] + ")", nil
+	}
+	return "s" + texts[0][:2], nil
+}
+
+func (c *fakeClient) Model() string { return "unknown" }
+
+func TestSummarize(t *testing.T) {
+	s := New(config.SummarizeConfig{Concurrency: 2, DefaultContextTokens: 1200}, "summarize", "merge")
+	require.Equal(t, 300, s.ChunkTokens("unknown"))
+
+	client := &fakeClient{}
+	result, err := s.Summarize(context.Background(), client, "c1 short")
+	require.NoError(t, err)
+	assert.Equal(t, "sc1", result)
+	assert.EqualValues(t, 1, client.calls.Load())
+
+	para := strings.Repeat("word ", 200) // ~250 tokens, one chunk each
+	doc := "c1 " + para + "\n\nc2 " + para + "\n\nc3 " + para
+	client = &fakeClient{}
+	result, err = s.Summarize(context.Background(), client, doc)
+	require.NoError(t, err)
+	assert.Equal(t, "merged(sc1\n\nsc2\n\nsc3)", result)
+	assert.EqualValues(t, 4, client.calls.Load())
+
+	_, err = s.Summarize(context.Background(), &fakeClient{fail: true}, doc)
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package summarize
+
+import (
+	"strings"
+	"unicode"
+)
+
+// contextWindows 是常见模型的上下文长度 (token), 未列出的模型使用配置的默认值
+var contextWindows = map[string]int{
+	"deepseek-chat":     64000,
+	"deepseek-reasoner": 64000,
+	"gpt-4o":            128000,
+	"gpt-4o-mini":       128000,
+	"gpt-4.1":           1000000,
+	"gpt-4.1-mini":      1000000,
+	"gpt-3.5-turbo":     16000,
+}
+
+// ContextWindow returns the context length of model in tokens; overrides
+// take precedence over the built-in table, and fallback is used for
+// unknown models.
+func ContextWindow(model string, overrides map[string]int, fallback int) int {
+	if n, ok := overrides[model]; ok && n > 0 {
+		return n
+	}
+	if n, ok := contextWindows[strings.ToLower(model)]; ok {
+		return n
+	}
+	return fallback
+}
+
+// EstimateTokens roughly estimates the number of tokens of text without a
+// tokenizer: a CJK character is about one token, other text about four
+// bytes per token. It errs on the high side, which is what chunking needs.
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
@@ -0,0 +1,205 @@
+// Package textclean fixes the mechanical damage of text copied from PDFs
+// (hyphenated line breaks, broken lines, stray spaces, ligatures and mixed
+// full-width punctuation) without calling the model. The rules follow the
+// text part of the format prompt; paragraphs that look like code are only
+// trimmed.
+package textclean
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// charReplacer 展开连字并去掉不可见字符
+var charReplacer = strings.NewReplacer(
+	"\r\n", "\n", "\r", "\n",
+	"ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st",
+	"\u00ad", "", // soft hyphen
+	"\u200b", "", "\u200c", "", "\u200d", "", "\ufeff", "", // 零宽字符
+	"\u00a0", " ",
+)
+
+var (
+	paragraphBreak    = regexp.MustCompile(`\n[ \t]*\n`)
+	listItem          = regexp.MustCompile(`^([-*•·▪]\s|\d{1,3}[.)]\s|\(?[a-z]\)\s|#{1,6}\s)`)
+	spaceRun          = regexp.MustCompile(`(\S) {2,}`)
+	spaceBefore       = regexp.MustCompile(` +([,.;:!?%)\]”])`)
+	spaceAfterOpen    = regexp.MustCompile(`([(\[“]) +`)
+	missingAfter      = regexp.MustCompile(`([,;])(\p{L})`)
+	missingAfterEnd   = regexp.MustCompile(`(\p{Ll}\p{Ll})([.!?])(\p{Lu}\p{Ll})`)
+	missingAfterParen = regexp.MustCompile(`\)(\p{L})`)
+	cjkSpace          = regexp.MustCompile(`(\p{Han}|\p{Hiragana}|\p{Katakana}) +(\p{Han}|\p{Hiragana}|\p{Katakana})`)
+	cjkPunct          = regexp.MustCompile(`(\p{Han}|[）」』]) *([,;:?!]) *`)
+	cjkPeriod         = regexp.MustCompile(`(\p{Han}) *\.( |$)`)
+	cjkParens         = regexp.MustCompile(`\(([^()]*\p{Han}[^()]*)\)`)
+	fullWidthSpace    = regexp.MustCompile(` *([，。；：？！、（）「」『』]) *`)
+)
+
+// toFullWidth 和 toHalfWidth 是中文和西文段落中标点的对应关系
+var (
+	toFullWidth = map[string]string{",": "，", ";": "；", ":": "：", "?": "？", "!": "！"}
+	toHalfWidth = strings.NewReplacer(
+		"，", ", ", "。", ". ", "；", "; ", "：", ": ", "！", "! ", "？", "? ",
+		"（", " (", "）", ") ", "【", " [", "】", "] ", "、", ", ", "\u3000", " ",
+	)
+)
+
+// Clean applies all rules to text. It is deterministic and idempotent.
+func Clean(text string) string {
+	text = fullWidthAlnum(charReplacer.Replace(text))
+	var paras []string
+	for _, para := range paragraphBreak.Split(text, -1) {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		if LooksLikeCode(para) {
+			paras = append(paras, trimLines(para))
+			continue
+		}
+		para = joinLines(para)
+		if isCJK(para) {
+			para = cleanCJK(para)
+		} else {
+			para = cleanLatin(para)
+		}
+		paras = append(paras, para)
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// fullWidthAlnum 把全角字母和数字转换为半角
+func fullWidthAlnum(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９', r >= 'Ａ' && r <= 'Ｚ', r >= 'ａ' && r <= 'ｚ':
+			return r - 0xfee0
+		}
+		return r
+	}, text)
+}
+
+func trimLines(para string) string {
+	lines := strings.Split(strings.Trim(para, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinLines 合并段落内被版式打断的行. 列表项和标题保持独立的行.
+// 行尾的连字符后接小写字母时是断词, 去掉连字符; 否则是复合词, 保留连字符.
+func joinLines(para string) string {
+	var b strings.Builder
+	prevHeading := false
+	for i, line := range strings.Split(para, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		item := listItem.MatchString(line)
+		if i > 0 && b.Len() > 0 {
+			prev := b.String()
+			last, _ := lastRune(prev)
+			first := []rune(line)[0]
+			switch {
+			case item || prevHeading:
+				b.WriteString("\n")
+			case last == '-' && unicode.IsLower(first) && endsWithLowerHyphen(prev):
+				trimmed := strings.TrimSuffix(prev, "-")
+				b.Reset()
+				b.WriteString(trimmed)
+			case last == '-' || isCJKRune(last) || isCJKRune(first):
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(line)
+		prevHeading = strings.HasPrefix(line, "#")
+	}
+	return b.String()
+}
+
+func lastRune(s string) (rune, bool) {
+	r := []rune(s)
+	if len(r) == 0 {
+		return 0, false
+	}
+	return r[len(r)-1], true
+}
+
+func endsWithLowerHyphen(s string) bool {
+	r := []rune(s)
+	return len(r) >= 2 && unicode.IsLower(r[len(r)-2])
+}
+
+func cleanLatin(para string) string {
+	para = toHalfWidth.Replace(strings.ReplaceAll(para, "\t", " "))
+	para = strings.TrimSpace(spaceRun.ReplaceAllString(para, "$1 "))
+	para = spaceBefore.ReplaceAllString(para, "$1")
+	para = spaceAfterOpen.ReplaceAllString(para, "$1")
+	para = missingAfter.ReplaceAllString(para, "$1 $2")
+	para = missingAfterEnd.ReplaceAllString(para, "$1$2 $3")
+	para = missingAfterParen.ReplaceAllString(para, ") $1")
+	return para
+}
+
+func cleanCJK(para string) string {
+	para = strings.ReplaceAll(para, "\t", " ")
+	para = strings.TrimSpace(spaceRun.ReplaceAllString(para, "$1 "))
+	// 替换结果和下一次匹配共用一个字符, 需要重复直到没有变化
+	for {
+		next := cjkSpace.ReplaceAllString(para, "$1$2")
+		if next == para {
+			break
+		}
+		para = next
+	}
+	para = cjkParens.ReplaceAllString(para, "（$1）")
+	para = cjkPunct.ReplaceAllStringFunc(para, func(m string) string {
+		sub := cjkPunct.FindStringSubmatch(m)
+		return sub[1] + toFullWidth[sub[2]]
+	})
+	para = cjkPeriod.ReplaceAllString(para, "$1。")
+	// 全角标点自带间距, 前后不需要空格
+	para = fullWidthSpace.ReplaceAllString(para, "$1")
+	return strings.TrimSpace(para)
+}
+
+// isCJK 报告段落是否以中日文为主
+func isCJK(para string) bool {
+	cjk, letters := 0, 0
+	for _, r := range para {
+		switch {
+		case isCJKRune(r):
+			cjk++
+			letters++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+	// 西文字母按单词计算大约是汉字的 5 倍
+	return letters > 0 && cjk*5 > letters-cjk
+}
+
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+var codeLine = regexp.MustCompile(`([{};]|\)\s*:|=>|:=)\s*$|^\s*(}|\)|//|#include|def |func |import |return\b|if\s*\(|for\s*\()`)
+
+// LooksLikeCode reports whether most lines of para look like source code:
+// indented lines or lines with statement and block punctuation.
+func LooksLikeCode(para string) bool {
+	lines := strings.Split(strings.Trim(para, "\n"), "\n")
+	if len(lines) < 2 {
+		return false
+	}
+	code := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t") || codeLine.MatchString(line) {
+			code++
+		}
+	}
+	return code*2 >= len(lines)
+}
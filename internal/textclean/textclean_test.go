@@ -0,0 +1,50 @@
+package textclean
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestClean_Golden cleans the samples in testdata/*.txt, which were copied
+// from PDFs, and compares the result with the .golden file next to them.
+// Run with -update after changing a rule and review the diff.
+func TestClean_Golden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(input)
+			require.NoError(t, err)
+			got := Clean(string(raw)) + "\n"
+
+			golden := strings.TrimSuffix(input, ".txt") + ".golden"
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(got), 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), got)
+
+			// 再次清理不应有变化
+			assert.Equal(t, got, Clean(got)+"\n")
+		})
+	}
+}
+
+func TestLooksLikeCode(t *testing.T) {
+	assert.True(t, LooksLikeCode("if (x) {\n  return y;\n}"))
+	assert.True(t, LooksLikeCode("def f(x):\n    return x"))
+	assert.False(t, LooksLikeCode("A closure captures\nvariables from its scope."))
+	assert.False(t, LooksLikeCode("single line;"))
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zzhirong/contextdict/config"
+)
+
+func TestInit(t *testing.T) {
+	ctx := context.Background()
+	shutdown, err := Init(ctx, config.TracingConfig{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(ctx))
+
+	_, err = Init(ctx, config.TracingConfig{Enabled: true, Exporter: "zipkin"})
+	assert.Error(t, err)
+
+	shutdown, err = Init(ctx, config.TracingConfig{Enabled: true, Exporter: "stdout", SampleRatio: 1, ServiceName: "test"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(ctx))
+}
+
+func TestSampler(t *testing.T) {
+	params := func(parent trace.SpanContext) sdktrace.SamplingParameters {
+		return sdktrace.SamplingParameters{
+			ParentContext: trace.ContextWithSpanContext(context.Background(), parent),
+			TraceID:       trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			Name:          "span",
+		}
+	}
+	assert.Equal(t, sdktrace.Drop, Sampler(0).ShouldSample(params(trace.SpanContext{})).Decision)
+	assert.Equal(t, sdktrace.RecordAndSample, Sampler(1).ShouldSample(params(trace.SpanContext{})).Decision)
+
+	// 上游已经采样的 trace 不按比例丢弃
+	sampled := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	assert.Equal(t, sdktrace.RecordAndSample, Sampler(0).ShouldSample(params(sampled)).Decision)
+}
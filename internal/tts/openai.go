@@ -0,0 +1,58 @@
+package tts
+
+import (
+	"context"
+	"io"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/zzhirong/contextdict/config"
+)
+
+var contentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+}
+
+// OpenAI uses an OpenAI compatible /audio/speech endpoint.
+type OpenAI struct {
+	client *openai.Client
+	model  string
+	format string
+}
+
+func NewOpenAI(cfg config.TTSConfig, apiKey string) *OpenAI {
+	oaiConfig := openai.DefaultConfig(apiKey)
+	if cfg.BaseURL != "" {
+		oaiConfig.BaseURL = cfg.BaseURL
+	}
+	format := cfg.Format
+	if _, ok := contentTypes[format]; !ok {
+		format = "mp3"
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(oaiConfig), model: cfg.Model, format: format}
+}
+
+func (p *OpenAI) Name() string {
+	return "openai/" + p.model + "/" + p.format
+}
+
+func (p *OpenAI) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	resp, err := p.client.CreateSpeech(ctx, openai.CreateSpeechRequest{
+		Model:          openai.SpeechModel(p.model),
+		Input:          text,
+		Voice:          openai.SpeechVoice(voice),
+		ResponseFormat: openai.SpeechResponseFormat(p.format),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Close()
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentTypes[p.format], nil
+}
@@ -0,0 +1,129 @@
+// Package tts reads words and sentences aloud. Speech is generated by a
+// Provider and stored in the database, so that repeated requests for the
+// same text and voice are served from the cache like translations.
+package tts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/metrics"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+var (
+	ErrEmpty        = errors.New("no text to read")
+	ErrTooLong      = errors.New("text is too long to read")
+	ErrInvalidVoice = errors.New("invalid voice")
+)
+
+// Provider generates speech.
+type Provider interface {
+	// Synthesize returns the audio of text read with voice and its content type.
+	Synthesize(ctx context.Context, text, voice string) ([]byte, string, error)
+	// Name identifies the provider and model in the cache key.
+	Name() string
+}
+
+// NewProvider returns the provider selected by cfg.Provider. apiKey is used
+// when cfg.APIKey is empty.
+func NewProvider(cfg config.TTSConfig, apiKey string) (Provider, error) {
+	switch cfg.Provider {
+	case "openai", "":
+		if cfg.APIKey != "" {
+			apiKey = cfg.APIKey
+		}
+		return NewOpenAI(cfg, apiKey), nil
+	case "local":
+		return Local{}, nil
+	}
+	return nil, fmt.Errorf("unknown TTS provider %q", cfg.Provider)
+}
+
+type Service struct {
+	provider Provider
+	repo     database.AudioRepository
+	cfg      config.TTSConfig
+	metrics  *metrics.Metrics
+}
+
+func New(provider Provider, repo database.AudioRepository, cfg config.TTSConfig, m *metrics.Metrics) *Service {
+	return &Service{provider: provider, repo: repo, cfg: cfg, metrics: m}
+}
+
+// Voices returns the default voice followed by the other allowed voices.
+func (s *Service) Voices() []string {
+	voices := []string{s.cfg.Voice}
+	for _, v := range s.cfg.Voices {
+		if !slices.Contains(voices, v) {
+			voices = append(voices, v)
+		}
+	}
+	return voices
+}
+
+// Speak returns the speech of text, from the cache if it was generated
+// before. cached reports whether it was. An empty voice selects the default.
+// allow, if not nil, is called before new speech is generated, and its
+// error is returned, for example when the budget is exhausted.
+func (s *Service) Speak(ctx context.Context, text, voice string, allow func() error) (audio *models.Audio, cached bool, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, false, ErrEmpty
+	}
+	if s.cfg.MaxTextLen > 0 && len([]rune(text)) > s.cfg.MaxTextLen {
+		return nil, false, fmt.Errorf("%w: at most %d characters", ErrTooLong, s.cfg.MaxTextLen)
+	}
+	if voice == "" {
+		voice = s.cfg.Voice
+	}
+	if !slices.Contains(s.Voices(), voice) {
+		return nil, false, ErrInvalidVoice
+	}
+
+	key := Key(s.provider.Name(), voice, text)
+	if audio, err = s.repo.FindAudio(ctx, key); err != nil {
+		return nil, false, err
+	}
+	if audio != nil {
+		return audio, true, nil
+	}
+	if allow != nil {
+		if err := allow(); err != nil {
+			return nil, false, err
+		}
+	}
+	data, contentType, err := s.provider.Synthesize(ctx, text, voice)
+	if err != nil {
+		return nil, false, err
+	}
+	audio = &models.Audio{
+		Key:         key,
+		Text:        text,
+		Voice:       voice,
+		Provider:    s.cfg.Provider,
+		AIModel:     s.provider.Name(),
+		ContentType: contentType,
+		Data:        data,
+	}
+	// 缓存失败不影响本次返回
+	if err := s.repo.SaveAudio(ctx, audio); err != nil {
+		s.metrics.CacheWriteFailureCounter.WithLabelValues("audio").Inc()
+		log.Printf("Error caching audio for '%s': %v", text, err)
+	}
+	return audio, false, nil
+}
+
+// Key returns the cache key of text read by provider with voice.
+func Key(provider, voice, text string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + voice + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,95 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/config"
+	"github.com/zzhirong/contextdict/internal/metrics"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// memoryRepo 是内存中的 AudioRepository
+type memoryRepo map[string]*models.Audio
+
+func (r memoryRepo) FindAudio(ctx context.Context, key string) (*models.Audio, error) {
+	return r[key], nil
+}
+
+func (r memoryRepo) SaveAudio(ctx context.Context, record *models.Audio) error {
+	r[record.Key] = record
+	return nil
+}
+
+// countingProvider 记录调用次数
+type countingProvider struct {
+	Local
+	calls int
+}
+
+func (p *countingProvider) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	p.calls++
+	return p.Local.Synthesize(ctx, text, voice)
+}
+
+func TestSpeak_Cache(t *testing.T) {
+	provider := &countingProvider{}
+	s := New(provider, memoryRepo{}, config.TTSConfig{Provider: "local", Voice: "alloy", Voices: []string{"nova"}, MaxTextLen: 20}, metrics.NewMetricsWith(prometheus.NewRegistry()))
+	ctx := context.Background()
+
+	audio, cached, err := s.Speak(ctx, " serendipity ", "", nil)
+	require.NoError(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, "alloy", audio.Voice)
+	assert.Equal(t, "serendipity", audio.Text)
+	assert.Equal(t, "audio/wav", audio.ContentType)
+	assert.Equal(t, "RIFF", string(audio.Data[:4]))
+
+	again, cached, err := s.Speak(ctx, "serendipity", "alloy", nil)
+	require.NoError(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, audio.Data, again.Data)
+	assert.Equal(t, 1, provider.calls)
+
+	// 不同的声音分别缓存
+	other, cached, err := s.Speak(ctx, "serendipity", "nova", nil)
+	require.NoError(t, err)
+	assert.False(t, cached)
+	assert.NotEqual(t, audio.Data, other.Data)
+	assert.Equal(t, 2, provider.calls)
+
+	// 超出预算时只返回缓存
+	exhausted := errors.New("exhausted")
+	_, cached, err = s.Speak(ctx, "serendipity", "nova", func() error { return exhausted })
+	require.NoError(t, err)
+	assert.True(t, cached)
+	_, _, err = s.Speak(ctx, "luck", "nova", func() error { return exhausted })
+	assert.Equal(t, exhausted, err)
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestSpeak_Invalid(t *testing.T) {
+	s := New(Local{}, memoryRepo{}, config.TTSConfig{Voice: "alloy", MaxTextLen: 5}, metrics.NewMetricsWith(prometheus.NewRegistry()))
+	ctx := context.Background()
+	_, _, err := s.Speak(ctx, "  ", "", nil)
+	assert.True(t, errors.Is(err, ErrEmpty))
+	_, _, err = s.Speak(ctx, strings.Repeat("长", 6), "", nil)
+	assert.True(t, errors.Is(err, ErrTooLong))
+	_, _, err = s.Speak(ctx, "word", "nova", nil)
+	assert.True(t, errors.Is(err, ErrInvalidVoice))
+}
+
+func TestLocal_WAV(t *testing.T) {
+	data, contentType, err := Local{}.Synthesize(context.Background(), "two words", "alloy")
+	require.NoError(t, err)
+	assert.Equal(t, "audio/wav", contentType)
+	assert.Equal(t, "WAVE", string(data[8:12]))
+	// 44 字节的头, 每个单词 0.25 秒的 16 位采样
+	assert.Len(t, data, 44+2*2*(sampleRate/5+sampleRate/20))
+}
@@ -0,0 +1,97 @@
+// Package wordsense asks the model for the meaning of a word or phrase in
+// its context as JSON, so that the result can be stored in vocabulary
+// tools instead of being free-form markdown.
+package wordsense
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/models"
+)
+
+// MaxAttempts is the number of times the model is asked before giving up
+// on invalid output.
+const MaxAttempts = 3
+
+// PartsOfSpeech are the allowed values of Sense.POS.
+var PartsOfSpeech = []string{
+	"noun", "verb", "adjective", "adverb", "pronoun", "preposition", "conjunction",
+	"interjection", "determiner", "numeral", "phrase", "idiom", "phrasal verb", "abbreviation",
+}
+
+// Schema is the JSON schema of models.Sense sent to the model.
+var Schema = ai.Schema{Name: "word_sense", Schema: json.RawMessage(schema())}
+
+func schema() string {
+	pos, _ := json.Marshal(PartsOfSpeech)
+	return `{
+  "type": "object",
+  "properties": {
+    "lemma": {"type": "string", "description": "dictionary form of the word or phrase"},
+    "pos": {"type": "string", "enum": ` + string(pos) + `},
+    "sense": {"type": "string", "description": "meaning in this context"},
+    "translation": {"type": "string", "description": "translation in this context"},
+    "example": {"type": "string", "description": "another example sentence with the same meaning"},
+    "notes": {"type": "string", "description": "usage notes, collocations or register, may be empty"}
+  },
+  "required": ["lemma", "pos", "sense", "translation", "example", "notes"],
+  "additionalProperties": false
+}`
+}
+
+// Parse validates the model output and returns the sense. Markdown code
+// fences around the JSON are ignored.
+func Parse(output string) (*models.Sense, error) {
+	output = ai.TrimCodeFence(output)
+	var s models.Sense
+	if err := json.Unmarshal([]byte(output), &s); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	s.Lemma = strings.TrimSpace(s.Lemma)
+	s.POS = strings.ToLower(strings.TrimSpace(s.POS))
+	switch {
+	case s.Lemma == "":
+		return nil, errors.New("missing lemma")
+	case !slices.Contains(PartsOfSpeech, s.POS):
+		return nil, fmt.Errorf("invalid pos %q", s.POS)
+	case strings.TrimSpace(s.Sense) == "":
+		return nil, errors.New("missing sense")
+	case strings.TrimSpace(s.Translation) == "":
+		return nil, errors.New("missing translation")
+	}
+	return &s, nil
+}
+
+// Generate asks client for the sense of selected within text and retries
+// while the output is invalid, see ai.GenerateJSON.
+func Generate(ctx context.Context, client ai.Client, prompt, selected, text string, onInvalid func(error)) (*models.Sense, error) {
+	return ai.GenerateJSON(ctx, client, Schema, MaxAttempts, Parse, onInvalid, prompt, selected, text)
+}
+
+// Key returns the cache key of selected within text.
+func Key(text, selected string) string {
+	sum := sha256.Sum256([]byte(selected + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Markdown renders s for display.
+func Markdown(s *models.Sense) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** *%s*\n\n", s.Lemma, s.POS)
+	fmt.Fprintf(&b, "%s\n\n%s\n", s.Translation, s.Sense)
+	if s.Example != "" {
+		fmt.Fprintf(&b, "\n> %s\n", s.Example)
+	}
+	if s.Notes != "" {
+		fmt.Fprintf(&b, "\n%s\n", s.Notes)
+	}
+	return strings.TrimSpace(b.String())
+}
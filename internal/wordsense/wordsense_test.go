@@ -0,0 +1,76 @@
+package wordsense
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzhirong/contextdict/internal/ai"
+)
+
+// fakeClient 依次返回 outputs 中的结果
+type fakeClient struct {
+	outputs []string
+	calls   int
+}
+
+func (c *fakeClient) Generate(ctx context.Context, prompt string, texts ...string) (string, error) {
+	out := c.outputs[c.calls]
+	c.calls++
+	return out, nil
+}
+
+func (c *fakeClient) Model() string { return "test-model" }
+
+const valid = `{"lemma":"run","pos":"Verb","sense":"to manage","translation":"经营","example":"She runs a bakery.","notes":""}`
+
+func TestSchemaIsValidJSON(t *testing.T) {
+	assert.True(t, json.Valid(Schema.Schema))
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse("```json\n" + valid + "\n```")
+	require.NoError(t, err)
+	assert.Equal(t, "run", s.Lemma)
+	assert.Equal(t, "verb", s.POS)
+	assert.Equal(t, "经营", s.Translation)
+
+	for _, bad := range []string{
+		`not json`,
+		`{"lemma":"run","pos":"verb","sense":"to manage"}`,
+		`{"lemma":"run","pos":"gerund","sense":"to manage","translation":"经营"}`,
+		`{"lemma":"","pos":"verb","sense":"to manage","translation":"经营"}`,
+	} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestGenerate_RetriesInvalidOutput(t *testing.T) {
+	client := &fakeClient{outputs: []string{"Sure! Here it is:", valid}}
+	var invalid []error
+	s, err := Generate(context.Background(), client, "prompt", "runs", "She runs a bakery.", func(err error) {
+		invalid = append(invalid, err)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "run", s.Lemma)
+	assert.Equal(t, 2, client.calls)
+	assert.Len(t, invalid, 1)
+}
+
+func TestGenerate_GivesUp(t *testing.T) {
+	client := &fakeClient{outputs: []string{"a", "b", "c", valid}}
+	_, err := Generate(context.Background(), client, "prompt", "runs", "She runs a bakery.", nil)
+	assert.True(t, errors.Is(err, ai.ErrInvalidOutput))
+	assert.Equal(t, MaxAttempts, client.calls)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, Key("a b", "a"), Key("a b", "a"))
+	assert.NotEqual(t, Key("a b", "a"), Key("a b", "b"))
+	assert.NotEqual(t, Key("ab", ""), Key("b", "a"))
+}
@@ -7,10 +7,22 @@ import (
 
 	"github.com/zzhirong/contextdict/config"
 	"github.com/zzhirong/contextdict/internal/ai"
+	"github.com/zzhirong/contextdict/internal/batch"
+	"github.com/zzhirong/contextdict/internal/budget"
+	"github.com/zzhirong/contextdict/internal/conversation"
 	"github.com/zzhirong/contextdict/internal/database"
+	"github.com/zzhirong/contextdict/internal/dict"
+	"github.com/zzhirong/contextdict/internal/guard"
 	"github.com/zzhirong/contextdict/internal/handlers"
+	"github.com/zzhirong/contextdict/internal/jobs"
 	"github.com/zzhirong/contextdict/internal/metrics"
+	"github.com/zzhirong/contextdict/internal/moderation"
+	"github.com/zzhirong/contextdict/internal/ocr"
+	"github.com/zzhirong/contextdict/internal/reporting"
 	"github.com/zzhirong/contextdict/internal/server"
+	"github.com/zzhirong/contextdict/internal/summarize"
+	"github.com/zzhirong/contextdict/internal/tracing"
+	"github.com/zzhirong/contextdict/internal/tts"
 
 	"context"
 	"os"
@@ -31,6 +43,16 @@ func main() {
 		log.Fatal("Failed to load configuration.")
 	}
 
+	reporter, err := reporting.New(cfg.SentryDsn, cfg.ErrorReporting)
+	if err != nil {
+		log.Fatalf("Failed to initialize error reporting: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	dbRepo, err := database.NewRepository(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database repository: %v", err)
@@ -44,8 +66,60 @@ func main() {
 	aiClient := ai.NewClient(cfg.AI)
 
 	promMetrics := metrics.NewMetrics()
+	if err := dbRepo.Instrument(promMetrics); err != nil {
+		log.Fatalf("Failed to instrument database queries: %v", err)
+	}
+	if cfg.Guard.Enabled {
+		aiClient, err = guard.New(aiClient, cfg.Guard, promMetrics)
+		if err != nil {
+			log.Fatalf("Failed to initialize AI guard: %v", err)
+		}
+	}
+	if cfg.Moderation.Enabled {
+		// 在 guard 外层, 被拒绝的输入不会到达模型
+		aiClient, err = moderation.New(aiClient, cfg.Moderation, cfg.AI.APIKey, promMetrics)
+		if err != nil {
+			log.Fatalf("Failed to initialize moderation: %v", err)
+		}
+	}
 
 	apiHandler := handlers.NewAPIHandler(dbRepo, aiClient, promMetrics, cfg.Prompts)
+	aiBudget := budget.New(cfg.Budget, promMetrics)
+	apiHandler.Budget = aiBudget
+	apiHandler.Models = cfg.AI.Models
+	apiHandler.Timeouts = cfg.Timeouts
+	apiHandler.Language = cfg.Language
+	apiHandler.Reporter = reporter
+	if cfg.Dictionary.Enabled {
+		apiHandler.Dict = dict.New(dbRepo)
+	}
+	apiHandler.Senses = dbRepo
+	apiHandler.Glossaries = dbRepo
+	apiHandler.MaxUploadBytes = cfg.Upload.MaxMB << 20
+	apiHandler.Summarizer = summarize.New(cfg.Summarize, cfg.Prompts["summarize"], cfg.Prompts["summarize_merge"])
+	if cfg.OCR.Enabled {
+		apiHandler.OCR = ocr.New(dbRepo, cfg.Prompts["ocr"], cfg.OCR.Model, promMetrics)
+	}
+	if cfg.TTS.Enabled {
+		provider, err := tts.NewProvider(cfg.TTS, cfg.AI.APIKey)
+		if err != nil {
+			log.Fatalf("Failed to initialize TTS provider: %v", err)
+		}
+		apiHandler.TTS = tts.New(provider, dbRepo, cfg.TTS, promMetrics)
+	}
+	adminHandler := handlers.NewAdminHandler(apiHandler, aiBudget)
+
+	// 后台任务在收到退出信号后停止, 未完成的任务在下次启动时继续
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	batchRunner := batch.NewRunner(dbRepo, apiHandler, cfg.Batch)
+	batchRunner.Start(bgCtx)
+	adminHandler.Batch, adminHandler.Jobs = batchRunner, dbRepo
+	jobQueue := jobs.NewQueue(dbRepo, apiHandler, cfg.Jobs)
+	jobQueue.Start(bgCtx)
+	apiHandler.Jobs = jobQueue
+	conversations := conversation.New(dbRepo, cfg.Conversations)
+	conversations.Start(bgCtx)
+	apiHandler.Conversations = conversations
 
 	servers := make(map[string]*http.Server)
 	servers["metrics"] = metrics.StartServer(":" + cfg.MetricsPort)
@@ -56,10 +130,22 @@ func main() {
 		log.Fatalf("Failed to create sub FS for frontend/dist: %v", err)
 	}
 
-	ginServer := server.New(":" + cfg.ServerPort, cfg.MaxURLLen, apiHandler, &cfg.RateLimit, contentFS, cfg.SentryDsn)
+	ginServer := server.New(":"+cfg.ServerPort, cfg.MaxURLLen, apiHandler, adminHandler, cfg.Admin.Token, &cfg.RateLimit, contentFS, reporter)
 	servers["application"] = ginServer.Start()
 
 	GracefulShutdown(10*time.Second, servers) // 10-second shutdown timeout
+	stopBackground()
+	batchRunner.Wait()
+	jobQueue.Wait()
+	conversations.Wait()
+	apiHandler.Wait()
+	// 后台任务结束后再关闭, 它们的 span 也能导出
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Error shutting down tracing: %v", err)
+	}
+	cancel()
+	reporter.Flush(2 * time.Second)
 	log.Println("Application finished.")
 }
 